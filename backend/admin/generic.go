@@ -5,14 +5,25 @@ import (
 	"net/http"
 
 	"github.com/jim-nnamdi/coldfinance/backend/connection"
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
 	"go.uber.org/zap"
 )
 
 var (
 	conn           = connection.Dbconn()
 	coldfinancelog = connection.Coldfinancelog()
+	quotas         QuotaReporter
 )
 
+// QuotaReporter reports how much of the upstream api budgets is used.
+type QuotaReporter interface {
+	Usage() []finance.QuotaUsage
+}
+
+func SetQuotaReporter(q QuotaReporter) {
+	quotas = q
+}
+
 func GetPostsCount() (int, error) {
 	postcount, err := conn.Query("select count(*) from posts")
 	if err != nil {
@@ -53,6 +64,9 @@ func GetAllData(w http.ResponseWriter, r *http.Request) {
 	retdata := map[string]interface{}{}
 	retdata["usercount"] = ucount
 	retdata["postcount"] = pcount
+	if quotas != nil {
+		retdata["quotas"] = quotas.Usage()
+	}
 
 	w.Header().Add("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(retdata)
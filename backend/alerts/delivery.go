@@ -0,0 +1,163 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// Alert is a rule that fired, as sent to webhooks.
+type Alert struct {
+	RuleId    int       `json:"rule_id"`
+	Kind      string    `json:"kind"`
+	Symbol    string    `json:"symbol"`
+	Condition string    `json:"condition"`
+	Price     float64   `json:"price"`
+	Message   string    `json:"message"`
+	Time      time.Time `json:"time"`
+}
+
+// Mailer sends a plain text email.
+type Mailer interface {
+	Send(ctx context.Context, to string, subject string, body string) error
+}
+
+var _ Mailer = &LogMailer{}
+
+// LogMailer stands in for an SMTP server: mails are logged and kept,
+// newest last, instead of being sent.
+type LogMailer struct {
+	logger *zap.Logger
+
+	mu   sync.Mutex
+	sent []Mail
+}
+
+type Mail struct {
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Body    string    `json:"body"`
+	Time    time.Time `json:"time"`
+}
+
+// most mails a LogMailer keeps
+const maxLoggedMails = 100
+
+func NewLogMailer(logger *zap.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+func (m *LogMailer) Send(ctx context.Context, to string, subject string, body string) error {
+	m.logger.Info("sending mail", zap.String("to", to), zap.String("subject", subject))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, Mail{To: to, Subject: subject, Body: body, Time: time.Now().UTC()})
+	if len(m.sent) > maxLoggedMails {
+		m.sent = m.sent[len(m.sent)-maxLoggedMails:]
+	}
+	return nil
+}
+
+// Sent lists the mails kept so far.
+func (m *LogMailer) Sent() []Mail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Mail(nil), m.sent...)
+}
+
+// publicIP tells whether ip is somewhere a webhook may be sent: not
+// loopback, private, link-local, multicast or unspecified.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// checkWebhookHost refuses the hosts of a webhook url that are plainly
+// not public. names are only resolved when the webhook is called, so
+// the dialer checks again there.
+func checkWebhookHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && !publicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// refusePrivate is the dialer control of the webhook client. it sees
+// the address a name resolved to, so a public name pointing inside our
+// network is refused as well.
+func refusePrivate(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// newWebhookClient calls webhooks with the private address check on
+// every connection, no proxy that would dial for us and no redirects,
+// which could point anywhere: a 3xx answer counts as a failure.
+func newWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: refusePrivate}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// deliver sends alert on the channel of rule. in-app alerts need
+// nothing more, every alert is already stored as a notification.
+func (s *Service) deliver(ctx context.Context, rule Rule, alert Alert) error {
+	switch rule.Channel {
+	case Webhook:
+		body, err := json.Marshal(alert)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, rule.Target, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "coldfinance-alerts")
+		res, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode >= 300 {
+			return fmt.Errorf("webhook answered %s", res.Status)
+		}
+		return nil
+	case Email:
+		return s.mailer.Send(ctx, rule.Target, "coldfinance alert: "+alert.Symbol, alert.Message)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,121 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+)
+
+func TestWebhookTargets(t *testing.T) {
+	tests := []struct {
+		target  string
+		wantErr bool
+	}{
+		{target: "https://hooks.example.com/alerts"},
+		{target: "http://93.184.216.34:8080/hook"},
+		{target: "ftp://hooks.example.com", wantErr: true},
+		{target: "https://", wantErr: true},
+		{target: "http://localhost:9900/admin", wantErr: true},
+		{target: "http://api.localhost/", wantErr: true},
+		{target: "http://127.0.0.1/", wantErr: true},
+		{target: "http://10.0.0.5/", wantErr: true},
+		{target: "http://192.168.1.1/", wantErr: true},
+		{target: "http://169.254.169.254/latest/meta-data", wantErr: true},
+		{target: "http://0.0.0.0/", wantErr: true},
+		{target: "http://[::1]/", wantErr: true},
+		{target: "http://[fe80::1]/", wantErr: true},
+		{target: "http://[fd00::1]/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			r := Rule{Kind: "coin", Symbol: "BTC", Condition: Above, Threshold: 1, Channel: Webhook, Target: tt.target}
+			err := r.normalize("")
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("got %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidRule) {
+				t.Errorf("got %v, want ErrInvalidRule", err)
+			}
+		})
+	}
+}
+
+func TestEmailTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		account string
+		want    string
+		wantErr bool
+	}{
+		{name: "defaults to the account", account: "ada@example.com", want: "ada@example.com"},
+		{name: "the account's own address", target: "Ada@Example.com", account: "ada@example.com", want: "ada@example.com"},
+		{name: "someone else", target: "bob@example.com", account: "ada@example.com", wantErr: true},
+		{name: "account without an address", account: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Rule{Kind: "coin", Symbol: "BTC", Condition: Above, Threshold: 1, Channel: Email, Target: tt.target}
+			err := r.normalize(tt.account)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidRule) {
+					t.Errorf("got %v, want ErrInvalidRule", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Target != tt.want {
+				t.Errorf("target %q, want %q", r.Target, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddresses(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	s := &Service{logger: zap.NewNop(), client: newWebhookClient(time.Second)}
+	// the rule check is skipped here, as for a name that resolves to a
+	// loopback address only when called
+	err := s.deliver(context.Background(), Rule{Channel: Webhook, Target: srv.URL}, Alert{Symbol: "BTC"})
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("got %v, want ErrPrivateAddress", err)
+	}
+	if called {
+		t.Error("the webhook was called")
+	}
+}
+
+func TestWebhookClientDoesNotFollowRedirects(t *testing.T) {
+	// the dial check would refuse the test server, so only the redirect
+	// policy of the client is used
+	client := newWebhookClient(time.Second)
+	client.Transport = http.DefaultTransport
+	followed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/next" {
+			followed = true
+			return
+		}
+		http.Redirect(w, r, "/next", http.StatusFound)
+	}))
+	defer srv.Close()
+
+	s := &Service{logger: zap.NewNop(), client: client}
+	err := s.deliver(context.Background(), Rule{Channel: Webhook, Target: srv.URL}, Alert{Symbol: "BTC"})
+	if err == nil || followed {
+		t.Errorf("got %v with the redirect followed %v, want a failure and no follow", err, followed)
+	}
+}
@@ -0,0 +1,165 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jim-nnamdi/coldfinance/backend/users"
+	"go.uber.org/zap"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// formId reads the id form value.
+func formId(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		return 0, errors.New("id must be a positive whole number")
+	}
+	return id, nil
+}
+
+// Rules lists the rules of the current user on GET and adds one on
+// POST, from the kind, symbol, condition, threshold, indicator,
+// period, channel and target form values.
+func (s *Service) Rules(w http.ResponseWriter, r *http.Request) {
+	user := users.RequireUser(w, r)
+	if user == nil {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := s.store.Rules(r.Context(), user.Id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rules)
+	case http.MethodPost:
+		rule := Rule{
+			UserId:    user.Id,
+			Kind:      r.FormValue("kind"),
+			Symbol:    r.FormValue("symbol"),
+			Condition: r.FormValue("condition"),
+			Indicator: r.FormValue("indicator"),
+			Channel:   r.FormValue("channel"),
+			Target:    r.FormValue("target"),
+		}
+		var err error
+		if v := r.FormValue("threshold"); v != "" {
+			if rule.Threshold, err = strconv.ParseFloat(v, 64); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("%w: threshold must be a number", ErrInvalidRule))
+				return
+			}
+		}
+		if v := r.FormValue("period"); v != "" {
+			if rule.Period, err = strconv.Atoi(v); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("%w: period must be a whole number", ErrInvalidRule))
+				return
+			}
+		}
+		if err := rule.normalize(user.EmailAdd); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.checkCoin(r.Context(), rule); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrInvalidRule) {
+				status = http.StatusBadRequest
+			}
+			writeError(w, status, err)
+			return
+		}
+		if err := s.store.AddRule(r.Context(), &rule, s.config.MaxRules); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, ErrTooManyRules) {
+				status = http.StatusConflict
+			}
+			writeError(w, status, err)
+			return
+		}
+		if err := s.track(rule); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, rule)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use GET or POST"))
+	}
+}
+
+// DeleteRule removes the rule given by id.
+func (s *Service) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	user := users.RequireUser(w, r)
+	if user == nil {
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use POST or DELETE"))
+		return
+	}
+	id, err := formId(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.store.DeleteRule(r.Context(), user.Id, id); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrRuleNotFound) {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+	s.untrack(id)
+	writeJSON(w, http.StatusOK, map[string]int{"deleted": id})
+}
+
+// Notifications lists the newest alerts of the current user, only the
+// unread ones with unread=true.
+func (s *Service) Notifications(w http.ResponseWriter, r *http.Request) {
+	user := users.RequireUser(w, r)
+	if user == nil {
+		return
+	}
+	notes, err := s.store.Notifications(r.Context(), user.Id, r.FormValue("unread") == "true")
+	if err != nil {
+		s.logger.Debug("could not list notifications", zap.Any("error", err))
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, notes)
+}
+
+// MarkRead marks the notification given by id as read.
+func (s *Service) MarkRead(w http.ResponseWriter, r *http.Request) {
+	user := users.RequireUser(w, r)
+	if user == nil {
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+		return
+	}
+	id, err := formId(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := s.store.MarkRead(r.Context(), user.Id, id); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"read": id})
+}
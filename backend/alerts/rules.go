@@ -0,0 +1,145 @@
+package alerts
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jim-nnamdi/coldfinance/backend/stream"
+)
+
+// conditions a rule can watch for
+const (
+	Above = "above"
+	Below = "below"
+	// the price moved Threshold percent, either way, from where it was
+	// when the rule was last armed
+	Move = "move"
+	// the price crosses the moving average of its last Period prices
+	CrossAbove = "cross_above"
+	CrossBelow = "cross_below"
+)
+
+// delivery channels
+const (
+	InApp   = "inapp"
+	Webhook = "webhook"
+	Email   = "email"
+)
+
+const (
+	defaultIndicatorPeriod = 20
+	// longest moving average a rule may cross, and so the most prices
+	// kept per symbol
+	maxIndicatorPeriod = 200
+)
+
+var (
+	ErrInvalidRule  = errors.New("invalid alert rule")
+	ErrRuleNotFound = errors.New("alert rule not found")
+	ErrTooManyRules = errors.New("too many alert rules")
+)
+
+// Rule is what a user wants to be told about. a rule fires once when
+// its condition starts to hold and is armed again when it stops
+// holding, so a price sitting above a threshold is reported once.
+type Rule struct {
+	Id            int        `json:"id"`
+	UserId        int        `json:"user_id"`
+	Kind          string     `json:"kind"`
+	Symbol        string     `json:"symbol"`
+	Condition     string     `json:"condition"`
+	Threshold     float64    `json:"threshold,omitempty"`
+	Indicator     string     `json:"indicator,omitempty"`
+	Period        int        `json:"period,omitempty"`
+	Channel       string     `json:"channel"`
+	Target        string     `json:"target,omitempty"`
+	Active        bool       `json:"active"`
+	LastTriggered *time.Time `json:"last_triggered,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// normalize checks r and fills in the defaults: the indicator and
+// period of a cross, and the user's address for email. email alerts
+// only go to that address, so rules cannot mail strangers.
+func (r *Rule) normalize(email string) error {
+	r.Kind = strings.ToLower(strings.TrimSpace(r.Kind))
+	r.Symbol = strings.ToUpper(strings.TrimSpace(r.Symbol))
+	r.Condition = strings.ToLower(strings.TrimSpace(r.Condition))
+	r.Channel = strings.ToLower(strings.TrimSpace(r.Channel))
+	r.Target = strings.TrimSpace(r.Target)
+	if r.Kind != stream.KindCoin && r.Kind != stream.KindStock {
+		return fmt.Errorf("%w: kind must be %s or %s", ErrInvalidRule, stream.KindCoin, stream.KindStock)
+	}
+	if r.Symbol == "" {
+		return fmt.Errorf("%w: symbol is required", ErrInvalidRule)
+	}
+	switch r.Condition {
+	case Above, Below:
+		if r.Threshold <= 0 {
+			return fmt.Errorf("%w: threshold must be a positive price", ErrInvalidRule)
+		}
+	case Move:
+		if r.Threshold <= 0 {
+			return fmt.Errorf("%w: threshold must be a positive percentage", ErrInvalidRule)
+		}
+	case CrossAbove, CrossBelow:
+		r.Indicator = strings.ToLower(r.Indicator)
+		if r.Indicator == "" {
+			r.Indicator = "sma"
+		}
+		if r.Indicator != "sma" && r.Indicator != "ema" {
+			return fmt.Errorf("%w: indicator must be sma or ema", ErrInvalidRule)
+		}
+		if r.Period == 0 {
+			r.Period = defaultIndicatorPeriod
+		}
+		if r.Period < 2 || r.Period > maxIndicatorPeriod {
+			return fmt.Errorf("%w: period must be between 2 and %d", ErrInvalidRule, maxIndicatorPeriod)
+		}
+	default:
+		return fmt.Errorf("%w: condition must be one of %s, %s, %s, %s or %s", ErrInvalidRule, Above, Below, Move, CrossAbove, CrossBelow)
+	}
+	switch r.Channel {
+	case "":
+		r.Channel = InApp
+	case InApp:
+	case Webhook:
+		u, err := url.Parse(r.Target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%w: target must be an http(s) url for webhooks", ErrInvalidRule)
+		}
+		if err := checkWebhookHost(u.Hostname()); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRule, err)
+		}
+	case Email:
+		if r.Target != "" && !strings.EqualFold(r.Target, email) {
+			return fmt.Errorf("%w: email alerts can only go to the address of the account", ErrInvalidRule)
+		}
+		if !strings.Contains(email, "@") {
+			return fmt.Errorf("%w: the account has no email address", ErrInvalidRule)
+		}
+		r.Target = email
+	default:
+		return fmt.Errorf("%w: channel must be %s, %s or %s", ErrInvalidRule, InApp, Webhook, Email)
+	}
+	return nil
+}
+
+// describe says in words what happened when r fired at price.
+func (r *Rule) describe(price float64, change float64) string {
+	switch r.Condition {
+	case Above:
+		return fmt.Sprintf("%s is above %g at %g", r.Symbol, r.Threshold, price)
+	case Below:
+		return fmt.Sprintf("%s is below %g at %g", r.Symbol, r.Threshold, price)
+	case Move:
+		return fmt.Sprintf("%s moved %+.2f%% to %g", r.Symbol, change, price)
+	case CrossAbove:
+		return fmt.Sprintf("%s crossed above its %d period %s at %g", r.Symbol, r.Period, strings.ToUpper(r.Indicator), price)
+	default:
+		return fmt.Sprintf("%s crossed below its %d period %s at %g", r.Symbol, r.Period, strings.ToUpper(r.Indicator), price)
+	}
+}
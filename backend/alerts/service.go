@@ -0,0 +1,327 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
+	"github.com/jim-nnamdi/coldfinance/backend/finance/indicators"
+	"github.com/jim-nnamdi/coldfinance/backend/stream"
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+type Config struct {
+	// updates waiting to be evaluated before new ones are dropped
+	Queue int
+	// alerts delivered at the same time
+	Workers        int
+	WebhookTimeout time.Duration
+	// most rules one user may have
+	MaxRules int
+}
+
+// ConfigFromEnv reads ALERTS_QUEUE (1024 by default), ALERTS_WORKERS
+// (4), ALERTS_WEBHOOK_TIMEOUT (10s) and ALERTS_MAX_RULES (50).
+func ConfigFromEnv() Config {
+	_ = godotenv.Load()
+	config := Config{Queue: 1024, Workers: 4, WebhookTimeout: 10 * time.Second, MaxRules: 50}
+	ints := map[string]*int{
+		"ALERTS_QUEUE":     &config.Queue,
+		"ALERTS_WORKERS":   &config.Workers,
+		"ALERTS_MAX_RULES": &config.MaxRules,
+	}
+	for env, n := range ints {
+		if v, err := strconv.Atoi(os.Getenv(env)); err == nil && v > 0 {
+			*n = v
+		}
+	}
+	if v, err := time.ParseDuration(os.Getenv("ALERTS_WEBHOOK_TIMEOUT")); err == nil && v > 0 {
+		config.WebhookTimeout = v
+	}
+	return config
+}
+
+// ruleState is a rule with what the evaluator remembers about it
+// between updates. it lives in memory only, so a restart arms every
+// rule again.
+type ruleState struct {
+	rule  Rule
+	armed bool
+	// Move: the price moves are measured from
+	reference float64
+	// crosses: which side of the average the last price was on
+	above  bool
+	placed bool
+}
+
+type delivery struct {
+	rule  Rule
+	alert Alert
+}
+
+// Service keeps the active rules of every user, evaluates them on each
+// price the hub publishes and hands out what fired.
+type Service struct {
+	logger *zap.Logger
+	store  Store
+	hub    *stream.Hub
+	crypto finance.CryptoData
+	mailer Mailer
+	client *http.Client
+	config Config
+
+	updates    chan stream.Update
+	deliveries chan delivery
+
+	mu       sync.Mutex
+	rules    map[int]*ruleState
+	bySymbol map[string]map[int]*ruleState
+	prices   map[string][]float64
+}
+
+// NewService evaluates rules on the prices of hub. crypto tells which
+// coins there are when a rule is added.
+func NewService(logger *zap.Logger, store Store, hub *stream.Hub, crypto finance.CryptoData, mailer Mailer, config Config) *Service {
+	return &Service{
+		logger:     logger,
+		store:      store,
+		hub:        hub,
+		crypto:     crypto,
+		mailer:     mailer,
+		client:     newWebhookClient(config.WebhookTimeout),
+		config:     config,
+		updates:    make(chan stream.Update, config.Queue),
+		deliveries: make(chan delivery, config.Queue),
+		rules:      map[int]*ruleState{},
+		bySymbol:   map[string]map[int]*ruleState{},
+		prices:     map[string][]float64{},
+	}
+}
+
+// Load starts watching the active rules in the store.
+func (s *Service) Load(ctx context.Context) error {
+	rules, err := s.store.ActiveRules(ctx)
+	if err != nil {
+		return err
+	}
+	for _, r := range rules {
+		if err := s.track(r); err != nil {
+			s.logger.Warn("could not watch alert rule", zap.Int("rule", r.Id), zap.Any("error", err))
+		}
+	}
+	return nil
+}
+
+// Run listens to the hub and evaluates until ctx is done.
+func (s *Service) Run(ctx context.Context) {
+	s.hub.OnUpdate(s.offer)
+	var wg sync.WaitGroup
+	for i := 0; i < s.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.deliverAll(ctx)
+		}()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case u := <-s.updates:
+			s.evaluate(ctx, u)
+		}
+	}
+}
+
+// checkCoin refuses a coin rule on a symbol the live rates do not
+// quote, which the hub would never publish a price for.
+func (s *Service) checkCoin(ctx context.Context, r Rule) error {
+	if r.Kind != stream.KindCoin {
+		return nil
+	}
+	live, err := s.crypto.GetLiveCryptoData(ctx, "")
+	if err != nil {
+		return err
+	}
+	if _, ok := live.Rates[r.Symbol]; !ok {
+		return fmt.Errorf("%w: no live rate for coin %s", ErrInvalidRule, r.Symbol)
+	}
+	return nil
+}
+
+// offer is the hub listener. it must not hold the hub up, so an update
+// that finds the queue full is dropped.
+func (s *Service) offer(u stream.Update) {
+	select {
+	case s.updates <- u:
+	default:
+		s.logger.Warn("alert queue full, dropping update", zap.String("symbol", u.Symbol))
+	}
+}
+
+func symbolKey(kind string, symbol string) string {
+	return kind + ":" + symbol
+}
+
+func (s *Service) track(r Rule) error {
+	if err := s.hub.Watch(r.Kind, r.Symbol); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	st := &ruleState{rule: r, armed: true}
+	s.rules[r.Id] = st
+	key := symbolKey(r.Kind, r.Symbol)
+	if s.bySymbol[key] == nil {
+		s.bySymbol[key] = map[int]*ruleState{}
+	}
+	s.bySymbol[key][r.Id] = st
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Service) untrack(id int) {
+	s.mu.Lock()
+	st, ok := s.rules[id]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.rules, id)
+	key := symbolKey(st.rule.Kind, st.rule.Symbol)
+	delete(s.bySymbol[key], id)
+	if len(s.bySymbol[key]) == 0 {
+		delete(s.bySymbol, key)
+		delete(s.prices, key)
+	}
+	s.mu.Unlock()
+	s.hub.Unwatch(st.rule.Kind, st.rule.Symbol)
+}
+
+func (s *Service) evaluate(ctx context.Context, u stream.Update) {
+	key := symbolKey(u.Kind, u.Symbol)
+	s.mu.Lock()
+	states := s.bySymbol[key]
+	if len(states) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	prices := append(s.prices[key], u.Price)
+	if len(prices) > maxIndicatorPeriod {
+		prices = prices[len(prices)-maxIndicatorPeriod:]
+	}
+	s.prices[key] = prices
+
+	fired := make([]delivery, 0)
+	for _, st := range states {
+		ok, change := st.check(u.Price, prices)
+		if !ok {
+			continue
+		}
+		fired = append(fired, delivery{rule: st.rule, alert: Alert{
+			RuleId:    st.rule.Id,
+			Kind:      u.Kind,
+			Symbol:    u.Symbol,
+			Condition: st.rule.Condition,
+			Price:     u.Price,
+			Message:   st.rule.describe(u.Price, change),
+			Time:      u.Time,
+		}})
+	}
+	s.mu.Unlock()
+
+	for _, d := range fired {
+		s.fire(ctx, d)
+	}
+}
+
+// check tells whether the rule fires at price, prices being the recent
+// prices of its symbol ending with this one. for Move it also returns
+// the percentage moved.
+func (st *ruleState) check(price float64, prices []float64) (bool, float64) {
+	r := st.rule
+	switch r.Condition {
+	case Above, Below:
+		holds := price >= r.Threshold
+		if r.Condition == Below {
+			holds = price <= r.Threshold
+		}
+		if !holds {
+			st.armed = true
+			return false, 0
+		}
+		fire := st.armed
+		st.armed = false
+		return fire, 0
+	case Move:
+		if st.reference == 0 {
+			st.reference = price
+			return false, 0
+		}
+		moved := (price - st.reference) / st.reference * 100
+		if math.Abs(moved) < r.Threshold {
+			return false, 0
+		}
+		st.reference = price
+		return true, moved
+	default:
+		if len(prices) < r.Period {
+			return false, 0
+		}
+		var line []float64
+		if r.Indicator == "ema" {
+			line = indicators.EMA(prices, r.Period)
+		} else {
+			line = indicators.SMA(prices, r.Period)
+		}
+		avg := line[len(line)-1]
+		if math.IsNaN(avg) || price == avg {
+			return false, 0
+		}
+		above := price > avg
+		crossed := st.placed && above != st.above
+		st.above, st.placed = above, true
+		return crossed && above == (r.Condition == CrossAbove), 0
+	}
+}
+
+// fire keeps the alert as a notification and queues its delivery.
+func (s *Service) fire(ctx context.Context, d delivery) {
+	note := &Notification{UserId: d.rule.UserId, RuleId: d.rule.Id, Message: d.alert.Message, Price: d.alert.Price, CreatedAt: time.Now().UTC()}
+	if err := s.store.AddNotification(ctx, note); err != nil {
+		s.logger.Warn("could not store notification", zap.Int("rule", d.rule.Id), zap.Any("error", err))
+	}
+	if err := s.store.Triggered(ctx, d.rule.Id, note.CreatedAt); err != nil {
+		s.logger.Debug("could not mark rule triggered", zap.Int("rule", d.rule.Id), zap.Any("error", err))
+	}
+	if d.rule.Channel == InApp {
+		return
+	}
+	select {
+	case s.deliveries <- d:
+	default:
+		s.logger.Warn("alert delivery queue full, dropping alert", zap.Int("rule", d.rule.Id))
+	}
+}
+
+func (s *Service) deliverAll(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case d := <-s.deliveries:
+			dctx, cancel := context.WithTimeout(ctx, s.config.WebhookTimeout)
+			if err := s.deliver(dctx, d.rule, d.alert); err != nil {
+				s.logger.Warn("could not deliver alert", zap.Int("rule", d.rule.Id), zap.String("channel", d.rule.Channel), zap.Any("error", err))
+			}
+			cancel()
+		}
+	}
+}
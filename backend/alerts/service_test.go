@@ -0,0 +1,274 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
+	"github.com/jim-nnamdi/coldfinance/backend/stream"
+	"go.uber.org/zap"
+)
+
+// liveCoins answers only GetLiveCryptoData.
+type liveCoins struct {
+	finance.CryptoData
+	err error
+}
+
+func (c *liveCoins) GetLiveCryptoData(ctx context.Context, target string) (*finance.LiveData, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &finance.LiveData{Target: "USD", Rates: map[string]float64{"BTC": 50000}}, nil
+}
+
+func TestCheckCoin(t *testing.T) {
+	errDown := errors.New("coinlayer is down")
+	tests := []struct {
+		name    string
+		rule    Rule
+		liveErr error
+		wantErr error
+	}{
+		{name: "known coin", rule: Rule{Kind: "coin", Symbol: "BTC"}},
+		{name: "unknown coin", rule: Rule{Kind: "coin", Symbol: "NOPE"}, wantErr: ErrInvalidRule},
+		{name: "no live rates", rule: Rule{Kind: "coin", Symbol: "BTC"}, liveErr: errDown, wantErr: errDown},
+		{name: "stocks are not checked", rule: Rule{Kind: "stock", Symbol: "NOPE"}, liveErr: errDown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{logger: zap.NewNop(), crypto: &liveCoins{err: tt.liveErr}}
+			err := s.checkCoin(context.Background(), tt.rule)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   Rule
+		prices []float64
+		// indexes of the prices the rule fires at
+		fires []int
+	}{
+		{
+			name:   "above fires once and again after dropping below",
+			rule:   Rule{Condition: Above, Threshold: 100},
+			prices: []float64{90, 101, 105, 99, 100},
+			fires:  []int{1, 4},
+		},
+		{
+			name:   "below fires once and again after rising above",
+			rule:   Rule{Condition: Below, Threshold: 50},
+			prices: []float64{60, 50, 40, 55, 45},
+			fires:  []int{1, 4},
+		},
+		{
+			name:   "above on the first price",
+			rule:   Rule{Condition: Above, Threshold: 100},
+			prices: []float64{120, 130},
+			fires:  []int{0},
+		},
+		{
+			// 122 is 22% above the first price but under 10% above 111,
+			// where the rule last fired
+			name:   "move is measured from the last fire",
+			rule:   Rule{Condition: Move, Threshold: 10},
+			prices: []float64{100, 111, 122, 123, 112, 100},
+			fires:  []int{1, 3, 5},
+		},
+		{
+			name:   "move needs a reference first",
+			rule:   Rule{Condition: Move, Threshold: 1},
+			prices: []float64{100},
+		},
+		{
+			name:   "cross above an sma",
+			rule:   Rule{Condition: CrossAbove, Indicator: "sma", Period: 3},
+			prices: []float64{10, 11, 12, 9, 12},
+			fires:  []int{4},
+		},
+		{
+			name:   "cross below an sma",
+			rule:   Rule{Condition: CrossBelow, Indicator: "sma", Period: 3},
+			prices: []float64{10, 11, 12, 9, 12},
+			fires:  []int{3},
+		},
+		{
+			// the sma of 11, 12 and 11.1 is 11.37, the ema 11.05
+			name:   "cross below an sma the ema does not see",
+			rule:   Rule{Condition: CrossBelow, Indicator: "sma", Period: 3},
+			prices: []float64{10, 11, 12, 11.1},
+			fires:  []int{3},
+		},
+		{
+			name:   "no cross below the ema",
+			rule:   Rule{Condition: CrossBelow, Indicator: "ema", Period: 3},
+			prices: []float64{10, 11, 12, 11.1},
+		},
+		{
+			name:   "cross above an ema",
+			rule:   Rule{Condition: CrossAbove, Indicator: "ema", Period: 3},
+			prices: []float64{10, 11, 12, 9, 12},
+			fires:  []int{4},
+		},
+		{
+			name:   "a price on the average keeps the side",
+			rule:   Rule{Condition: CrossAbove, Indicator: "sma", Period: 2},
+			prices: []float64{10, 8, 8, 9},
+			fires:  []int{3},
+		},
+		{
+			name:   "too few prices for the period",
+			rule:   Rule{Condition: CrossAbove, Indicator: "sma", Period: 5},
+			prices: []float64{10, 1, 20, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &ruleState{rule: tt.rule, armed: true}
+			fires := make([]int, 0)
+			for i := range tt.prices {
+				if ok, _ := st.check(tt.prices[i], tt.prices[:i+1]); ok {
+					fires = append(fires, i)
+				}
+			}
+			if tt.fires == nil {
+				tt.fires = []int{}
+			}
+			if !reflect.DeepEqual(fires, tt.fires) {
+				t.Errorf("fired at %v, want %v", fires, tt.fires)
+			}
+		})
+	}
+}
+
+func TestCheckMoveReportsChange(t *testing.T) {
+	st := &ruleState{rule: Rule{Condition: Move, Threshold: 5}, armed: true}
+	st.check(200, nil)
+	ok, change := st.check(190, nil)
+	if !ok || change != -5 {
+		t.Errorf("got %v, %v, want a fire at -5%%", ok, change)
+	}
+}
+
+// memStore keeps rules and notifications in memory.
+type memStore struct {
+	mu        sync.Mutex
+	rules     []Rule
+	notes     []Notification
+	triggered map[int]time.Time
+}
+
+func (m *memStore) Rules(ctx context.Context, userId int) ([]Rule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]Rule, 0)
+	for _, r := range m.rules {
+		if r.UserId == userId {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (m *memStore) ActiveRules(ctx context.Context) ([]Rule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Rule(nil), m.rules...), nil
+}
+
+func (m *memStore) AddRule(ctx context.Context, rule *Rule, maxRules int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.rules) >= maxRules {
+		return ErrTooManyRules
+	}
+	rule.Id = len(m.rules) + 1
+	m.rules = append(m.rules, *rule)
+	return nil
+}
+
+func (m *memStore) DeleteRule(ctx context.Context, userId int, id int) error {
+	return ErrRuleNotFound
+}
+
+func (m *memStore) Triggered(ctx context.Context, id int, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.triggered == nil {
+		m.triggered = map[int]time.Time{}
+	}
+	m.triggered[id] = at
+	return nil
+}
+
+func (m *memStore) Notifications(ctx context.Context, userId int, unread bool) ([]Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Notification(nil), m.notes...), nil
+}
+
+func (m *memStore) AddNotification(ctx context.Context, n *Notification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n.Id = len(m.notes) + 1
+	m.notes = append(m.notes, *n)
+	return nil
+}
+
+func (m *memStore) MarkRead(ctx context.Context, userId int, id int) error {
+	return nil
+}
+
+func TestEvaluate(t *testing.T) {
+	store := &memStore{rules: []Rule{
+		{Id: 1, UserId: 1, Kind: "coin", Symbol: "BTC", Condition: Above, Threshold: 100, Channel: InApp},
+		{Id: 2, UserId: 2, Kind: "coin", Symbol: "BTC", Condition: CrossBelow, Indicator: "sma", Period: 2, Channel: InApp},
+		{Id: 3, UserId: 1, Kind: "stock", Symbol: "BTC", Condition: Above, Threshold: 1, Channel: InApp},
+	}}
+	hub := stream.NewHub(zap.NewNop(), nil, nil, stream.Config{})
+	s := NewService(zap.NewNop(), store, hub, nil, nil, Config{Queue: 8})
+	if err := s.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, price := range []float64{90, 110, 120, 95} {
+		s.evaluate(context.Background(), stream.Update{Kind: "coin", Symbol: "BTC", Price: price})
+	}
+
+	want := []struct {
+		rule    int
+		message string
+	}{
+		{1, "BTC is above 100 at 110"},
+		{2, "BTC crossed below its 2 period SMA at 95"},
+	}
+	if len(store.notes) != len(want) {
+		t.Fatalf("got %d notifications %v, want %d", len(store.notes), store.notes, len(want))
+	}
+	for i, w := range want {
+		if n := store.notes[i]; n.RuleId != w.rule || n.Message != w.message {
+			t.Errorf("notification %d is %d %q, want %d %q", i, n.RuleId, n.Message, w.rule, w.message)
+		}
+	}
+	if _, ok := store.triggered[3]; ok {
+		t.Error("the stock rule fired on a coin price")
+	}
+
+	// a deleted rule is no longer evaluated
+	s.untrack(1)
+	s.evaluate(context.Background(), stream.Update{Kind: "coin", Symbol: "BTC", Price: 90})
+	s.evaluate(context.Background(), stream.Update{Kind: "coin", Symbol: "BTC", Price: 150})
+	for _, n := range store.notes[len(want):] {
+		if n.RuleId == 1 {
+			t.Errorf("untracked rule fired: %q", n.Message)
+		}
+	}
+}
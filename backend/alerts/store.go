@@ -0,0 +1,203 @@
+package alerts
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Notification is an alert kept for the user to read in the app,
+// whatever channel it was also sent on.
+type Notification struct {
+	Id        int        `json:"id"`
+	UserId    int        `json:"user_id"`
+	RuleId    int        `json:"rule_id"`
+	Message   string     `json:"message"`
+	Price     float64    `json:"price"`
+	CreatedAt time.Time  `json:"created_at"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+}
+
+type Store interface {
+	Rules(ctx context.Context, userId int) ([]Rule, error)
+	ActiveRules(ctx context.Context) ([]Rule, error)
+	// AddRule saves rule unless its user already has maxRules rules,
+	// which is ErrTooManyRules.
+	AddRule(ctx context.Context, rule *Rule, maxRules int) error
+	DeleteRule(ctx context.Context, userId int, id int) error
+	Triggered(ctx context.Context, id int, at time.Time) error
+
+	Notifications(ctx context.Context, userId int, unread bool) ([]Notification, error)
+	AddNotification(ctx context.Context, n *Notification) error
+	MarkRead(ctx context.Context, userId int, id int) error
+}
+
+var _ Store = &sqlStore{}
+
+type sqlStore struct {
+	logger *zap.Logger
+	db     *sql.DB
+}
+
+func NewStore(logger *zap.Logger, db *sql.DB) *sqlStore {
+	return &sqlStore{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// DATETIME columns come back as text, the dsn does not parse times
+const sqlTimeLayout = "2006-01-02 15:04:05"
+
+// parseSQLTime reads a DATETIME column, nil when it is NULL.
+func parseSQLTime(v sql.NullString) *time.Time {
+	if !v.Valid {
+		return nil
+	}
+	t, err := time.Parse(sqlTimeLayout, v.String)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+const ruleColumns = "id, user_id, kind, symbol, alert_condition, threshold, indicator, period, channel, target, active, last_triggered, created_at"
+
+func (s *sqlStore) Rules(ctx context.Context, userId int) ([]Rule, error) {
+	return s.queryRules(ctx, "select "+ruleColumns+" from alert_rules where user_id = ? order by id", userId)
+}
+
+func (s *sqlStore) ActiveRules(ctx context.Context) ([]Rule, error) {
+	return s.queryRules(ctx, "select "+ruleColumns+" from alert_rules where active = 1")
+}
+
+func (s *sqlStore) queryRules(ctx context.Context, query string, args ...any) ([]Rule, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Debug("could not fetch alert rules", zap.Any("error", err))
+		return nil, err
+	}
+	defer rows.Close()
+	rules := make([]Rule, 0)
+	for rows.Next() {
+		var (
+			r                  Rule
+			triggered, created sql.NullString
+		)
+		if err := rows.Scan(&r.Id, &r.UserId, &r.Kind, &r.Symbol, &r.Condition, &r.Threshold, &r.Indicator, &r.Period, &r.Channel, &r.Target, &r.Active, &triggered, &created); err != nil {
+			s.logger.Debug("could not scan alert rule", zap.Any("error", err))
+			return nil, err
+		}
+		r.LastTriggered = parseSQLTime(triggered)
+		if at := parseSQLTime(created); at != nil {
+			r.CreatedAt = *at
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+func (s *sqlStore) AddRule(ctx context.Context, rule *Rule, maxRules int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// the locking read holds back other adds for the user until this
+	// one is done, so two of them cannot both pass the count
+	var count int
+	if err := tx.QueryRowContext(ctx, "select count(*) from alert_rules where user_id = ? for update", rule.UserId).Scan(&count); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count >= maxRules {
+		tx.Rollback()
+		return fmt.Errorf("%w: at most %d per user", ErrTooManyRules, maxRules)
+	}
+	rule.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	rule.Active = true
+	res, err := tx.ExecContext(ctx, "insert into alert_rules(user_id, kind, symbol, alert_condition, threshold, indicator, period, channel, target, active, created_at) values(?,?,?,?,?,?,?,?,?,?,?)",
+		rule.UserId, rule.Kind, rule.Symbol, rule.Condition, rule.Threshold, rule.Indicator, rule.Period, rule.Channel, rule.Target, rule.Active, rule.CreatedAt.Format(sqlTimeLayout))
+	if err != nil {
+		tx.Rollback()
+		s.logger.Debug("could not save alert rule", zap.Any("error", err))
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	rule.Id = int(id)
+	return tx.Commit()
+}
+
+// DeleteRule removes a rule of userId, ErrRuleNotFound when the user
+// has no such rule.
+func (s *sqlStore) DeleteRule(ctx context.Context, userId int, id int) error {
+	res, err := s.db.ExecContext(ctx, "delete from alert_rules where id = ? and user_id = ?", id, userId)
+	if err != nil {
+		s.logger.Debug("could not delete alert rule", zap.Any("error", err))
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrRuleNotFound
+	}
+	return nil
+}
+
+func (s *sqlStore) Triggered(ctx context.Context, id int, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, "update alert_rules set last_triggered = ? where id = ?", at.UTC().Format(sqlTimeLayout), id)
+	return err
+}
+
+func (s *sqlStore) Notifications(ctx context.Context, userId int, unread bool) ([]Notification, error) {
+	query := "select id, user_id, rule_id, message, price, created_at, read_at from notifications where user_id = ?"
+	if unread {
+		query += " and read_at is null"
+	}
+	rows, err := s.db.QueryContext(ctx, query+" order by id desc limit 100", userId)
+	if err != nil {
+		s.logger.Debug("could not fetch notifications", zap.Any("error", err))
+		return nil, err
+	}
+	defer rows.Close()
+	notes := make([]Notification, 0)
+	for rows.Next() {
+		var (
+			n             Notification
+			created, read sql.NullString
+		)
+		if err := rows.Scan(&n.Id, &n.UserId, &n.RuleId, &n.Message, &n.Price, &created, &read); err != nil {
+			s.logger.Debug("could not scan notification", zap.Any("error", err))
+			return nil, err
+		}
+		if at := parseSQLTime(created); at != nil {
+			n.CreatedAt = *at
+		}
+		n.ReadAt = parseSQLTime(read)
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+func (s *sqlStore) AddNotification(ctx context.Context, n *Notification) error {
+	res, err := s.db.ExecContext(ctx, "insert into notifications(user_id, rule_id, message, price, created_at) values(?,?,?,?,?)", n.UserId, n.RuleId, n.Message, n.Price, n.CreatedAt.UTC().Format(sqlTimeLayout))
+	if err != nil {
+		s.logger.Debug("could not save notification", zap.Any("error", err))
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	n.Id = int(id)
+	return nil
+}
+
+func (s *sqlStore) MarkRead(ctx context.Context, userId int, id int) error {
+	_, err := s.db.ExecContext(ctx, "update notifications set read_at = ? where id = ? and user_id = ? and read_at is null", time.Now().UTC().Format(sqlTimeLayout), id, userId)
+	return err
+}
@@ -4,4 +4,30 @@ CREATE TABLE IF NOT EXISTS posts(id int PRIMARY KEY AUTO_INCREMENT, title TEXT,
 
 ALTER TABLE posts ADD approved int(0);
 
-ALTER TABLE users ADD walletbalance bigint(50);
\ No newline at end of file
+ALTER TABLE users ADD walletbalance bigint(50);
+
+CREATE TABLE IF NOT EXISTS eod_bars(symbol VARCHAR(32) NOT NULL, exchange VARCHAR(16) NOT NULL, date DATE NOT NULL, open DOUBLE, high DOUBLE, low DOUBLE, close DOUBLE, volume DOUBLE, adj_open DOUBLE, adj_high DOUBLE, adj_low DOUBLE, adj_close DOUBLE, adj_volume DOUBLE, split_factor DOUBLE, dividend DOUBLE, PRIMARY KEY(symbol, date));
+
+CREATE TABLE IF NOT EXISTS eod_coverage(id int PRIMARY KEY AUTO_INCREMENT, symbol VARCHAR(32) NOT NULL, date_from DATE NOT NULL, date_to DATE NOT NULL, INDEX(symbol));
+
+CREATE TABLE IF NOT EXISTS intraday_bars(symbol VARCHAR(32) NOT NULL, exchange VARCHAR(16) NOT NULL, date DATETIME NOT NULL, open DOUBLE, high DOUBLE, low DOUBLE, last DOUBLE NULL, close DOUBLE NULL, volume DOUBLE NULL, PRIMARY KEY(symbol, date));
+
+CREATE TABLE IF NOT EXISTS intraday_coverage(id int PRIMARY KEY AUTO_INCREMENT, symbol VARCHAR(32) NOT NULL, date_from DATE NOT NULL, date_to DATE NOT NULL, INDEX(symbol));
+
+CREATE TABLE IF NOT EXISTS crypto_rate_days(date DATE PRIMARY KEY, target VARCHAR(8) NOT NULL, timestamp BIGINT);
+
+CREATE TABLE IF NOT EXISTS crypto_rates(date DATE NOT NULL, symbol VARCHAR(16) NOT NULL, rate DOUBLE, PRIMARY KEY(date, symbol));
+
+CREATE TABLE IF NOT EXISTS alert_rules(id int PRIMARY KEY AUTO_INCREMENT, user_id int NOT NULL, kind VARCHAR(8) NOT NULL, symbol VARCHAR(32) NOT NULL, alert_condition VARCHAR(16) NOT NULL, threshold DOUBLE, indicator VARCHAR(8) NOT NULL DEFAULT '', period int NOT NULL DEFAULT 0, channel VARCHAR(16) NOT NULL, target TEXT, active int NOT NULL DEFAULT 1, last_triggered DATETIME NULL, created_at DATETIME NOT NULL, INDEX(user_id));
+
+CREATE TABLE IF NOT EXISTS notifications(id int PRIMARY KEY AUTO_INCREMENT, user_id int NOT NULL, rule_id int NOT NULL, message TEXT, price DOUBLE, created_at DATETIME NOT NULL, read_at DATETIME NULL, INDEX(user_id));
+
+CREATE TABLE IF NOT EXISTS watchlists(id int PRIMARY KEY AUTO_INCREMENT, user_id int NOT NULL, name VARCHAR(64) NOT NULL, created_at DATETIME NOT NULL, UNIQUE(user_id, name));
+
+CREATE TABLE IF NOT EXISTS watchlist_items(watchlist_id int NOT NULL, kind VARCHAR(8) NOT NULL, symbol VARCHAR(32) NOT NULL, position int NOT NULL, PRIMARY KEY(watchlist_id, kind, symbol));
+
+CREATE TABLE IF NOT EXISTS portfolio_transactions(id int PRIMARY KEY AUTO_INCREMENT, user_id int NOT NULL, kind VARCHAR(8) NOT NULL, symbol VARCHAR(32) NOT NULL, side VARCHAR(4) NOT NULL, quantity DECIMAL(38,18) NOT NULL, price DECIMAL(38,18) NOT NULL, fee DECIMAL(38,18) NOT NULL DEFAULT 0, traded_at DATETIME NOT NULL, created_at DATETIME NOT NULL, INDEX(user_id));
+
+CREATE TABLE IF NOT EXISTS ticker_catalog(symbol VARCHAR(32) NOT NULL, mic VARCHAR(16) NOT NULL, position int NOT NULL, pass int NOT NULL, data TEXT NOT NULL, PRIMARY KEY(symbol, mic));
+
+CREATE TABLE IF NOT EXISTS ticker_catalog_state(id int PRIMARY KEY, pass int NOT NULL, next_offset int NOT NULL, total int NOT NULL, complete int NOT NULL, refreshed DATETIME NOT NULL);
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/jim-nnamdi/coldfinance/backend/connection"
+	"github.com/jim-nnamdi/coldfinance/backend/events"
 
 	"go.uber.org/zap"
 )
@@ -93,8 +94,7 @@ func GetSinglePost(slug string) (*Postx, error) {
 }
 
 func AddPost(title string, body string, image string, author string, category string, dateposted string) (bool, error) {
-	split_title := strings.Split(title, " ")
-	genslug := strings.Join(split_title, "-")
+	genslug := slugify(title)
 	addpost, err := conn.Exec("insert into posts(title, body, slug, author, image, approved,category,dateposted) values(?,?,?,?,?,?,?,?)", title, body, genslug, author, image, 1, category, dateposted)
 	if err != nil {
 		coldfinancelog.Debug("could not create new post", zap.Any("error", err))
@@ -109,6 +109,11 @@ func AddPost(title string, body string, image string, author string, category st
 	return true, nil
 }
 
+func slugify(title string) string {
+	split_title := strings.Split(title, " ")
+	return strings.Join(split_title, "-")
+}
+
 func GetAllPosts(w http.ResponseWriter, r *http.Request) {
 	coldfinancelog.Debug("hitting this point", zap.Any("point", "hitting this point"))
 	allposts, err := GetPosts()
@@ -172,6 +177,13 @@ func AddNewPost(w http.ResponseWriter, r *http.Request) {
 		coldfinancelog.Error("cannot add new post", zap.Any("error", err))
 		return
 	}
+	slug := slugify(r.FormValue("title"))
+	events.Emit(r.Context(), events.TypePostCreated, slug, events.PostCreated{
+		Title:    r.FormValue("title"),
+		Slug:     slug,
+		Author:   r.FormValue("author"),
+		Category: r.FormValue("category"),
+	})
 	w.Header().Add("Content-Type", "application/json")
 	json.NewEncoder(w).Encode("new post added successfully!")
 }
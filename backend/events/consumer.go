@@ -0,0 +1,121 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// dead letters of a topic go to the topic with this suffix
+const deadLetterSuffix = ".dlq"
+
+// Handler does the work for one event. an error makes the consumer try
+// again, up to its retries.
+type Handler func(ctx context.Context, ev Event) error
+
+type ConsumerConfig struct {
+	// tries after the first failed one
+	Retries int
+	// wait before the first retry, doubled for every one after it. zero
+	// waits a second
+	Backoff time.Duration
+	// where events go once every try failed, nil drops them
+	DeadLetters Publisher
+}
+
+// Consumer reads a Source and hands every event to the handler of its
+// type. events without a handler are committed and skipped, so a
+// consumer only needs to know the types it cares about.
+type Consumer struct {
+	logger   *zap.Logger
+	source   Source
+	config   ConsumerConfig
+	handlers map[string]Handler
+}
+
+func NewConsumer(logger *zap.Logger, source Source, config ConsumerConfig) *Consumer {
+	if config.Backoff <= 0 {
+		config.Backoff = time.Second
+	}
+	return &Consumer{
+		logger:   logger,
+		source:   source,
+		config:   config,
+		handlers: map[string]Handler{},
+	}
+}
+
+// Handle registers h for events of type typ. it is not safe to call
+// once Run has started.
+func (c *Consumer) Handle(typ string, h Handler) {
+	c.handlers[typ] = h
+}
+
+// Run consumes until ctx is done or the source is closed, then closes
+// the source.
+func (c *Consumer) Run(ctx context.Context) error {
+	defer c.source.Close()
+	for {
+		msg, err := c.source.Fetch(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case errors.Is(err, ErrBrokerClosed):
+			return err
+		case err != nil:
+			c.logger.Warn("could not fetch event", zap.Any("error", err))
+			if !sleep(ctx, c.config.Backoff) {
+				return nil
+			}
+			continue
+		}
+		if h, ok := c.handlers[msg.Event.Type]; ok {
+			c.dispatch(ctx, msg, h)
+		}
+		if ctx.Err() != nil {
+			// left uncommitted so it is handled again after a restart
+			return nil
+		}
+		if err := c.source.Commit(msg); err != nil {
+			c.logger.Warn("could not commit event", zap.String("id", msg.Event.ID), zap.Any("error", err))
+		}
+	}
+}
+
+func (c *Consumer) dispatch(ctx context.Context, msg Message, h Handler) {
+	var err error
+	for try := 0; try <= c.config.Retries; try++ {
+		if try > 0 && !sleep(ctx, c.config.Backoff*time.Duration(1<<(try-1))) {
+			return
+		}
+		if err = h(ctx, msg.Event); err == nil {
+			return
+		}
+		c.logger.Debug("event handler failed", zap.String("type", msg.Event.Type), zap.Int("try", try+1), zap.Any("error", err))
+		// a version we cannot read will not become readable on a retry
+		if errors.Is(err, ErrUnsupportedVersion) {
+			break
+		}
+	}
+	if errors.Is(err, ErrUnsupportedVersion) || c.config.DeadLetters == nil {
+		c.logger.Warn("dropping event", zap.String("type", msg.Event.Type), zap.String("id", msg.Event.ID), zap.Any("error", err))
+		return
+	}
+	if err := c.config.DeadLetters.Publish(ctx, msg.Topic+deadLetterSuffix, msg.Event); err != nil {
+		c.logger.Warn("could not dead letter event", zap.String("id", msg.Event.ID), zap.Any("error", err))
+	}
+}
+
+// sleep waits for d and reports false when ctx ended first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
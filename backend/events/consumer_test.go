@@ -0,0 +1,136 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// recorder is a Publisher that keeps what it is given.
+type recorder struct {
+	mu     sync.Mutex
+	topics []string
+	events []Event
+}
+
+func (r *recorder) Publish(ctx context.Context, topic string, ev Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.topics = append(r.topics, topic)
+	r.events = append(r.events, ev)
+	return nil
+}
+
+func (r *recorder) Close() error {
+	return nil
+}
+
+func TestConsumer(t *testing.T) {
+	errFailed := errors.New("handler failed")
+	tests := []struct {
+		name string
+		// fails is how many times the handler fails before it succeeds,
+		// err what it fails with
+		fails       int
+		err         error
+		retries     int
+		deadLetters bool
+		wantTries   int
+		wantDead    bool
+	}{
+		{name: "first try", retries: 2, deadLetters: true, wantTries: 1},
+		{name: "succeeds on a retry", fails: 2, err: errFailed, retries: 2, deadLetters: true, wantTries: 3},
+		{name: "dead lettered once retries run out", fails: 5, err: errFailed, retries: 2, deadLetters: true, wantTries: 3, wantDead: true},
+		{name: "dropped without dead letters", fails: 5, err: errFailed, retries: 1, wantTries: 2},
+		{name: "unsupported version is neither retried nor dead lettered", fails: 5, err: ErrUnsupportedVersion, retries: 2, deadLetters: true, wantTries: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemoryBroker(zap.NewNop(), 0)
+			src, _ := b.Subscribe("test", TopicUsers)
+			dead := &recorder{}
+			config := ConsumerConfig{Retries: tt.retries, Backoff: time.Millisecond}
+			if tt.deadLetters {
+				config.DeadLetters = dead
+			}
+			c := NewConsumer(zap.NewNop(), src, config)
+
+			var (
+				mu    sync.Mutex
+				tries []time.Time
+			)
+			c.Handle(TypeUserRegistered, func(ctx context.Context, ev Event) error {
+				mu.Lock()
+				defer mu.Unlock()
+				tries = append(tries, time.Now())
+				if len(tries) <= tt.fails {
+					return tt.err
+				}
+				return nil
+			})
+
+			ev, _ := New(TypeUserRegistered, "ada", UserRegistered{Username: "ada"})
+			b.Publish(context.Background(), TopicUsers, ev)
+			// an event without a handler is skipped
+			other, _ := New(TypePostCreated, "", PostCreated{})
+			b.Publish(context.Background(), TopicUsers, other)
+			b.Close()
+
+			if err := c.Run(context.Background()); !errors.Is(err, ErrBrokerClosed) {
+				t.Fatalf("run ended with %v, want ErrBrokerClosed", err)
+			}
+			if len(tries) != tt.wantTries {
+				t.Errorf("handler tried %d times, want %d", len(tries), tt.wantTries)
+			}
+			// every wait is at least double the one before
+			for i := 2; i < len(tries); i++ {
+				if tries[i].Sub(tries[i-1]) < 2*time.Millisecond {
+					t.Errorf("retry %d came %v after the one before, want at least 2ms", i, tries[i].Sub(tries[i-1]))
+				}
+			}
+			switch {
+			case tt.wantDead && (len(dead.events) != 1 || dead.topics[0] != TopicUsers+".dlq" || dead.events[0].ID != ev.ID):
+				t.Errorf("dead letters %v on %v, want event %s on %s.dlq", dead.events, dead.topics, ev.ID, TopicUsers)
+			case !tt.wantDead && len(dead.events) != 0:
+				t.Errorf("dead lettered %v", dead.events)
+			}
+		})
+	}
+}
+
+func TestConsumerStopsWithContext(t *testing.T) {
+	b := NewMemoryBroker(zap.NewNop(), 0)
+	defer b.Close()
+	src, _ := b.Subscribe("test", TopicUsers)
+	c := NewConsumer(zap.NewNop(), src, ConsumerConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run ended with %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("consumer did not stop")
+	}
+}
+
+func TestUserRegisteredHasNoContactDetails(t *testing.T) {
+	ev, err := New(TypeUserRegistered, "ada", UserRegistered{Username: "ada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload map[string]any
+	if err := ev.Decode(&payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) != 1 || payload["username"] != "ada" {
+		t.Errorf("payload %v, want the username only", payload)
+	}
+}
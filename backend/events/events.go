@@ -0,0 +1,216 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jim-nnamdi/coldfinance/helper"
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+// event types, each with the topic it goes to and the version of its
+// payload. a payload change that old consumers cannot read gets a new
+// version, never a new meaning for an old one.
+const (
+	TypeQuoteFetched   = "quote.fetched"
+	TypeConversion     = "conversion.completed"
+	TypeUserRegistered = "user.registered"
+	TypePostCreated    = "post.created"
+)
+
+const (
+	TopicQuotes      = "coldfinance.quotes"
+	TopicConversions = "coldfinance.conversions"
+	TopicUsers       = "coldfinance.users"
+	TopicPosts       = "coldfinance.posts"
+)
+
+var catalog = map[string]struct {
+	topic   string
+	version int
+}{
+	TypeQuoteFetched:   {TopicQuotes, 1},
+	TypeConversion:     {TopicConversions, 1},
+	TypeUserRegistered: {TopicUsers, 1},
+	TypePostCreated:    {TopicPosts, 1},
+}
+
+var (
+	ErrUnknownType        = errors.New("unknown event type")
+	ErrUnsupportedVersion = errors.New("unsupported event version")
+	ErrUnknownBroker      = errors.New("unknown event broker")
+)
+
+// Event is the envelope every message travels in. Key groups the
+// events that must stay in order, such as the quotes of one symbol.
+type Event struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Version int             `json:"version"`
+	Time    time.Time       `json:"time"`
+	Key     string          `json:"key,omitempty"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// New wraps data in an event of type typ at its current version.
+func New(typ string, key string, data any) (Event, error) {
+	entry, ok := catalog[typ]
+	if !ok {
+		return Event{}, fmt.Errorf("%w: %s", ErrUnknownType, typ)
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{ID: newID(), Type: typ, Version: entry.version, Time: time.Now().UTC(), Key: key, Data: b}, nil
+}
+
+// Decode reads the payload into v.
+func (e Event) Decode(v any) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// TopicOf is the topic events of type typ are published on.
+func TopicOf(typ string) string {
+	return catalog[typ].topic
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// payloads, version 1
+
+// QuoteFetched is a latest stock quote served to a client. Kind is
+// "eod" or "intraday" and Date the vendor timestamp of the bar.
+type QuoteFetched struct {
+	Kind     string  `json:"kind"`
+	Symbol   string  `json:"symbol"`
+	Exchange string  `json:"exchange"`
+	Price    float64 `json:"price"`
+	Date     string  `json:"date"`
+	Source   string  `json:"source,omitempty"`
+}
+
+type ConversionCompleted struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount string `json:"amount"`
+	Result string `json:"result"`
+	Rate   string `json:"rate"`
+	Target string `json:"target"`
+	Source string `json:"source,omitempty"`
+}
+
+// UserRegistered names the new user only. contact details stay out of
+// the topics, which every consumer can read and keep.
+type UserRegistered struct {
+	Username string `json:"username"`
+}
+
+type PostCreated struct {
+	Title    string `json:"title"`
+	Slug     string `json:"slug"`
+	Author   string `json:"author"`
+	Category string `json:"category"`
+}
+
+// Message is an event together with the topic it came from.
+type Message struct {
+	Topic string
+	Event Event
+
+	// what the source needs to commit the message
+	raw any
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, topic string, ev Event) error
+	Close() error
+}
+
+// Source hands out the messages of a consumer group one at a time.
+// Commit marks a message done so the group does not see it again.
+type Source interface {
+	Fetch(ctx context.Context) (Message, error)
+	Commit(msg Message) error
+	Close() error
+}
+
+// Broker is where events are published and consumed from.
+type Broker interface {
+	Publisher
+	Subscribe(group string, topics ...string) (Source, error)
+}
+
+// NewBroker builds the broker named by EVENTS_BROKER: "memory", the
+// default, keeps events inside the process, "kafka" publishes to the
+// cluster set up in EVENTS_KAFKA_CONFIG (gettingstarted.properties by
+// default) and "none" drops them.
+func NewBroker(logger *zap.Logger) (Broker, error) {
+	_ = godotenv.Load()
+	switch name := strings.TrimSpace(os.Getenv("EVENTS_BROKER")); name {
+	case "", "memory":
+		return NewMemoryBroker(logger, 0), nil
+	case "kafka":
+		path := os.Getenv("EVENTS_KAFKA_CONFIG")
+		if path == "" {
+			path = "gettingstarted.properties"
+		}
+		config := helper.ReadConfig(path)
+		if config == nil {
+			return nil, fmt.Errorf("could not read kafka config from %s", path)
+		}
+		return NewKafkaBroker(logger, config)
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBroker, name)
+	}
+}
+
+var (
+	mu        sync.RWMutex
+	publisher Publisher
+	logger    = zap.NewNop()
+)
+
+// SetPublisher sets where Emit sends events. until it is called, or
+// with a nil publisher, events are dropped.
+func SetPublisher(l *zap.Logger, p Publisher) {
+	mu.Lock()
+	defer mu.Unlock()
+	logger = l
+	publisher = p
+}
+
+// Emit publishes an event of type typ on its topic. events are a side
+// effect of the work that caused them, so failures are logged and
+// never handed back.
+func Emit(ctx context.Context, typ string, key string, data any) {
+	mu.RLock()
+	p, l := publisher, logger
+	mu.RUnlock()
+	if p == nil {
+		return
+	}
+	ev, err := New(typ, key, data)
+	if err != nil {
+		l.Warn("could not build event", zap.String("type", typ), zap.Any("error", err))
+		return
+	}
+	if err := p.Publish(ctx, TopicOf(typ), ev); err != nil {
+		l.Warn("could not publish event", zap.String("type", typ), zap.Any("error", err))
+	}
+}
@@ -0,0 +1,163 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"go.uber.org/zap"
+)
+
+const (
+	// how long Close waits for queued events to be delivered
+	kafkaFlushTimeout = 5 * time.Second
+	// how long a source polls before it looks at its context again
+	kafkaPollInterval = 500 * time.Millisecond
+)
+
+var _ Broker = &KafkaBroker{}
+
+// KafkaBroker publishes events as json to kafka, keyed by Event.Key
+// and with the type and version in the headers so consumers can skip
+// what they do not read without decoding it.
+type KafkaBroker struct {
+	logger   *zap.Logger
+	config   kafka.ConfigMap
+	producer *kafka.Producer
+}
+
+// NewKafkaBroker connects a producer with config, as read by
+// helper.ReadConfig.
+func NewKafkaBroker(logger *zap.Logger, config kafka.ConfigMap) (*KafkaBroker, error) {
+	producer, err := kafka.NewProducer(copyConfig(config))
+	if err != nil {
+		return nil, err
+	}
+	b := &KafkaBroker{
+		logger:   logger,
+		config:   config,
+		producer: producer,
+	}
+	go b.deliveries()
+	return b, nil
+}
+
+func copyConfig(config kafka.ConfigMap) *kafka.ConfigMap {
+	c := kafka.ConfigMap{}
+	for k, v := range config {
+		c[k] = v
+	}
+	return &c
+}
+
+// deliveries logs the events kafka could not take. delivery is
+// asynchronous, so this is the only place such failures show up.
+func (b *KafkaBroker) deliveries() {
+	for e := range b.producer.Events() {
+		switch ev := e.(type) {
+		case *kafka.Message:
+			if ev.TopicPartition.Error != nil {
+				b.logger.Warn("event not delivered", zap.Stringp("topic", ev.TopicPartition.Topic), zap.Any("error", ev.TopicPartition.Error))
+			}
+		case kafka.Error:
+			b.logger.Warn("kafka error", zap.Any("error", ev))
+		}
+	}
+}
+
+// Publish queues ev for delivery and returns without waiting for it.
+func (b *KafkaBroker) Publish(ctx context.Context, topic string, ev Event) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	value, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return b.producer.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Key:            []byte(ev.Key),
+		Value:          value,
+		Headers: []kafka.Header{
+			{Key: "type", Value: []byte(ev.Type)},
+			{Key: "version", Value: []byte(fmt.Sprint(ev.Version))},
+		},
+	}, nil)
+}
+
+// Subscribe starts a consumer in group that commits only what Commit
+// is called for, reading from the oldest uncommitted event.
+func (b *KafkaBroker) Subscribe(group string, topics ...string) (Source, error) {
+	config := copyConfig(b.config)
+	// producer only settings make the consumer complain
+	delete(*config, "acks")
+	config.SetKey("group.id", group)
+	config.SetKey("enable.auto.commit", false)
+	config.SetKey("auto.offset.reset", "earliest")
+	consumer, err := kafka.NewConsumer(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := consumer.SubscribeTopics(topics, nil); err != nil {
+		consumer.Close()
+		return nil, err
+	}
+	return &kafkaSource{logger: b.logger, consumer: consumer}, nil
+}
+
+// Close delivers what is still queued, waiting up to
+// kafkaFlushTimeout, and shuts the producer.
+func (b *KafkaBroker) Close() error {
+	left := b.producer.Flush(int(kafkaFlushTimeout / time.Millisecond))
+	b.producer.Close()
+	if left > 0 {
+		return fmt.Errorf("%d events were not delivered", left)
+	}
+	return nil
+}
+
+type kafkaSource struct {
+	logger   *zap.Logger
+	consumer *kafka.Consumer
+}
+
+func (s *kafkaSource) Fetch(ctx context.Context) (Message, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return Message{}, err
+		}
+		m, err := s.consumer.ReadMessage(kafkaPollInterval)
+		if err != nil {
+			var kerr kafka.Error
+			if errors.As(err, &kerr) && kerr.Code() == kafka.ErrTimedOut {
+				continue
+			}
+			return Message{}, err
+		}
+		var ev Event
+		if err := json.Unmarshal(m.Value, &ev); err != nil {
+			// a message that is not an event would block the partition
+			// forever, so it is committed and skipped
+			s.logger.Warn("skipping malformed event", zap.Stringp("topic", m.TopicPartition.Topic), zap.Any("error", err))
+			s.consumer.CommitMessage(m)
+			continue
+		}
+		return Message{Topic: *m.TopicPartition.Topic, Event: ev, raw: m}, nil
+	}
+}
+
+func (s *kafkaSource) Commit(msg Message) error {
+	m, ok := msg.raw.(*kafka.Message)
+	if !ok {
+		return nil
+	}
+	_, err := s.consumer.CommitMessage(m)
+	return err
+}
+
+func (s *kafkaSource) Close() error {
+	return s.consumer.Close()
+}
@@ -0,0 +1,132 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// events a memory group holds before the broker starts dropping
+const defaultMemoryBuffer = 1024
+
+var (
+	ErrBrokerFull   = errors.New("event buffer full")
+	ErrBrokerClosed = errors.New("event broker closed")
+)
+
+var _ Broker = &MemoryBroker{}
+
+// MemoryBroker stands in for kafka inside one process, in tests and
+// when no cluster is set up. every group gets each event of its topics
+// once, shared out between the sources of the group. nothing is kept:
+// a group only sees what is published after it subscribed, and a
+// group that falls a whole buffer behind misses events.
+type MemoryBroker struct {
+	logger *zap.Logger
+	buffer int
+
+	mu     sync.RWMutex
+	groups map[string]*memoryGroup
+	closed bool
+}
+
+type memoryGroup struct {
+	topics map[string]bool
+	ch     chan Message
+}
+
+// NewMemoryBroker buffers up to buffer events per group, or
+// defaultMemoryBuffer when buffer is zero.
+func NewMemoryBroker(logger *zap.Logger, buffer int) *MemoryBroker {
+	if buffer <= 0 {
+		buffer = defaultMemoryBuffer
+	}
+	return &MemoryBroker{
+		logger: logger,
+		buffer: buffer,
+		groups: map[string]*memoryGroup{},
+	}
+}
+
+// Publish never blocks: a group with a full buffer misses the event
+// and ErrBrokerFull is returned once all groups were tried.
+func (b *MemoryBroker) Publish(ctx context.Context, topic string, ev Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	var err error
+	for name, g := range b.groups {
+		if !g.topics[topic] {
+			continue
+		}
+		select {
+		case g.ch <- Message{Topic: topic, Event: ev}:
+		default:
+			b.logger.Warn("event group is full, dropping event", zap.String("group", name), zap.String("type", ev.Type))
+			err = ErrBrokerFull
+		}
+	}
+	return err
+}
+
+// Subscribe joins group, adding topics to what the group reads.
+func (b *MemoryBroker) Subscribe(group string, topics ...string) (Source, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+	g, ok := b.groups[group]
+	if !ok {
+		g = &memoryGroup{topics: map[string]bool{}, ch: make(chan Message, b.buffer)}
+		b.groups[group] = g
+	}
+	for _, t := range topics {
+		g.topics[t] = true
+	}
+	return &memorySource{ch: g.ch}, nil
+}
+
+// Close ends every group; sources return ErrBrokerClosed once they
+// have read what was left.
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for _, g := range b.groups {
+		close(g.ch)
+	}
+	return nil
+}
+
+type memorySource struct {
+	ch chan Message
+}
+
+func (s *memorySource) Fetch(ctx context.Context) (Message, error) {
+	select {
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	case msg, ok := <-s.ch:
+		if !ok {
+			return Message{}, ErrBrokerClosed
+		}
+		return msg, nil
+	}
+}
+
+// Commit has nothing to do, a message is gone once it was fetched.
+func (s *memorySource) Commit(msg Message) error {
+	return nil
+}
+
+func (s *memorySource) Close() error {
+	return nil
+}
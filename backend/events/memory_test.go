@@ -0,0 +1,100 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func fetchTypes(t *testing.T, src Source, n int) []string {
+	t.Helper()
+	types := make([]string, 0, n)
+	for len(types) < n {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		msg, err := src.Fetch(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("fetch %d: %v", len(types), err)
+		}
+		types = append(types, msg.Event.Type)
+	}
+	return types
+}
+
+// nothingLeft checks src has no message waiting.
+func nothingLeft(t *testing.T, src Source) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if msg, err := src.Fetch(ctx); err == nil {
+		t.Errorf("unexpected %s event", msg.Event.Type)
+	}
+}
+
+func TestMemoryBrokerFansOutPerGroup(t *testing.T) {
+	b := NewMemoryBroker(zap.NewNop(), 0)
+	defer b.Close()
+	quotes, _ := b.Subscribe("quotes", TopicQuotes)
+	both, _ := b.Subscribe("both", TopicQuotes, TopicUsers)
+	// a second source of the same group shares its events
+	bothAgain, _ := b.Subscribe("both")
+
+	for _, typ := range []string{TypeQuoteFetched, TypeUserRegistered, TypeQuoteFetched} {
+		ev, err := New(typ, "", struct{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Publish(context.Background(), TopicOf(typ), ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := fetchTypes(t, quotes, 2); got[0] != TypeQuoteFetched || got[1] != TypeQuoteFetched {
+		t.Errorf("quotes group got %v", got)
+	}
+	nothingLeft(t, quotes)
+
+	got := append(fetchTypes(t, both, 2), fetchTypes(t, bothAgain, 1)...)
+	want := []string{TypeQuoteFetched, TypeUserRegistered, TypeQuoteFetched}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("both group got %v, want %v in order", got, want)
+			break
+		}
+	}
+	nothingLeft(t, both)
+	nothingLeft(t, bothAgain)
+}
+
+func TestMemoryBrokerFullAndClosed(t *testing.T) {
+	b := NewMemoryBroker(zap.NewNop(), 1)
+	src, _ := b.Subscribe("g", TopicPosts)
+	ev, _ := New(TypePostCreated, "", struct{}{})
+
+	if err := b.Publish(context.Background(), TopicPosts, ev); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish(context.Background(), TopicPosts, ev); !errors.Is(err, ErrBrokerFull) {
+		t.Errorf("publish into a full group: got %v, want ErrBrokerFull", err)
+	}
+	// no group reads this topic, so nothing can be full
+	if err := b.Publish(context.Background(), TopicUsers, ev); err != nil {
+		t.Errorf("publish to an unread topic: %v", err)
+	}
+
+	b.Close()
+	if err := b.Publish(context.Background(), TopicPosts, ev); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("publish after close: got %v, want ErrBrokerClosed", err)
+	}
+	if _, err := b.Subscribe("late", TopicPosts); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("subscribe after close: got %v, want ErrBrokerClosed", err)
+	}
+	// what was buffered is still read before the source reports closed
+	fetchTypes(t, src, 1)
+	if _, err := src.Fetch(context.Background()); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("fetch after close: got %v, want ErrBrokerClosed", err)
+	}
+}
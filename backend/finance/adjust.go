@@ -0,0 +1,119 @@
+package finance
+
+import (
+	"sort"
+)
+
+// AdjustedSeries is an EOD series corrected for corporate actions
+// by us rather than relying on the vendor's adj_* fields.
+type AdjustedSeries struct {
+	Symbol     string          `json:"symbol"`
+	Pagination StockPagination `json:"pagination"`
+	Bars       []AdjustedBar   `json:"bars"`
+	Source     string          `json:"source,omitempty"`
+}
+
+// AdjustedBar holds back-adjusted prices, comparable with the most
+// recent bar, and TotalReturn, the value of 1 unit invested at the
+// first bar with dividends reinvested.
+type AdjustedBar struct {
+	Date        string  `json:"date"`
+	Open        float64 `json:"open"`
+	High        float64 `json:"high"`
+	Low         float64 `json:"low"`
+	Close       float64 `json:"close"`
+	Volume      float64 `json:"volume"`
+	RawClose    float64 `json:"raw_close"`
+	SplitFactor float64 `json:"split_factor,omitempty"`
+	Dividend    float64 `json:"dividend,omitempty"`
+	TotalReturn float64 `json:"total_return"`
+}
+
+// AdjustEOD back-adjusts bars for splits and cash dividends. a split
+// of factor f divides every earlier price by f and multiplies earlier
+// volume by f. a dividend d divides every earlier price by
+// close/(close-d), close being the last close before the ex-date in
+// shares after any split on that date.
+// events falling on a non trading day apply from the next bar, and
+// events after the last bar adjust the whole series. bars come back
+// oldest first.
+func AdjustEOD(bars []EOD, splits []StockSplit, dividends []StockDividend) []AdjustedBar {
+	sorted := append([]EOD(nil), bars...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Date < sorted[j].Date })
+	n := len(sorted)
+	if n == 0 {
+		return []AdjustedBar{}
+	}
+
+	// index of the first bar on or after each event day, n when the
+	// event is newer than every bar
+	barAt := func(date string) int {
+		day := eodDay(date)
+		return sort.Search(n, func(i int) bool { return eodDay(sorted[i].Date) >= day })
+	}
+	splitAt := make([]float64, n+1)
+	divAt := make([]float64, n+1)
+	for i := range splitAt {
+		splitAt[i] = 1
+	}
+	for _, s := range splits {
+		if s.SplitFactor <= 0 {
+			continue
+		}
+		if i := barAt(s.Date); i > 0 {
+			splitAt[i] *= s.SplitFactor
+		}
+	}
+	for _, d := range dividends {
+		if d.Dividend <= 0 {
+			continue
+		}
+		if i := barAt(d.Date); i > 0 {
+			divAt[i] += d.Dividend
+		}
+	}
+
+	adjusted := make([]AdjustedBar, n)
+	priceFactor, volumeFactor := 1.0, 1.0
+	for i := n; i >= 1; i-- {
+		// events on bar i only affect the bars before it
+		priceFactor /= splitAt[i]
+		volumeFactor *= splitAt[i]
+		// the dividend is paid per share after a split on the same day,
+		// so compare it with the previous close in those shares
+		if prev := sorted[i-1].Close / splitAt[i]; divAt[i] > 0 && prev > divAt[i] {
+			priceFactor *= (prev - divAt[i]) / prev
+		}
+
+		bar := sorted[i-1]
+		adjusted[i-1] = AdjustedBar{
+			Date:     bar.Date,
+			Open:     bar.Open * priceFactor,
+			High:     bar.High * priceFactor,
+			Low:      bar.Low * priceFactor,
+			Close:    bar.Close * priceFactor,
+			Volume:   bar.Volume * volumeFactor,
+			RawClose: bar.Close,
+		}
+	}
+
+	// total return from raw prices: split shares and reinvest the cash
+	for i := range adjusted {
+		if splitAt[i] != 1 {
+			adjusted[i].SplitFactor = splitAt[i]
+		}
+		adjusted[i].Dividend = divAt[i]
+		if i == 0 {
+			adjusted[i].TotalReturn = 1
+			continue
+		}
+		prev := sorted[i-1].Close
+		if prev == 0 {
+			adjusted[i].TotalReturn = adjusted[i-1].TotalReturn
+			continue
+		}
+		growth := (sorted[i].Close + divAt[i]) * splitAt[i] / prev
+		adjusted[i].TotalReturn = adjusted[i-1].TotalReturn * growth
+	}
+	return adjusted
+}
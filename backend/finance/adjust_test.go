@@ -0,0 +1,80 @@
+package finance
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAdjustEOD(t *testing.T) {
+	bars := func(closes ...float64) []EOD {
+		out := make([]EOD, len(closes))
+		for i, c := range closes {
+			out[i] = EOD{Date: addDays("2024-01-01", i) + "T00:00:00+0000", Open: c, High: c, Low: c, Close: c, Volume: 10}
+		}
+		return out
+	}
+	tests := []struct {
+		name        string
+		bars        []EOD
+		splits      []StockSplit
+		dividends   []StockDividend
+		closes      []float64
+		volumes     []float64
+		totalReturn []float64
+	}{
+		{
+			name:        "no events",
+			bars:        bars(10, 11, 12),
+			closes:      []float64{10, 11, 12},
+			volumes:     []float64{10, 10, 10},
+			totalReturn: []float64{1, 1.1, 1.2},
+		},
+		{
+			name:        "split halves earlier prices and doubles earlier volume",
+			bars:        bars(100, 50, 55),
+			splits:      []StockSplit{{Date: "2024-01-02", SplitFactor: 2}},
+			closes:      []float64{50, 50, 55},
+			volumes:     []float64{20, 10, 10},
+			totalReturn: []float64{1, 1, 1.1},
+		},
+		{
+			name:        "dividend scales earlier prices by the ex-date drop",
+			bars:        bars(100, 98, 99),
+			dividends:   []StockDividend{{Date: "2024-01-02", Dividend: 2}},
+			closes:      []float64{98, 98, 99},
+			volumes:     []float64{10, 10, 10},
+			totalReturn: []float64{1, 1, 99.0 / 98},
+		},
+		{
+			name:        "split and dividend on the same day",
+			bars:        bars(100, 50),
+			splits:      []StockSplit{{Date: "2024-01-02", SplitFactor: 2}},
+			dividends:   []StockDividend{{Date: "2024-01-02", Dividend: 1}},
+			closes:      []float64{49, 50},
+			volumes:     []float64{20, 10},
+			totalReturn: []float64{1, 1.02},
+		},
+		{
+			name:        "event on a non trading day applies from the next bar",
+			bars:        []EOD{{Date: "2024-01-01", Close: 100}, {Date: "2024-01-04", Close: 50}},
+			splits:      []StockSplit{{Date: "2024-01-03", SplitFactor: 2}},
+			closes:      []float64{50, 50},
+			volumes:     []float64{0, 0},
+			totalReturn: []float64{1, 1},
+		},
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := AdjustEOD(tt.bars, tt.splits, tt.dividends)
+			if len(got) != len(tt.closes) {
+				t.Fatalf("got %d bars, want %d", len(got), len(tt.closes))
+			}
+			for i, bar := range got {
+				if !near(bar.Close, tt.closes[i]) || !near(bar.Volume, tt.volumes[i]) || !near(bar.TotalReturn, tt.totalReturn[i]) {
+					t.Errorf("bar %d: close %v volume %v total return %v, want %v %v %v", i, bar.Close, bar.Volume, bar.TotalReturn, tt.closes[i], tt.volumes[i], tt.totalReturn[i])
+				}
+			}
+		})
+	}
+}
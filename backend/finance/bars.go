@@ -0,0 +1,79 @@
+package finance
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Bar is a typed OHLCV candle, the common shape the number
+// crunching code works on whatever series it came from.
+type Bar struct {
+	Time   time.Time `json:"time"`
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume float64   `json:"volume"`
+}
+
+// EODBars converts EOD bars to candles, oldest first. bars with
+// a date we cannot read are dropped.
+func EODBars(eod []EOD) []Bar {
+	bars := make([]Bar, 0, len(eod))
+	for _, e := range eod {
+		at, err := time.Parse(dateLayout, eodDay(e.Date))
+		if err != nil {
+			continue
+		}
+		bars = append(bars, Bar{
+			Time:   at,
+			Open:   e.Open,
+			High:   e.High,
+			Low:    e.Low,
+			Close:  e.Close,
+			Volume: e.Volume,
+		})
+	}
+	sort.Slice(bars, func(i, j int) bool { return bars[i].Time.Before(bars[j].Time) })
+	return bars
+}
+
+// IntradayBars converts validated intraday bars to candles, oldest
+// first. a missing open, high or low falls back to the bar price and
+// a missing volume counts as zero.
+func IntradayBars(intraday []IntradayBar) ([]Bar, error) {
+	bars := make([]Bar, 0, len(intraday))
+	for i, in := range intraday {
+		if err := in.Validate(); err != nil {
+			return nil, fmt.Errorf("intraday bar %d: %w", i, err)
+		}
+		at, _ := in.Time()
+		price := in.Price().Float64
+		orPrice := func(n Number) float64 {
+			if n.Valid {
+				return n.Float64
+			}
+			return price
+		}
+		bars = append(bars, Bar{
+			Time:   at,
+			Open:   orPrice(in.Open),
+			High:   orPrice(in.High),
+			Low:    orPrice(in.Low),
+			Close:  price,
+			Volume: in.Volume.Float64,
+		})
+	}
+	sort.Slice(bars, func(i, j int) bool { return bars[i].Time.Before(bars[j].Time) })
+	return bars, nil
+}
+
+// Closes picks the close of every bar.
+func Closes(bars []Bar) []float64 {
+	closes := make([]float64, len(bars))
+	for i, b := range bars {
+		closes[i] = b.Close
+	}
+	return closes
+}
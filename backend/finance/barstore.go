@@ -0,0 +1,263 @@
+package finance
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// BarStore keeps EOD and intraday bars locally so repeated
+// ranges do not cost another upstream call. bars are kept by symbol,
+// which is upper-cased on the way in and out, and time; the exchange
+// is stored with them but not part of the key, as queries do not name
+// one.
+type BarStore interface {
+	EODBars(ctx context.Context, symbol string, from string, to string) ([]EOD, error)
+	SaveEOD(ctx context.Context, bars []EOD) error
+	EODCoverage(ctx context.Context, symbol string) ([]DateRange, error)
+	AddEODCoverage(ctx context.Context, symbol string, covered DateRange) error
+	IntradayBars(ctx context.Context, symbol string, from time.Time, to time.Time) ([]IntradayBar, error)
+	SaveIntraday(ctx context.Context, bars []IntradayBar) error
+	IntradayCoverage(ctx context.Context, symbol string) ([]DateRange, error)
+	AddIntradayCoverage(ctx context.Context, symbol string, covered DateRange) error
+}
+
+var _ BarStore = &sqlBarStore{}
+
+// DateRange is an inclusive range of YYYY-MM-DD days.
+type DateRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+const (
+	// layout marketstack uses for bar timestamps
+	vendorTimeLayout = "2006-01-02T15:04:05-0700"
+	sqlTimeLayout    = "2006-01-02 15:04:05"
+)
+
+type sqlBarStore struct {
+	logger *zap.Logger
+	db     *sql.DB
+}
+
+func NewBarStore(logger *zap.Logger, db *sql.DB) *sqlBarStore {
+	return &sqlBarStore{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (s *sqlBarStore) EODBars(ctx context.Context, symbol string, from string, to string) ([]EOD, error) {
+	symbol = storedSymbol(symbol)
+	rows, err := s.db.QueryContext(ctx, "select symbol, exchange, date, open, high, low, close, volume, adj_open, adj_high, adj_low, adj_close, adj_volume, split_factor, dividend from eod_bars where symbol = ? and date between ? and ? order by date", symbol, from, to)
+	if err != nil {
+		s.logger.Debug("could not fetch eod bars", zap.Any("error", err))
+		return nil, err
+	}
+	defer rows.Close()
+	bars := make([]EOD, 0)
+	for rows.Next() {
+		bar := EOD{}
+		if err := rows.Scan(
+			&bar.Symbol,
+			&bar.Exchange,
+			&bar.Date,
+			&bar.Open,
+			&bar.High,
+			&bar.Low,
+			&bar.Close,
+			&bar.Volume,
+			&bar.AdjOpen,
+			&bar.AdjHigh,
+			&bar.AdjLow,
+			&bar.AdjClose,
+			&bar.AdjVolume,
+			&bar.SplitFactor,
+			&bar.Dividend,
+		); err != nil {
+			s.logger.Debug("could not scan eod bar", zap.Any("error", err))
+			return nil, err
+		}
+		// keep the vendor shape so stored and fetched bars look alike
+		bar.Date = eodDay(bar.Date) + "T00:00:00+0000"
+		bars = append(bars, bar)
+	}
+	return bars, rows.Err()
+}
+
+func (s *sqlBarStore) SaveEOD(ctx context.Context, bars []EOD) error {
+	if len(bars) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Debug("could not start transaction", zap.Any("error", err))
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, "insert into eod_bars(symbol, exchange, date, open, high, low, close, volume, adj_open, adj_high, adj_low, adj_close, adj_volume, split_factor, dividend) values(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?) on duplicate key update exchange=values(exchange), open=values(open), high=values(high), low=values(low), close=values(close), volume=values(volume), adj_open=values(adj_open), adj_high=values(adj_high), adj_low=values(adj_low), adj_close=values(adj_close), adj_volume=values(adj_volume), split_factor=values(split_factor), dividend=values(dividend)")
+	if err != nil {
+		tx.Rollback()
+		s.logger.Debug("could not prepare eod insert", zap.Any("error", err))
+		return err
+	}
+	defer stmt.Close()
+	for _, bar := range bars {
+		if _, err := stmt.ExecContext(ctx, storedSymbol(bar.Symbol), bar.Exchange, eodDay(bar.Date), bar.Open, bar.High, bar.Low, bar.Close, bar.Volume, bar.AdjOpen, bar.AdjHigh, bar.AdjLow, bar.AdjClose, bar.AdjVolume, bar.SplitFactor, bar.Dividend); err != nil {
+			tx.Rollback()
+			s.logger.Debug("could not save eod bar", zap.Any("error", err))
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlBarStore) EODCoverage(ctx context.Context, symbol string) ([]DateRange, error) {
+	return s.coverage(ctx, "eod_coverage", symbol)
+}
+
+func (s *sqlBarStore) AddEODCoverage(ctx context.Context, symbol string, covered DateRange) error {
+	return s.addCoverage(ctx, "eod_coverage", symbol, covered)
+}
+
+func (s *sqlBarStore) IntradayCoverage(ctx context.Context, symbol string) ([]DateRange, error) {
+	return s.coverage(ctx, "intraday_coverage", symbol)
+}
+
+func (s *sqlBarStore) AddIntradayCoverage(ctx context.Context, symbol string, covered DateRange) error {
+	return s.addCoverage(ctx, "intraday_coverage", symbol, covered)
+}
+
+// coverage lists the day ranges of symbol kept in table, one of the
+// coverage tables.
+func (s *sqlBarStore) coverage(ctx context.Context, table string, symbol string) ([]DateRange, error) {
+	rows, err := s.db.QueryContext(ctx, "select date_from, date_to from "+table+" where symbol = ? order by date_from", storedSymbol(symbol))
+	if err != nil {
+		s.logger.Debug("could not fetch coverage", zap.String("table", table), zap.Any("error", err))
+		return nil, err
+	}
+	defer rows.Close()
+	covered := make([]DateRange, 0)
+	for rows.Next() {
+		r := DateRange{}
+		if err := rows.Scan(&r.From, &r.To); err != nil {
+			s.logger.Debug("could not scan coverage", zap.String("table", table), zap.Any("error", err))
+			return nil, err
+		}
+		covered = append(covered, DateRange{From: eodDay(r.From), To: eodDay(r.To)})
+	}
+	return covered, rows.Err()
+}
+
+func (s *sqlBarStore) addCoverage(ctx context.Context, table string, symbol string, covered DateRange) error {
+	if _, err := s.db.ExecContext(ctx, "insert into "+table+"(symbol, date_from, date_to) values(?,?,?)", storedSymbol(symbol), covered.From, covered.To); err != nil {
+		s.logger.Debug("could not save coverage", zap.String("table", table), zap.Any("error", err))
+		return err
+	}
+	return nil
+}
+
+func (s *sqlBarStore) IntradayBars(ctx context.Context, symbol string, from time.Time, to time.Time) ([]IntradayBar, error) {
+	symbol = storedSymbol(symbol)
+	rows, err := s.db.QueryContext(ctx, "select symbol, exchange, date, open, high, low, last, close, volume from intraday_bars where symbol = ? and date between ? and ? order by date", symbol, from.UTC().Format(sqlTimeLayout), to.UTC().Format(sqlTimeLayout))
+	if err != nil {
+		s.logger.Debug("could not fetch intraday bars", zap.Any("error", err))
+		return nil, err
+	}
+	defer rows.Close()
+	bars := make([]IntradayBar, 0)
+	for rows.Next() {
+		var (
+			bar    = IntradayBar{}
+			stored string
+		)
+		if err := rows.Scan(&bar.Symbol, &bar.Exchange, &stored, &bar.Open, &bar.High, &bar.Low, &bar.Last, &bar.Close, &bar.Volume); err != nil {
+			s.logger.Debug("could not scan intraday bar", zap.Any("error", err))
+			return nil, err
+		}
+		if at, err := time.Parse(sqlTimeLayout, stored); err == nil {
+			bar.Date = at.Format(vendorTimeLayout)
+		}
+		bars = append(bars, bar)
+	}
+	return bars, rows.Err()
+}
+
+func (s *sqlBarStore) SaveIntraday(ctx context.Context, bars []IntradayBar) error {
+	if len(bars) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Debug("could not start transaction", zap.Any("error", err))
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, "insert into intraday_bars(symbol, exchange, date, open, high, low, last, close, volume) values(?,?,?,?,?,?,?,?,?) on duplicate key update exchange=values(exchange), open=values(open), high=values(high), low=values(low), last=values(last), close=values(close), volume=values(volume)")
+	if err != nil {
+		tx.Rollback()
+		s.logger.Debug("could not prepare intraday insert", zap.Any("error", err))
+		return err
+	}
+	defer stmt.Close()
+	for _, bar := range bars {
+		at, err := bar.Time()
+		if err != nil {
+			s.logger.Debug("skipping intraday bar with bad date", zap.String("date", bar.Date))
+			continue
+		}
+		if _, err := stmt.ExecContext(ctx, storedSymbol(bar.Symbol), bar.Exchange, at.UTC().Format(sqlTimeLayout), bar.Open, bar.High, bar.Low, bar.Last, bar.Close, bar.Volume); err != nil {
+			tx.Rollback()
+			s.logger.Debug("could not save intraday bar", zap.Any("error", err))
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// storedSymbol is symbol as bars and coverage are kept under.
+func storedSymbol(symbol string) string {
+	return strings.ToUpper(strings.TrimSpace(symbol))
+}
+
+// missingRanges returns the parts of want that no covered range holds.
+func missingRanges(want DateRange, covered []DateRange) []DateRange {
+	sorted := append([]DateRange(nil), covered...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].From < sorted[j].From })
+
+	gaps := make([]DateRange, 0)
+	cursor := want.From
+	for _, r := range sorted {
+		if cursor > want.To {
+			break
+		}
+		if r.To < cursor {
+			continue
+		}
+		if r.From > cursor {
+			end := addDays(r.From, -1)
+			if end > want.To {
+				end = want.To
+			}
+			gaps = append(gaps, DateRange{From: cursor, To: end})
+		}
+		if next := addDays(r.To, 1); next > cursor {
+			cursor = next
+		}
+	}
+	if cursor <= want.To {
+		gaps = append(gaps, DateRange{From: cursor, To: want.To})
+	}
+	return gaps
+}
+
+func addDays(day string, n int) string {
+	t, err := time.Parse(dateLayout, day)
+	if err != nil {
+		return day
+	}
+	return t.AddDate(0, 0, n).Format(dateLayout)
+}
@@ -0,0 +1,116 @@
+package finance
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultBatchParallelism = 8
+	MaxBatchParallelism     = 32
+	MaxBatchSymbols         = 100
+)
+
+// BatchKinds are the per symbol lookups GetBatch can fan out.
+var BatchKinds = []string{"quote", "intraday_quote", "ticker", "eod", "intraday", "splits", "dividends"}
+
+// SymbolResult is the outcome for one symbol of a batch. exactly one
+// of Data and Error is set.
+type SymbolResult[T any] struct {
+	Symbol string `json:"symbol"`
+	Data   T      `json:"data,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Batch[T any] struct {
+	Results   []SymbolResult[T] `json:"results"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+}
+
+// FanOut calls fetch for every symbol with at most parallelism calls
+// in flight. results keep the order of symbols and a failing symbol
+// only fails its own entry. once ctx is done the symbols not started
+// yet fail with its error.
+func FanOut[T any](ctx context.Context, symbols []string, parallelism int, fetch func(ctx context.Context, symbol string) (T, error)) *Batch[T] {
+	if parallelism <= 0 {
+		parallelism = DefaultBatchParallelism
+	}
+	batch := &Batch[T]{Results: make([]SymbolResult[T], len(symbols))}
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, symbol := range symbols {
+		i, symbol := i, symbol
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+		}
+		if err := ctx.Err(); err != nil {
+			batch.Results[i] = SymbolResult[T]{Symbol: symbol, Error: err.Error()}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			res := SymbolResult[T]{Symbol: symbol}
+			data, err := fetch(ctx, symbol)
+			if err != nil {
+				res.Error = err.Error()
+			} else {
+				res.Data = data
+			}
+			batch.Results[i] = res
+		}()
+	}
+	wg.Wait()
+	for _, res := range batch.Results {
+		if res.Error != "" {
+			batch.Failed++
+		} else {
+			batch.Succeeded++
+		}
+	}
+	return batch
+}
+
+// GetBatch runs one kind of lookup for many symbols at once. quote is
+// the latest EOD bar and intraday_quote the latest intraday bar.
+func (s *stockTickers) GetBatch(ctx context.Context, kind string, symbols []string, parallelism int) (*Batch[any], error) {
+	if len(symbols) == 0 {
+		return nil, fmt.Errorf("%w: no symbols given", ErrInvalidQuery)
+	}
+	if len(symbols) > MaxBatchSymbols {
+		return nil, fmt.Errorf("%w: at most %d symbols per batch", ErrInvalidQuery, MaxBatchSymbols)
+	}
+	if parallelism > MaxBatchParallelism {
+		parallelism = MaxBatchParallelism
+	}
+
+	var fetch func(ctx context.Context, symbol string) (any, error)
+	switch kind {
+	case "", "quote":
+		fetch = func(ctx context.Context, symbol string) (any, error) { return s.GetCompanyEODLatest(ctx, symbol) }
+	case "intraday_quote":
+		fetch = func(ctx context.Context, symbol string) (any, error) { return s.GetCompanyIntradayLatest(ctx, symbol) }
+	case "ticker":
+		fetch = func(ctx context.Context, symbol string) (any, error) { return s.GetCompanyTicker(ctx, symbol) }
+	case "eod":
+		fetch = func(ctx context.Context, symbol string) (any, error) { return s.GetCompanyEOD(ctx, symbol, EODQuery{}) }
+	case "intraday":
+		fetch = func(ctx context.Context, symbol string) (any, error) {
+			return s.GetCompanyIntraday(ctx, symbol, IntradayQuery{})
+		}
+	case "splits":
+		fetch = func(ctx context.Context, symbol string) (any, error) { return s.GetCompanySplits(ctx, symbol) }
+	case "dividends":
+		fetch = func(ctx context.Context, symbol string) (any, error) { return s.GetCompanyDividends(ctx, symbol) }
+	default:
+		return nil, fmt.Errorf("%w: type must be one of %s", ErrInvalidQuery, strings.Join(BatchKinds, ", "))
+	}
+	return FanOut(ctx, symbols, parallelism, fetch), nil
+}
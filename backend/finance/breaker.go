@@ -0,0 +1,90 @@
+package finance
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("upstream circuit open")
+
+// breakers keeps a circuit breaker per host. after threshold failures
+// in a row the host is skipped for cooldown, then a single trial call
+// decides whether it is back.
+type breakers struct {
+	threshold int
+	cooldown  time.Duration
+	// now is the clock cooldowns are measured with
+	now   func() time.Time
+	mu    sync.Mutex
+	hosts map[string]*breaker
+}
+
+type breaker struct {
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+func newBreakers(threshold int, cooldown time.Duration) *breakers {
+	return &breakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		hosts:     map[string]*breaker{},
+	}
+}
+
+func (b *breakers) get(host string) *breaker {
+	br, ok := b.hosts[host]
+	if !ok {
+		br = &breaker{}
+		b.hosts[host] = br
+	}
+	return br
+}
+
+// allow fails with ErrCircuitOpen while host is cut off.
+func (b *breakers) allow(host string) error {
+	if b.threshold <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br := b.get(host)
+	if br.failures < b.threshold {
+		return nil
+	}
+	if b.now().Before(br.openUntil) || br.trial {
+		return fmt.Errorf("%w: %s failed %d times in a row", ErrCircuitOpen, host, br.failures)
+	}
+	br.trial = true
+	return nil
+}
+
+func (b *breakers) success(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br := b.get(host)
+	br.failures = 0
+	br.trial = false
+}
+
+func (b *breakers) failure(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br := b.get(host)
+	br.failures++
+	br.trial = false
+	if br.failures >= b.threshold {
+		br.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// abandon gives up a trial call that was never made.
+func (b *breakers) abandon(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.get(host).trial = false
+}
@@ -0,0 +1,299 @@
+package finance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jim-nnamdi/coldfinance/helper"
+	"go.uber.org/zap"
+)
+
+const cacheKeyPrefix = "coldfinance:upstream:"
+
+// CacheStore keeps cached upstream responses. Get misses once the ttl
+// given to Set has passed.
+type CacheStore interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+}
+
+// NewCacheStore uses redis when helper.SetRedisClient connected and
+// keeps entries in process memory otherwise.
+func NewCacheStore(logger *zap.Logger) CacheStore {
+	if helper.HasRedisClient() {
+		return &redisCache{logger: logger}
+	}
+	logger.Info("redis not available, caching upstream responses in memory")
+	return NewMemoryCache()
+}
+
+type redisCache struct {
+	logger *zap.Logger
+}
+
+func (c *redisCache) Get(key string) ([]byte, bool) {
+	val, err := helper.GetRedisBytes(context.Background(), key)
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			c.logger.Warn("cannot read cache", zap.String("key", key), zap.Any("error", err))
+		}
+		return nil, false
+	}
+	return val, true
+}
+
+func (c *redisCache) Set(key string, value []byte, ttl time.Duration) {
+	if err := helper.SetRedisDataTTL(context.Background(), key, value, ttl); err != nil {
+		c.logger.Warn("cannot write cache", zap.String("key", key), zap.Any("error", err))
+	}
+}
+
+// sweep expired memory entries once the map grows past this
+const memoryCacheSweep = 1024
+
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	sweepAt int
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+func NewMemoryCache() *memoryCache {
+	return &memoryCache{entries: map[string]memoryEntry{}, sweepAt: memoryCacheSweep}
+}
+
+func (c *memoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (c *memoryCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.entries) >= c.sweepAt {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.sweepAt = 2*len(c.entries) + memoryCacheSweep
+	}
+	c.entries[key] = memoryEntry{value: value, expires: now.Add(ttl)}
+}
+
+// CacheRule says how long responses of upstream paths containing Path
+// are fresh, and for how much longer a stale copy may be served while
+// it is fetched again in the background.
+type CacheRule struct {
+	Path  string
+	TTL   time.Duration
+	Stale time.Duration
+}
+
+// DefaultCacheRules covers the marketstack and coinlayer endpoints.
+// the first matching rule wins, so longer paths come first.
+func DefaultCacheRules() []CacheRule {
+	return []CacheRule{
+		{Path: "/live", TTL: time.Minute, Stale: 5 * time.Minute},
+		{Path: "/list", TTL: 24 * time.Hour, Stale: 24 * time.Hour},
+		{Path: "/intraday/latest", TTL: 30 * time.Second, Stale: 2 * time.Minute},
+		{Path: "/intraday", TTL: time.Minute, Stale: 5 * time.Minute},
+		{Path: "/eod/latest", TTL: 5 * time.Minute, Stale: 30 * time.Minute},
+		{Path: "/eod", TTL: time.Hour, Stale: 6 * time.Hour},
+		{Path: "/splits", TTL: 24 * time.Hour, Stale: 24 * time.Hour},
+		{Path: "/dividends", TTL: 24 * time.Hour, Stale: 24 * time.Hour},
+		{Path: "/tickers", TTL: 24 * time.Hour, Stale: 24 * time.Hour},
+	}
+}
+
+var _ RequestClient = &cachedClient{}
+
+// cachedClient is a read-through cache in front of a RequestClient.
+// concurrent misses for the same url share one upstream call and a
+// stale hit is answered at once while a single refresh runs behind it.
+type cachedClient struct {
+	logger *zap.Logger
+	next   RequestClient
+	store  CacheStore
+	rules  []CacheRule
+	flight flight
+}
+
+func NewCachedClient(logger *zap.Logger, next RequestClient, store CacheStore, rules []CacheRule) *cachedClient {
+	return &cachedClient{
+		logger: logger,
+		next:   next,
+		store:  store,
+		rules:  rules,
+		flight: flight{calls: map[string]*flightCall{}},
+	}
+}
+
+type cacheEntry struct {
+	Body    []byte    `json:"body"`
+	Fetched time.Time `json:"fetched"`
+}
+
+func (c *cachedClient) MakeGetRequest(ctx context.Context, method string, rawURL string) ([]byte, error) {
+	rule, ok := c.rule(method, rawURL)
+	if !ok {
+		return c.next.MakeGetRequest(ctx, method, rawURL)
+	}
+	key := cacheKey(rawURL)
+	if raw, ok := c.store.Get(key); ok {
+		var e cacheEntry
+		if err := json.Unmarshal(raw, &e); err == nil {
+			age := time.Since(e.Fetched)
+			if age < rule.TTL {
+				return e.Body, nil
+			}
+			if age < rule.TTL+rule.Stale {
+				go func() {
+					// the caller has its answer, the refresh must not die with it
+					if _, err := c.fetch(context.Background(), key, method, rawURL, rule); err != nil {
+						c.logger.Warn("cannot revalidate cached response", zap.String("key", key), zap.Any("error", err))
+					}
+				}()
+				return e.Body, nil
+			}
+		}
+	}
+	return c.fetch(ctx, key, method, rawURL, rule)
+}
+
+func (c *cachedClient) fetch(ctx context.Context, key string, method string, rawURL string, rule CacheRule) ([]byte, error) {
+	return c.flight.do(ctx, key, func(ctx context.Context) ([]byte, error) {
+		body, err := c.next.MakeGetRequest(ctx, method, rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if cacheable(body) {
+			raw, err := json.Marshal(cacheEntry{Body: body, Fetched: time.Now()})
+			if err == nil {
+				c.store.Set(key, raw, rule.TTL+rule.Stale)
+			}
+		}
+		return body, nil
+	})
+}
+
+func (c *cachedClient) rule(method string, rawURL string) (CacheRule, bool) {
+	if method != http.MethodGet {
+		return CacheRule{}, false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return CacheRule{}, false
+	}
+	for _, r := range c.rules {
+		if strings.Contains(u.Path, r.Path) {
+			return r, true
+		}
+	}
+	return CacheRule{}, false
+}
+
+// cacheKey drops the access key so it never ends up in the cache and
+// sorts the query so equal requests share an entry.
+func cacheKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return cacheKeyPrefix + rawURL
+	}
+	q := u.Query()
+	q.Del("access_key")
+	u.RawQuery = q.Encode()
+	return cacheKeyPrefix + u.String()
+}
+
+// cacheable is false for the error payloads both vendors send back
+// with a success status.
+func cacheable(body []byte) bool {
+	var payload struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return false
+	}
+	return len(payload.Error) == 0 || string(payload.Error) == "null"
+}
+
+// flight runs one call per key at a time and hands its result to every
+// caller that asked while it was running. the call has a context of
+// its own that is cancelled once every caller waiting on it gave up.
+type flight struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+	body    []byte
+	err     error
+}
+
+func (f *flight) do(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	f.mu.Lock()
+	call, ok := f.calls[key]
+	if !ok {
+		callCtx, cancel := context.WithCancel(context.Background())
+		call = &flightCall{done: make(chan struct{}), cancel: cancel}
+		f.calls[key] = call
+		go func() {
+			call.body, call.err = fn(callCtx)
+			f.forget(key, call)
+			cancel()
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	f.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.body, call.err
+	case <-ctx.Done():
+		f.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			call.cancel()
+			// later callers start a new call instead of joining this one
+			if f.calls[key] == call {
+				delete(f.calls, key)
+			}
+		}
+		f.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (f *flight) forget(key string, call *flightCall) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls[key] == call {
+		delete(f.calls, key)
+	}
+}
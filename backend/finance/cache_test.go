@@ -0,0 +1,146 @@
+package finance
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// gatedClient answers every call with body once release is closed and
+// counts the calls and the urls it was given.
+type gatedClient struct {
+	mu      sync.Mutex
+	calls   int
+	urls    []string
+	body    string
+	release chan struct{}
+}
+
+func (g *gatedClient) MakeGetRequest(ctx context.Context, method string, rawURL string) ([]byte, error) {
+	g.mu.Lock()
+	g.calls++
+	g.urls = append(g.urls, rawURL)
+	g.mu.Unlock()
+	select {
+	case <-g.release:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return []byte(g.body), nil
+}
+
+func (g *gatedClient) count() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.calls
+}
+
+// waiters is how many callers wait on the flight for key.
+func (c *cachedClient) waiters(key string) int {
+	c.flight.mu.Lock()
+	defer c.flight.mu.Unlock()
+	if call, ok := c.flight.calls[key]; ok {
+		return call.waiters
+	}
+	return 0
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+const cachedURL = "https://api.marketstack.com/v1/eod?access_key=secret&symbols=AAPL"
+
+func TestCachedClientServesStaleWhileOneRefreshRuns(t *testing.T) {
+	upstream := &gatedClient{body: `{"data":"new"}`, release: make(chan struct{})}
+	store := NewMemoryCache()
+	rule := CacheRule{Path: "/eod", TTL: time.Minute, Stale: time.Hour}
+	c := NewCachedClient(zap.NewNop(), upstream, store, []CacheRule{rule})
+
+	key := cacheKey(cachedURL)
+	raw, _ := json.Marshal(cacheEntry{Body: []byte(`{"data":"old"}`), Fetched: time.Now().Add(-2 * time.Minute)})
+	store.Set(key, raw, rule.TTL+rule.Stale)
+
+	const callers = 5
+	for i := 0; i < callers; i++ {
+		body, err := c.MakeGetRequest(context.Background(), "GET", cachedURL)
+		if err != nil || string(body) != `{"data":"old"}` {
+			t.Fatalf("got %s, %v, want the stale body at once", body, err)
+		}
+	}
+	// every stale hit joins the refresh that is still running
+	waitFor(t, func() bool { return c.waiters(key) == callers })
+	if n := upstream.count(); n != 1 {
+		t.Errorf("upstream called %d times, want one refresh", n)
+	}
+
+	close(upstream.release)
+	waitFor(t, func() bool { return c.waiters(key) == 0 })
+	body, err := c.MakeGetRequest(context.Background(), "GET", cachedURL)
+	if err != nil || string(body) != `{"data":"new"}` {
+		t.Errorf("got %s, %v after the refresh, want the new body", body, err)
+	}
+	if n := upstream.count(); n != 1 {
+		t.Errorf("upstream called %d times, want the refreshed copy served", n)
+	}
+}
+
+func TestCachedClientSharesMisses(t *testing.T) {
+	upstream := &gatedClient{body: `{"data":[]}`, release: make(chan struct{})}
+	c := NewCachedClient(zap.NewNop(), upstream, NewMemoryCache(), DefaultCacheRules())
+
+	const callers = 4
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.MakeGetRequest(context.Background(), "GET", cachedURL); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	waitFor(t, func() bool { return c.waiters(cacheKey(cachedURL)) == callers })
+	close(upstream.release)
+	wg.Wait()
+	if n := upstream.count(); n != 1 {
+		t.Errorf("upstream called %d times, want one shared call", n)
+	}
+}
+
+func TestCachedClientSkipsErrorPayloads(t *testing.T) {
+	upstream := &gatedClient{body: `{"success":false,"error":{"code":101}}`, release: make(chan struct{})}
+	close(upstream.release)
+	c := NewCachedClient(zap.NewNop(), upstream, NewMemoryCache(), DefaultCacheRules())
+	for i := 0; i < 2; i++ {
+		if _, err := c.MakeGetRequest(context.Background(), "GET", cachedURL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := upstream.count(); n != 2 {
+		t.Errorf("upstream called %d times, want the error payload left uncached", n)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	a := cacheKey("https://api.marketstack.com/v1/eod?symbols=AAPL&access_key=one&limit=5")
+	b := cacheKey("https://api.marketstack.com/v1/eod?limit=5&access_key=two&symbols=AAPL")
+	if a != b {
+		t.Errorf("keys %s and %s differ", a, b)
+	}
+	if strings.Contains(a, "access_key") {
+		t.Errorf("key %s holds the access key", a)
+	}
+}
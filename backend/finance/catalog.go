@@ -0,0 +1,488 @@
+package finance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// marketstack pages tickers 100 at a time unless asked for more, up
+// to 1000
+const (
+	defaultTickerPage = 100
+	maxTickerPage     = 1000
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+)
+
+var ErrCatalogNotReady = errors.New("ticker catalog not loaded yet")
+
+type CatalogConfig struct {
+	// PagesPerRefresh caps the marketstack calls of one refresh, each
+	// loading maxTickerPage tickers
+	PagesPerRefresh int
+	// Refresh is how often a full catalog is loaded again, FillInterval
+	// how soon the next refresh runs while a pass is still filling it
+	Refresh      time.Duration
+	FillInterval time.Duration
+	// QuotaReserve is how much of the marketstack monthly budget a
+	// refresh leaves alone for the requests of our users
+	QuotaReserve int
+}
+
+// CatalogConfigFromEnv reads CATALOG_PAGES_PER_REFRESH (5 calls),
+// CATALOG_REFRESH (24h), CATALOG_FILL_INTERVAL (1h) and
+// CATALOG_QUOTA_RESERVE (100 calls).
+func CatalogConfigFromEnv() CatalogConfig {
+	cfg := CatalogConfig{
+		PagesPerRefresh: 5,
+		Refresh:         24 * time.Hour,
+		FillInterval:    time.Hour,
+		QuotaReserve:    100,
+	}
+	if v, err := strconv.Atoi(os.Getenv("CATALOG_PAGES_PER_REFRESH")); err == nil && v > 0 {
+		cfg.PagesPerRefresh = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("CATALOG_QUOTA_RESERVE")); err == nil && v >= 0 {
+		cfg.QuotaReserve = v
+	}
+	durations := map[string]*time.Duration{
+		"CATALOG_REFRESH":       &cfg.Refresh,
+		"CATALOG_FILL_INTERVAL": &cfg.FillInterval,
+	}
+	for env, d := range durations {
+		if v, err := time.ParseDuration(os.Getenv(env)); err == nil && v > 0 {
+			*d = v
+		}
+	}
+	return cfg
+}
+
+// TickerCatalog is a local copy of the provider's ticker list, indexed
+// for search and by exchange. the list is paged in over several
+// refreshes, so the marketstack budget is spent a few calls at a time,
+// and kept in a CatalogStore. until the first pass is through, answers
+// say the catalog is partial.
+type TickerCatalog struct {
+	logger   *zap.Logger
+	provider StockProvider
+	store    CatalogStore
+	quotas   *QuotaTracker
+	config   CatalogConfig
+
+	mu         sync.RWMutex
+	entries    map[string]CatalogEntry
+	state      CatalogState
+	tickers    []allTickers
+	exchanges  map[string]StockExchange
+	byExchange map[string][]int
+	source     string
+}
+
+// NewTickerCatalog pages the catalog in from provider within the
+// marketstack budget tracked by quotas and keeps it in store. either
+// may be nil, leaving the budget unchecked or the catalog in memory.
+func NewTickerCatalog(logger *zap.Logger, provider StockProvider, store CatalogStore, quotas *QuotaTracker, config CatalogConfig) *TickerCatalog {
+	return &TickerCatalog{
+		logger:   logger,
+		provider: provider,
+		store:    store,
+		quotas:   quotas,
+		config:   config,
+		entries:  map[string]CatalogEntry{},
+	}
+}
+
+// Run loads the stored catalog and refreshes it until ctx is done,
+// every FillInterval while a pass is filling it and every Refresh
+// once it is full. a failed refresh keeps what was loaded.
+func (c *TickerCatalog) Run(ctx context.Context) {
+	if err := c.Load(ctx); err != nil {
+		c.logger.Warn("could not load stored ticker catalog", zap.Any("error", err))
+	}
+	for {
+		if err := c.Refresh(ctx); err != nil {
+			c.logger.Warn("could not refresh ticker catalog", zap.Any("error", err))
+		}
+		wait := c.config.Refresh
+		if c.filling() {
+			wait = c.config.FillInterval
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Load takes in the catalog kept in the store, so a restart goes on
+// where the last pass stopped.
+func (c *TickerCatalog) Load(ctx context.Context) error {
+	if c.store == nil {
+		return nil
+	}
+	entries, state, ok, err := c.store.Catalog(ctx)
+	if err != nil || !ok {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range entries {
+		c.entries[catalogKey(e.Ticker)] = e
+	}
+	c.state = state
+	c.index()
+	return nil
+}
+
+// filling tells whether a pass is under way, or none has been made.
+func (c *TickerCatalog) filling() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.state.Next > 0 || !c.state.Complete
+}
+
+// Refresh goes on with the current pass for up to PagesPerRefresh
+// pages, starting a new pass once the last one is a Refresh old. it
+// stops paging once the marketstack budget is down to the reserve,
+// failing only when it could not load a single page.
+func (c *TickerCatalog) Refresh(ctx context.Context) error {
+	c.mu.RLock()
+	state := c.state
+	c.mu.RUnlock()
+	if !state.Refreshed.IsZero() && state.Next == 0 && state.Complete && time.Since(state.Refreshed) < c.config.Refresh {
+		return nil
+	}
+
+	for pages := 0; pages < c.config.PagesPerRefresh; pages++ {
+		if !c.withinBudget() {
+			if pages == 0 {
+				return fmt.Errorf("%w: marketstack budget is down to the catalog reserve of %d calls", ErrQuotaExceeded, c.config.QuotaReserve)
+			}
+			c.logger.Info("ticker catalog refresh stopped to spare the marketstack budget", zap.Int("next", state.Next))
+			return nil
+		}
+		page, err := c.provider.Tickers(ctx, maxTickerPage, state.Next)
+		if err != nil {
+			return err
+		}
+		ended, err := c.add(ctx, page, &state)
+		if err != nil {
+			return err
+		}
+		if ended {
+			return nil
+		}
+	}
+	return nil
+}
+
+// add takes a page of the current pass in, storing it, and moves state
+// on past it. it tells whether the page ended the pass.
+func (c *TickerCatalog) add(ctx context.Context, page allStockTickers, state *CatalogState) (bool, error) {
+	entries := make([]CatalogEntry, 0, len(page.Data))
+	for i, t := range page.Data {
+		entries = append(entries, CatalogEntry{Ticker: t, Position: state.Next + i, Pass: state.Pass})
+	}
+	next := *state
+	next.Next += len(page.Data)
+	if page.Pagination.Total > 0 {
+		next.Total = page.Pagination.Total
+	}
+	next.Refreshed = time.Now().UTC()
+	ended := len(page.Data) < maxTickerPage || (next.Total > 0 && next.Next >= next.Total)
+	if ended {
+		next.Pass++
+		next.Next = 0
+		next.Complete = true
+	}
+	if c.store != nil {
+		if err := c.store.SavePage(ctx, entries, next, ended); err != nil {
+			return false, err
+		}
+	}
+
+	c.mu.Lock()
+	for _, e := range entries {
+		c.entries[catalogKey(e.Ticker)] = e
+	}
+	if ended {
+		// what the pass did not see is no longer listed
+		for key, e := range c.entries {
+			if e.Pass < state.Pass {
+				delete(c.entries, key)
+			}
+		}
+	}
+	c.state = next
+	c.source = page.Source
+	c.index()
+	c.mu.Unlock()
+	*state = next
+	c.logger.Debug("ticker catalog page loaded", zap.Int("tickers", len(c.entries)), zap.Int("next", next.Next), zap.Bool("complete", next.Complete))
+	return ended, nil
+}
+
+func catalogKey(t allTickers) string {
+	return t.Symbol + "|" + strings.ToUpper(t.StockExchange.MIC)
+}
+
+// index rebuilds the ticker list and exchange index from the entries.
+// c.mu must be held for writing.
+func (c *TickerCatalog) index() {
+	entries := make([]CatalogEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Position != entries[j].Position {
+			return entries[i].Position < entries[j].Position
+		}
+		return catalogKey(entries[i].Ticker) < catalogKey(entries[j].Ticker)
+	})
+	tickers := make([]allTickers, 0, len(entries))
+	exchanges := map[string]StockExchange{}
+	byExchange := map[string][]int{}
+	for i, e := range entries {
+		tickers = append(tickers, e.Ticker)
+		mic := strings.ToUpper(e.Ticker.StockExchange.MIC)
+		if mic == "" {
+			continue
+		}
+		exchanges[mic] = e.Ticker.StockExchange
+		byExchange[mic] = append(byExchange[mic], i)
+	}
+	c.tickers = tickers
+	c.exchanges = exchanges
+	c.byExchange = byExchange
+}
+
+// ready tells whether anything has been loaded. c.mu must be held.
+func (c *TickerCatalog) ready() bool {
+	return !c.state.Refreshed.IsZero()
+}
+
+// partial tells whether no pass has gone through the whole list yet.
+// c.mu must be held.
+func (c *TickerCatalog) partial() bool {
+	return !c.state.Complete
+}
+
+// withinBudget tells whether one more catalog call leaves the reserve
+// of the marketstack budget untouched.
+func (c *TickerCatalog) withinBudget() bool {
+	if c.quotas == nil {
+		return true
+	}
+	remaining, limited := c.quotas.Remaining("marketstack")
+	return !limited || remaining > c.config.QuotaReserve
+}
+
+// SearchResult is Partial while the catalog is still being filled, so
+// a ticker may be missing from it.
+type SearchResult struct {
+	Query   string        `json:"query"`
+	Matches []TickerMatch `json:"matches"`
+	Partial bool          `json:"partial,omitempty"`
+	Source  string        `json:"source,omitempty"`
+}
+
+type TickerMatch struct {
+	allTickers
+	Score int `json:"score"`
+}
+
+// Search ranks the tickers matching q on symbol and company name. an
+// exact symbol ranks first, then symbol prefixes, names with a word
+// starting with q, names containing q and last fuzzy matches.
+func (c *TickerCatalog) Search(q string, limit int) (*SearchResult, error) {
+	q = strings.ToUpper(strings.TrimSpace(q))
+	if q == "" {
+		return nil, fmt.Errorf("%w: q is required", ErrInvalidQuery)
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		return nil, fmt.Errorf("%w: limit must be at most %d", ErrInvalidQuery, MaxSearchLimit)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.ready() {
+		return nil, ErrCatalogNotReady
+	}
+	matches := make([]TickerMatch, 0)
+	for _, t := range c.tickers {
+		if score := matchScore(q, t); score > 0 {
+			matches = append(matches, TickerMatch{allTickers: t, Score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Symbol < matches[j].Symbol
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return &SearchResult{Query: q, Matches: matches, Partial: c.partial(), Source: c.source}, nil
+}
+
+// matchScore rates how well t matches the upper case query, zero
+// meaning no match at all.
+func matchScore(q string, t allTickers) int {
+	symbol := strings.ToUpper(t.Symbol)
+	name := strings.ToUpper(t.Name)
+	switch {
+	case symbol == q:
+		return 100
+	case strings.HasPrefix(symbol, q):
+		return 80
+	case strings.HasPrefix(name, q):
+		return 70
+	}
+	for _, word := range strings.Fields(name) {
+		if strings.HasPrefix(word, q) {
+			return 60
+		}
+	}
+	if strings.Contains(name, q) {
+		return 50
+	}
+	// allow one typo per four characters typed
+	if d := levenshtein(q, symbol); d <= len(q)/4 {
+		return 40 - d
+	}
+	for _, word := range strings.Fields(name) {
+		if len(word) > len(q) {
+			word = word[:len(q)]
+		}
+		if d := levenshtein(q, word); d <= len(q)/4 {
+			return 30 - d
+		}
+	}
+	if len(q) >= 3 && isSubsequence(q, name) {
+		return 10
+	}
+	return 0
+}
+
+func isSubsequence(q string, s string) bool {
+	i := 0
+	for j := 0; i < len(q) && j < len(s); j++ {
+		if q[i] == s[j] {
+			i++
+		}
+	}
+	return i == len(q)
+}
+
+// levenshtein counts the single byte edits that turn a into b.
+func levenshtein(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func minInt(v int, rest ...int) int {
+	for _, r := range rest {
+		if r < v {
+			v = r
+		}
+	}
+	return v
+}
+
+type ExchangeEntry struct {
+	StockExchange
+	Tickers int `json:"tickers"`
+}
+
+// ExchangeList is Partial while the catalog is still being filled.
+type ExchangeList struct {
+	Data      []ExchangeEntry `json:"data"`
+	Refreshed time.Time       `json:"refreshed"`
+	Partial   bool            `json:"partial,omitempty"`
+	Source    string          `json:"source,omitempty"`
+}
+
+// Exchanges lists every exchange in the catalog by MIC.
+func (c *TickerCatalog) Exchanges() (*ExchangeList, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.ready() {
+		return nil, ErrCatalogNotReady
+	}
+	val := &ExchangeList{Data: make([]ExchangeEntry, 0, len(c.exchanges)), Refreshed: c.state.Refreshed, Partial: c.partial(), Source: c.source}
+	for mic, ex := range c.exchanges {
+		val.Data = append(val.Data, ExchangeEntry{StockExchange: ex, Tickers: len(c.byExchange[mic])})
+	}
+	sort.Slice(val.Data, func(i, j int) bool { return val.Data[i].MIC < val.Data[j].MIC })
+	return val, nil
+}
+
+// ExchangeTickers pages through the tickers listed on one exchange.
+// while the catalog is partial the total only counts those loaded.
+func (c *TickerCatalog) ExchangeTickers(mic string, limit int, offset int) (allStockTickers, error) {
+	if limit <= 0 {
+		limit = defaultTickerPage
+	}
+	if limit > maxTickerPage || offset < 0 {
+		return allStockTickers{}, fmt.Errorf("%w: limit must be at most %d and offset not negative", ErrInvalidQuery, maxTickerPage)
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.ready() {
+		return allStockTickers{}, ErrCatalogNotReady
+	}
+	mic = strings.ToUpper(mic)
+	listed, ok := c.byExchange[mic]
+	if !ok {
+		return allStockTickers{}, fmt.Errorf("%w: no exchange %s", ErrSymbolNotFound, mic)
+	}
+	total := len(listed)
+	start, end := offset, offset+limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	val := allStockTickers{Data: make([]allTickers, 0, end-start), Partial: c.partial(), Source: c.source}
+	for _, i := range listed[start:end] {
+		val.Data = append(val.Data, c.tickers[i])
+	}
+	val.Pagination = StockPagination{Limit: limit, Offset: offset, Count: len(val.Data), Total: total}
+	return val, nil
+}
@@ -0,0 +1,187 @@
+package finance
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// listedStocks lists its tickers a page at a time and counts the calls.
+type listedStocks struct {
+	StockProvider
+	tickers []allTickers
+	calls   int
+}
+
+func (l *listedStocks) Tickers(ctx context.Context, limit int, offset int) (allStockTickers, error) {
+	l.calls++
+	end := offset + limit
+	if end > len(l.tickers) {
+		end = len(l.tickers)
+	}
+	page := allStockTickers{Data: []allTickers{}, Source: "listed"}
+	if offset < end {
+		page.Data = append(page.Data, l.tickers[offset:end]...)
+	}
+	page.Pagination = StockPagination{Limit: limit, Offset: offset, Count: len(page.Data), Total: len(l.tickers)}
+	return page, nil
+}
+
+func listing(n int, mic string) []allTickers {
+	tickers := make([]allTickers, 0, n)
+	for i := 0; i < n; i++ {
+		tickers = append(tickers, allTickers{Symbol: fmt.Sprintf("T%04d", i), StockExchange: StockExchange{MIC: mic}})
+	}
+	return tickers
+}
+
+// memCatalogStore is a CatalogStore held in memory.
+type memCatalogStore struct {
+	entries map[string]CatalogEntry
+	state   CatalogState
+	saved   bool
+}
+
+func (m *memCatalogStore) Catalog(ctx context.Context) ([]CatalogEntry, CatalogState, bool, error) {
+	entries := make([]CatalogEntry, 0, len(m.entries))
+	for _, e := range m.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Position < entries[j].Position })
+	return entries, m.state, m.saved, nil
+}
+
+func (m *memCatalogStore) SavePage(ctx context.Context, entries []CatalogEntry, state CatalogState, ended bool) error {
+	for _, e := range entries {
+		m.entries[catalogKey(e.Ticker)] = e
+	}
+	if ended {
+		for key, e := range m.entries {
+			if e.Pass < state.Pass-1 {
+				delete(m.entries, key)
+			}
+		}
+	}
+	m.state, m.saved = state, true
+	return nil
+}
+
+func TestCatalogFillsOverRefreshes(t *testing.T) {
+	ctx := context.Background()
+	provider := &listedStocks{tickers: listing(2500, "XNAS")}
+	store := &memCatalogStore{entries: map[string]CatalogEntry{}}
+	c := NewTickerCatalog(zap.NewNop(), provider, store, nil, CatalogConfig{PagesPerRefresh: 2, Refresh: time.Hour})
+
+	if err := c.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	page, err := c.ExchangeTickers("xnas", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !page.Partial || page.Pagination.Total != 2000 || provider.calls != 2 {
+		t.Errorf("after one refresh got partial %v, total %d, %d calls, want partial, 2000, 2 calls", page.Partial, page.Pagination.Total, provider.calls)
+	}
+	if !c.filling() {
+		t.Error("catalog not filling after the first refresh")
+	}
+
+	if err := c.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	page, err = c.ExchangeTickers("XNAS", 10, 2490)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Partial || page.Pagination.Total != 2500 || len(page.Data) != 10 || page.Data[9].Symbol != "T2499" {
+		t.Errorf("after the pass got partial %v, total %d, last %v", page.Partial, page.Pagination.Total, page.Data)
+	}
+	if c.filling() || provider.calls != 3 {
+		t.Errorf("got filling %v after %d calls, want a finished pass after 3", c.filling(), provider.calls)
+	}
+
+	// a fresh catalog is not loaded again before Refresh
+	if err := c.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if provider.calls != 3 {
+		t.Errorf("fresh catalog refreshed, %d calls", provider.calls)
+	}
+}
+
+func TestCatalogDropsDelistedAfterPass(t *testing.T) {
+	ctx := context.Background()
+	provider := &listedStocks{tickers: listing(1500, "XNAS")}
+	store := &memCatalogStore{entries: map[string]CatalogEntry{}}
+	c := NewTickerCatalog(zap.NewNop(), provider, store, nil, CatalogConfig{PagesPerRefresh: 5, Refresh: time.Nanosecond})
+	if err := c.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	provider.tickers = provider.tickers[:1200]
+	if err := c.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	page, err := c.ExchangeTickers("XNAS", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Partial || page.Pagination.Total != 1200 {
+		t.Errorf("got partial %v, total %d, want 1200 listed", page.Partial, page.Pagination.Total)
+	}
+	if len(store.entries) != 1200 {
+		t.Errorf("store kept %d tickers, want 1200", len(store.entries))
+	}
+	if res, err := c.Search("T1300", 1); err != nil || (len(res.Matches) > 0 && res.Matches[0].Symbol == "T1300") {
+		t.Errorf("delisted ticker still found: %v, %v", res, err)
+	}
+}
+
+func TestCatalogResumesFromStore(t *testing.T) {
+	ctx := context.Background()
+	provider := &listedStocks{tickers: listing(2500, "XLON")}
+	store := &memCatalogStore{entries: map[string]CatalogEntry{}}
+	first := NewTickerCatalog(zap.NewNop(), provider, store, nil, CatalogConfig{PagesPerRefresh: 1, Refresh: time.Hour})
+	if err := first.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	second := NewTickerCatalog(zap.NewNop(), provider, store, nil, CatalogConfig{PagesPerRefresh: 1, Refresh: time.Hour})
+	if _, err := second.Exchanges(); err != ErrCatalogNotReady {
+		t.Errorf("got %v before loading, want ErrCatalogNotReady", err)
+	}
+	if err := second.Load(ctx); err != nil {
+		t.Fatal(err)
+	}
+	list, err := second.Exchanges()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !list.Partial || len(list.Data) != 1 || list.Data[0].Tickers != 1000 {
+		t.Errorf("loaded %+v, want 1000 tickers of a partial catalog", list)
+	}
+
+	if err := second.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.state.Next; got != 2000 {
+		t.Errorf("refresh after restart went on to %d, want 2000", got)
+	}
+	page, err := second.ExchangeTickers("XLON", 1, 1000)
+	if err != nil || len(page.Data) != 1 || page.Data[0].Symbol != "T1000" {
+		t.Errorf("got %v, %v, want T1000 after the stored page", page.Data, err)
+	}
+}
+
+func TestCatalogKeepsQuotaReserve(t *testing.T) {
+	quotas := NewQuotaTracker(QuotaConfig{Limits: map[string]QuotaLimit{"marketstack": {PerMonth: 2}}})
+	provider := &listedStocks{tickers: listing(10, "XNAS")}
+	c := NewTickerCatalog(zap.NewNop(), provider, nil, quotas, CatalogConfig{PagesPerRefresh: 5, Refresh: time.Hour, QuotaReserve: 5})
+	if err := c.Refresh(context.Background()); err == nil || provider.calls != 0 {
+		t.Errorf("got %v after %d calls, want the reserve kept", err, provider.calls)
+	}
+}
@@ -0,0 +1,148 @@
+package finance
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CatalogState is how far the ticker catalog is filled. a pass pages
+// through the whole provider list, a page per call, over as many
+// refreshes as the budget needs.
+type CatalogState struct {
+	// pass being filled and the offset it goes on from
+	Pass int
+	Next int
+	// tickers the provider reported having
+	Total int
+	// a pass has finished, so the catalog holds every ticker
+	Complete  bool
+	Refreshed time.Time
+}
+
+// CatalogEntry is a ticker with where and in which pass it was loaded.
+type CatalogEntry struct {
+	Ticker   allTickers
+	Position int
+	Pass     int
+}
+
+// CatalogStore keeps the ticker catalog across refreshes and restarts.
+type CatalogStore interface {
+	// Catalog is every stored entry by position with the fill state,
+	// false when nothing has been stored yet
+	Catalog(ctx context.Context) ([]CatalogEntry, CatalogState, bool, error)
+	// SavePage stores entries and the state the fill is in after them.
+	// ended tells the page closed the pass before state.Pass, so the
+	// entries not seen in that pass are dropped
+	SavePage(ctx context.Context, entries []CatalogEntry, state CatalogState, ended bool) error
+}
+
+var _ CatalogStore = &sqlCatalogStore{}
+
+type sqlCatalogStore struct {
+	logger *zap.Logger
+	db     *sql.DB
+}
+
+func NewCatalogStore(logger *zap.Logger, db *sql.DB) *sqlCatalogStore {
+	return &sqlCatalogStore{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (s *sqlCatalogStore) Catalog(ctx context.Context) ([]CatalogEntry, CatalogState, bool, error) {
+	var (
+		state     CatalogState
+		complete  int
+		refreshed string
+	)
+	err := s.db.QueryRowContext(ctx, "select pass, next_offset, total, complete, refreshed from ticker_catalog_state where id = 1").Scan(&state.Pass, &state.Next, &state.Total, &complete, &refreshed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, CatalogState{}, false, nil
+	}
+	if err != nil {
+		s.logger.Debug("could not fetch catalog state", zap.Any("error", err))
+		return nil, CatalogState{}, false, err
+	}
+	state.Complete = complete == 1
+	if state.Refreshed, err = time.Parse(sqlTimeLayout, refreshed); err != nil {
+		return nil, CatalogState{}, false, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, "select position, pass, data from ticker_catalog order by position, symbol, mic")
+	if err != nil {
+		s.logger.Debug("could not fetch catalog", zap.Any("error", err))
+		return nil, CatalogState{}, false, err
+	}
+	defer rows.Close()
+	entries := make([]CatalogEntry, 0)
+	for rows.Next() {
+		var (
+			e    CatalogEntry
+			data []byte
+		)
+		if err := rows.Scan(&e.Position, &e.Pass, &data); err != nil {
+			s.logger.Debug("could not scan catalog ticker", zap.Any("error", err))
+			return nil, CatalogState{}, false, err
+		}
+		if err := json.Unmarshal(data, &e.Ticker); err != nil {
+			return nil, CatalogState{}, false, err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, CatalogState{}, false, err
+	}
+	return entries, state, true, nil
+}
+
+func (s *sqlCatalogStore) SavePage(ctx context.Context, entries []CatalogEntry, state CatalogState, ended bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Debug("could not start transaction", zap.Any("error", err))
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, "insert into ticker_catalog(symbol, mic, position, pass, data) values(?,?,?,?,?) on duplicate key update position=values(position), pass=values(pass), data=values(data)")
+	if err != nil {
+		tx.Rollback()
+		s.logger.Debug("could not prepare catalog insert", zap.Any("error", err))
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range entries {
+		data, err := json.Marshal(e.Ticker)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, e.Ticker.Symbol, e.Ticker.StockExchange.MIC, e.Position, e.Pass, data); err != nil {
+			tx.Rollback()
+			s.logger.Debug("could not save catalog ticker", zap.Any("error", err))
+			return err
+		}
+	}
+	if ended {
+		if _, err := tx.ExecContext(ctx, "delete from ticker_catalog where pass < ?", state.Pass-1); err != nil {
+			tx.Rollback()
+			s.logger.Debug("could not drop delisted tickers", zap.Any("error", err))
+			return err
+		}
+	}
+	complete := 0
+	if state.Complete {
+		complete = 1
+	}
+	if _, err := tx.ExecContext(ctx, "insert into ticker_catalog_state(id, pass, next_offset, total, complete, refreshed) values(1,?,?,?,?,?) on duplicate key update pass=values(pass), next_offset=values(next_offset), total=values(total), complete=values(complete), refreshed=values(refreshed)",
+		state.Pass, state.Next, state.Total, complete, state.Refreshed.UTC().Format(sqlTimeLayout)); err != nil {
+		tx.Rollback()
+		s.logger.Debug("could not save catalog state", zap.Any("error", err))
+		return err
+	}
+	return tx.Commit()
+}
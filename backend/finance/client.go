@@ -1,43 +1,260 @@
 package finance
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 )
 
 type RequestClient interface {
-	MakeGetRequest(method string, url string) ([]byte, error)
+	MakeGetRequest(ctx context.Context, method string, url string) ([]byte, error)
 }
 
 var _ RequestClient = &Dataclient{}
 
+// APIError is a vendor answering with an error, either through the
+// status code or an error payload on a success status as coinlayer
+// does. Code is the vendor's error name such as invalid_access_key.
+type APIError struct {
+	Host    string
+	Status  int
+	Code    string
+	Message string
+	Body    []byte
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s answered %d", e.Host, e.Status)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// Temporary is true for the errors worth retrying.
+func (e *APIError) Temporary() bool {
+	return e.Status == http.StatusTooManyRequests || e.Status >= 500
+}
+
+type ClientConfig struct {
+	Timeout time.Duration
+	// Retries is how many times a temporary failure is tried again
+	Retries     int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// a host failing BreakerThreshold times in a row is not called
+	// again until BreakerCooldown has passed
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+func ClientConfigFromEnv() ClientConfig {
+	_ = godotenv.Load()
+	cfg := ClientConfig{
+		Timeout:          10 * time.Second,
+		Retries:          3,
+		BaseBackoff:      250 * time.Millisecond,
+		MaxBackoff:       5 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+	if v, err := time.ParseDuration(os.Getenv("HTTP_TIMEOUT")); err == nil && v > 0 {
+		cfg.Timeout = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("HTTP_RETRIES")); err == nil && v >= 0 {
+		cfg.Retries = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("BREAKER_THRESHOLD")); err == nil && v > 0 {
+		cfg.BreakerThreshold = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("BREAKER_COOLDOWN")); err == nil && v > 0 {
+		cfg.BreakerCooldown = v
+	}
+	return cfg
+}
+
+// Dataclient calls the vendor apis through one shared http client,
+// retrying temporary failures with exponential backoff and cutting off
+// hosts that keep failing.
 type Dataclient struct {
-	logger *zap.Logger
+	logger   *zap.Logger
+	config   ClientConfig
+	client   *http.Client
+	breakers *breakers
+	quotas   *QuotaTracker
 }
 
-func NewDataClient(logger *zap.Logger) *Dataclient {
+// NewDataClient makes calls within the budgets of quotas, which may be
+// nil to leave them unlimited.
+func NewDataClient(logger *zap.Logger, config ClientConfig, quotas *QuotaTracker) *Dataclient {
 	return &Dataclient{
-		logger: logger,
+		logger:   logger,
+		config:   config,
+		client:   &http.Client{Timeout: config.Timeout},
+		breakers: newBreakers(config.BreakerThreshold, config.BreakerCooldown),
+		quotas:   quotas,
 	}
 }
 
-func (c *Dataclient) MakeGetRequest(method string, url string) ([]byte, error) {
-	req, err := http.NewRequest(method, url, nil)
+func (c *Dataclient) MakeGetRequest(ctx context.Context, method string, url string) ([]byte, error) {
+	return c.do(ctx, method, url)
+}
+
+func (c *Dataclient) do(ctx context.Context, method string, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
 	if err != nil {
 		c.logger.Debug("error making get request", zap.Any("error", err.Error()))
 		return nil, err
 	}
+	host := u.Hostname()
+
+	for attempt := 0; ; attempt++ {
+		if err := c.breakers.allow(host); err != nil {
+			return nil, err
+		}
+		if c.quotas != nil {
+			if err := c.quotas.acquire(ctx, rawURL); err != nil {
+				c.logger.Debug("call over quota", zap.Any("error", err.Error()))
+				c.breakers.abandon(host)
+				return nil, err
+			}
+		}
+		body, retryAfter, err := c.attempt(ctx, method, rawURL, host)
+		if err == nil {
+			c.breakers.success(host)
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			// our caller gave up, the host did nothing wrong
+			c.breakers.abandon(host)
+			return nil, err
+		}
+		if !retryable(err) {
+			// not the host's fault, so it does not count against it
+			c.breakers.success(host)
+			return nil, err
+		}
+		c.breakers.failure(host)
+		// not worth holding the caller for a vendor that wants a long break
+		if attempt >= c.config.Retries || retryAfter > c.config.MaxBackoff {
+			return nil, err
+		}
+		wait := c.backoff(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		c.logger.Debug("retrying upstream call", zap.String("host", host), zap.Int("attempt", attempt+1), zap.Duration("wait", wait), zap.Any("error", err.Error()))
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// attempt makes one call. it also returns how long the vendor asked us
+// to wait before trying again, if it did.
+func (c *Dataclient) attempt(ctx context.Context, method string, rawURL string, host string) ([]byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		c.logger.Debug("error making get request", zap.Any("error", err.Error()))
+		return nil, 0, err
+	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Accept", "application/json")
-	client := &http.Client{}
-	res, err := client.Do(req)
+	res, err := c.client.Do(req)
 	if err != nil {
 		c.logger.Debug("error processing data", zap.Any("error", err.Error()))
-		return nil, err
+		return nil, 0, err
 	}
 	defer res.Body.Close()
-	body, _ := io.ReadAll(res.Body)
-	return body, nil
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		c.logger.Debug("error reading response", zap.Any("error", err.Error()))
+		return nil, 0, err
+	}
+	if apiErr := vendorError(host, res.StatusCode, body); apiErr != nil {
+		return nil, retryAfter(res.Header.Get("Retry-After")), apiErr
+	}
+	return body, 0, nil
+}
+
+func (c *Dataclient) backoff(attempt int) time.Duration {
+	wait := c.config.BaseBackoff << attempt
+	if wait <= 0 || wait > c.config.MaxBackoff {
+		wait = c.config.MaxBackoff
+	}
+	// full jitter keeps retries from many requests from lining up
+	return time.Duration(rand.Int63n(int64(wait) + 1))
+}
+
+// retryable is true for network failures and temporary vendor errors,
+// but not for a call we cancelled ourselves.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	return true
+}
+
+// vendorError reads the error out of a response, nil when there is
+// none. marketstack sends {"error": {"code": "...", "message": "..."}}
+// and coinlayer {"success": false, "error": {"code": 101, "type": "...",
+// "info": "..."}}, the latter with a 200 status.
+func vendorError(host string, status int, body []byte) *APIError {
+	var payload struct {
+		Error *struct {
+			Code    json.RawMessage `json:"code"`
+			Type    string          `json:"type"`
+			Message string          `json:"message"`
+			Info    string          `json:"info"`
+		} `json:"error"`
+	}
+	_ = json.Unmarshal(body, &payload)
+	if payload.Error == nil && status >= 200 && status < 300 {
+		return nil
+	}
+	apiErr := &APIError{Host: host, Status: status, Body: body}
+	if e := payload.Error; e != nil {
+		apiErr.Code = e.Type
+		if apiErr.Code == "" {
+			apiErr.Code = strings.Trim(string(e.Code), `"`)
+		}
+		apiErr.Message = e.Message
+		if apiErr.Message == "" {
+			apiErr.Message = e.Info
+		}
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = http.StatusText(status)
+	}
+	return apiErr
+}
+
+// retryAfter reads a Retry-After header given in seconds.
+func retryAfter(v string) time.Duration {
+	secs, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || secs < 0 {
+		return 0
+	}
+	return time.Duration(secs) * time.Second
 }
@@ -0,0 +1,203 @@
+package finance
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeClock is a clock that only moves when told to.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// scriptedServer answers with the statuses and bodies of replies in
+// turn, repeating the last one, and counts the calls.
+type scriptedServer struct {
+	mu      sync.Mutex
+	replies []reply
+	calls   int
+}
+
+type reply struct {
+	status     int
+	body       string
+	retryAfter string
+}
+
+func (s *scriptedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	rep := s.replies[len(s.replies)-1]
+	if s.calls < len(s.replies) {
+		rep = s.replies[s.calls]
+	}
+	s.calls++
+	s.mu.Unlock()
+	if rep.retryAfter != "" {
+		w.Header().Set("Retry-After", rep.retryAfter)
+	}
+	w.WriteHeader(rep.status)
+	w.Write([]byte(rep.body))
+}
+
+func (s *scriptedServer) script(replies ...reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replies = replies
+	s.calls = 0
+}
+
+func (s *scriptedServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls
+}
+
+func testClientConfig() ClientConfig {
+	return ClientConfig{Timeout: time.Second, Retries: 2, BaseBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+}
+
+func TestClientRetries(t *testing.T) {
+	ok := reply{status: http.StatusOK, body: `{"data":[]}`}
+	tests := []struct {
+		name      string
+		replies   []reply
+		wantCalls int
+		wantCode  string
+		wantErr   bool
+	}{
+		{name: "temporary failures retried", replies: []reply{{status: 503}, {status: 429}, ok}, wantCalls: 3},
+		{name: "retries run out", replies: []reply{{status: 500}}, wantCalls: 3, wantErr: true},
+		{
+			name:      "client errors not retried",
+			replies:   []reply{{status: 401, body: `{"error":{"code":"invalid_access_key","message":"bad key"}}`}},
+			wantCalls: 1,
+			wantCode:  "invalid_access_key",
+			wantErr:   true,
+		},
+		{
+			name:      "error payload on a success status",
+			replies:   []reply{{status: 200, body: `{"success":false,"error":{"code":104,"type":"usage_limit_reached","info":"used up"}}`}},
+			wantCalls: 1,
+			wantCode:  "usage_limit_reached",
+			wantErr:   true,
+		},
+		{name: "long retry after not waited for", replies: []reply{{status: 429, retryAfter: "60"}, ok}, wantCalls: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &scriptedServer{replies: tt.replies}
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+			c := NewDataClient(zap.NewNop(), testClientConfig(), nil)
+
+			body, err := c.MakeGetRequest(context.Background(), http.MethodGet, ts.URL+"/v1/eod")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %s, %v, want error %v", body, err, tt.wantErr)
+			}
+			if n := srv.count(); n != tt.wantCalls {
+				t.Errorf("server called %d times, want %d", n, tt.wantCalls)
+			}
+			var apiErr *APIError
+			if tt.wantCode != "" && (!errors.As(err, &apiErr) || apiErr.Code != tt.wantCode) {
+				t.Errorf("got %v, want an api error %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestClientBreaker(t *testing.T) {
+	srv := &scriptedServer{replies: []reply{{status: 503}}}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	config := testClientConfig()
+	config.Retries = 0
+	config.BreakerThreshold = 2
+	config.BreakerCooldown = 30 * time.Second
+	c := NewDataClient(zap.NewNop(), config, nil)
+	c.breakers.now = clock.Now
+	get := func() error {
+		_, err := c.MakeGetRequest(context.Background(), http.MethodGet, ts.URL+"/v1/eod")
+		return err
+	}
+
+	// closed: failures reach the server until the threshold
+	for i := 0; i < 2; i++ {
+		if err := get(); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("call %d: got %v, want the server's error", i+1, err)
+		}
+	}
+	// open: the host is not called during the cooldown
+	if err := get(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v, want ErrCircuitOpen", err)
+	}
+	clock.Advance(29 * time.Second)
+	if err := get(); !errors.Is(err, ErrCircuitOpen) || srv.count() != 2 {
+		t.Fatalf("got %v after %d calls, want the circuit still open", err, srv.count())
+	}
+
+	// half-open: one trial call, which fails and opens it again
+	clock.Advance(2 * time.Second)
+	if err := get(); err == nil || errors.Is(err, ErrCircuitOpen) || srv.count() != 3 {
+		t.Fatalf("got %v after %d calls, want a failed trial call", err, srv.count())
+	}
+	if err := get(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v after a failed trial, want ErrCircuitOpen", err)
+	}
+
+	// a trial that succeeds closes it
+	clock.Advance(31 * time.Second)
+	srv.script(reply{status: http.StatusOK, body: `{"data":[]}`})
+	for i := 0; i < 3; i++ {
+		if err := get(); err != nil {
+			t.Fatalf("call %d after recovery: %v", i+1, err)
+		}
+	}
+	if n := srv.count(); n != 3 {
+		t.Errorf("server called %d times after recovery, want 3", n)
+	}
+}
+
+func TestBreakerAllowsOneTrial(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	b := newBreakers(1, time.Minute)
+	b.now = clock.Now
+	b.failure("host")
+	clock.Advance(time.Minute)
+
+	if err := b.allow("host"); err != nil {
+		t.Fatalf("got %v, want the trial call allowed", err)
+	}
+	if err := b.allow("host"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v while the trial runs, want ErrCircuitOpen", err)
+	}
+	// a trial never made lets the next caller try
+	b.abandon("host")
+	if err := b.allow("host"); err != nil {
+		t.Errorf("got %v after an abandoned trial, want a new one allowed", err)
+	}
+	// other hosts are not affected
+	if err := b.allow("other"); err != nil {
+		t.Errorf("other host: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package finance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// longest range GetTimeframe serves in one go
+	MaxTimeframeDays = 366
+	// days of a timeframe fetched at the same time
+	timeframeParallelism = 4
+)
+
+// HistoricalRates are the end of day rates of one past day.
+type HistoricalRates struct {
+	Date string `json:"date"`
+	LiveData
+}
+
+// Timeframe holds a daily rate series, oldest first, for every coin
+// over a range of days. days no rates could be found for are listed in
+// Missing.
+type Timeframe struct {
+	Start   string                 `json:"start_date"`
+	End     string                 `json:"end_date"`
+	Target  string                 `json:"target"`
+	Series  map[string][]RatePoint `json:"series"`
+	Missing []string               `json:"missing,omitempty"`
+	Source  string                 `json:"source,omitempty"`
+}
+
+type RatePoint struct {
+	Date string  `json:"date"`
+	Rate float64 `json:"rate"`
+}
+
+// GetHistoricalRates returns the rates of a past day.
+func (cs *Cryptos) GetHistoricalRates(ctx context.Context, date string) (*HistoricalRates, error) {
+	if err := validatePastDay(date); err != nil {
+		return nil, err
+	}
+	val, err := cs.provider.Historical(ctx, date)
+	if err != nil {
+		cs.logger.Debug("error fetching historical rates", zap.Any("error", err))
+		return nil, err
+	}
+	return val, nil
+}
+
+// GetTimeframe builds a daily series from start to end, both included,
+// for symbols or for every coin when symbols is empty.
+func (cs *Cryptos) GetTimeframe(ctx context.Context, start string, end string, symbols []string) (*Timeframe, error) {
+	if err := validatePastDay(start); err != nil {
+		return nil, err
+	}
+	if err := validatePastDay(end); err != nil {
+		return nil, err
+	}
+	if start > end {
+		return nil, fmt.Errorf("%w: start_date is after end_date", ErrInvalidQuery)
+	}
+	days := make([]string, 0)
+	for day := start; day <= end; day = addDays(day, 1) {
+		if len(days) == MaxTimeframeDays {
+			return nil, fmt.Errorf("%w: at most %d days per timeframe", ErrInvalidQuery, MaxTimeframeDays)
+		}
+		days = append(days, day)
+	}
+
+	// FanOut files its results under "symbol", here the day
+	batch := FanOut(ctx, days, timeframeParallelism, cs.provider.Historical)
+	if batch.Succeeded == 0 {
+		return nil, fmt.Errorf("no rates between %s and %s: %s", start, end, batch.Results[0].Error)
+	}
+	wanted := map[string]bool{}
+	for _, s := range symbols {
+		wanted[s] = true
+	}
+	tf := &Timeframe{Start: start, End: end, Series: map[string][]RatePoint{}}
+	for _, res := range batch.Results {
+		if res.Error != "" {
+			cs.logger.Debug("no rates for day", zap.String("date", res.Symbol), zap.String("error", res.Error))
+			tf.Missing = append(tf.Missing, res.Symbol)
+			continue
+		}
+		if tf.Target == "" {
+			tf.Target = res.Data.Target
+			tf.Source = res.Data.Source
+		}
+		if res.Data.Target != tf.Target {
+			// a day quoted in another currency cannot share a chart
+			tf.Missing = append(tf.Missing, res.Symbol)
+			continue
+		}
+		for coin, rate := range res.Data.Rates {
+			if len(wanted) > 0 && !wanted[coin] {
+				continue
+			}
+			tf.Series[coin] = append(tf.Series[coin], RatePoint{Date: res.Symbol, Rate: rate})
+		}
+	}
+	return tf, nil
+}
+
+// validatePastDay checks day is a YYYY-MM-DD day that is over.
+func validatePastDay(day string) error {
+	t, err := time.Parse(dateLayout, day)
+	if err != nil {
+		return fmt.Errorf("%w: date %q must be YYYY-MM-DD", ErrInvalidQuery, day)
+	}
+	if !t.Before(time.Now().UTC().Truncate(24 * time.Hour)) {
+		return fmt.Errorf("%w: date %s is not over yet", ErrInvalidQuery, day)
+	}
+	return nil
+}
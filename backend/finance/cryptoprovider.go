@@ -0,0 +1,244 @@
+package finance
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+// CryptoRateProvider is a source of coin listings, live rates and the
+// rates of past days.
+type CryptoRateProvider interface {
+	Name() string
+	List(ctx context.Context) (*AllCrypto, error)
+	Live(ctx context.Context) (*LiveData, error)
+	Historical(ctx context.Context, date string) (*HistoricalRates, error)
+}
+
+var (
+	_ CryptoRateProvider = &coinlayer{}
+	_ CryptoRateProvider = &fixtureCryptos{}
+
+	ErrNoFixture = errors.New("no fixture found")
+)
+
+// NewCryptoRateProvider builds the providers listed in the
+// CRYPTO_PROVIDER env value. coinlayer is the default, "fixture" reads
+// list and live rates from the CRYPTO_FIXTURES directory. a comma
+// separated list fails over in order.
+func NewCryptoRateProvider(logger *zap.Logger, client RequestClient) (CryptoRateProvider, error) {
+	_ = godotenv.Load()
+	names := splitNames(os.Getenv("CRYPTO_PROVIDER"), "coinlayer")
+	providers := make([]CryptoRateProvider, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case "coinlayer":
+			providers = append(providers, NewCoinlayer(logger, client, os.Getenv("COINLAYER")))
+		case "fixture":
+			providers = append(providers, NewFixtureCryptos(logger, os.Getenv("CRYPTO_FIXTURES")))
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+		}
+	}
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+	return NewCryptoFailover(logger, FailoverConfigFromEnv(), providers...), nil
+}
+
+type coinlayer struct {
+	logger    *zap.Logger
+	client    RequestClient
+	baseURL   string
+	accessKey string
+}
+
+func NewCoinlayer(logger *zap.Logger, client RequestClient, accessKey string) *coinlayer {
+	return &coinlayer{
+		logger:    logger,
+		client:    client,
+		baseURL:   "http://api.coinlayer.com/api",
+		accessKey: accessKey,
+	}
+}
+
+func (c *coinlayer) Name() string {
+	return "coinlayer"
+}
+
+func (c *coinlayer) get(ctx context.Context, path string, v any) error {
+	req, err := c.client.MakeGetRequest(ctx, http.MethodGet, c.baseURL+path+"?access_key="+c.accessKey)
+	if err != nil {
+		c.logger.Debug("error fetching data", zap.Any("error", err))
+		return err
+	}
+	if err := json.Unmarshal(req, v); err != nil {
+		c.logger.Debug("error unmarshalling data", zap.Any("error", err))
+		return err
+	}
+	return nil
+}
+
+func (c *coinlayer) List(ctx context.Context) (*AllCrypto, error) {
+	var val AllCrypto
+	if err := c.get(ctx, "/list", &val); err != nil {
+		return nil, err
+	}
+	val.Source = c.Name()
+	return &val, nil
+}
+
+func (c *coinlayer) Live(ctx context.Context) (*LiveData, error) {
+	var val LiveData
+	if err := c.get(ctx, "/live", &val); err != nil {
+		return nil, err
+	}
+	val.Source = c.Name()
+	return &val, nil
+}
+
+// Historical fetches the end of day rates of date, a YYYY-MM-DD day.
+func (c *coinlayer) Historical(ctx context.Context, date string) (*HistoricalRates, error) {
+	var val HistoricalRates
+	if err := c.get(ctx, "/"+date, &val); err != nil {
+		return nil, err
+	}
+	val.Source = c.Name()
+	return &val, nil
+}
+
+// fixtureCryptos serves coin data from disk. <dir>/list.json holds
+// a coinlayer /list response, live rates come from <dir>/live.json
+// (a coinlayer /live response) or <dir>/live.csv with symbol,rate
+// rows. the csv form is always treated as USD rates. past days are
+// coinlayer responses in <dir>/history/<YYYY-MM-DD>.json.
+type fixtureCryptos struct {
+	logger *zap.Logger
+	dir    string
+}
+
+func NewFixtureCryptos(logger *zap.Logger, dir string) *fixtureCryptos {
+	return &fixtureCryptos{
+		logger: logger,
+		dir:    dir,
+	}
+}
+
+func (f *fixtureCryptos) Name() string {
+	return "fixture"
+}
+
+func (f *fixtureCryptos) List(ctx context.Context) (*AllCrypto, error) {
+	body, err := os.ReadFile(filepath.Join(f.dir, "list.json"))
+	if err != nil {
+		f.logger.Debug("error reading fixture", zap.Any("error", err))
+		return nil, err
+	}
+	var val AllCrypto
+	if err := json.Unmarshal(body, &val); err != nil {
+		f.logger.Debug("error unmarshalling fixture", zap.Any("error", err))
+		return nil, err
+	}
+	val.Source = f.Name()
+	return &val, nil
+}
+
+func (f *fixtureCryptos) Live(ctx context.Context) (*LiveData, error) {
+	body, err := os.ReadFile(filepath.Join(f.dir, "live.json"))
+	if err == nil {
+		var val LiveData
+		if err := json.Unmarshal(body, &val); err != nil {
+			f.logger.Debug("error unmarshalling fixture", zap.Any("error", err))
+			return nil, err
+		}
+		val.Source = f.Name()
+		return &val, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		f.logger.Debug("error reading fixture", zap.Any("error", err))
+		return nil, err
+	}
+
+	file, err := os.Open(filepath.Join(f.dir, "live.csv"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: live rates in %s", ErrNoFixture, f.dir)
+		}
+		return nil, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	rates, err := readRatesCSV(file)
+	if err != nil {
+		f.logger.Debug("error parsing live rates csv", zap.Any("error", err))
+		return nil, err
+	}
+	return &LiveData{
+		Timestamp: int(stat.ModTime().Unix()),
+		Target:    "USD",
+		Rates:     rates,
+		Source:    f.Name(),
+	}, nil
+}
+
+func (f *fixtureCryptos) Historical(ctx context.Context, date string) (*HistoricalRates, error) {
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		return nil, fmt.Errorf("%w: date %q must be YYYY-MM-DD", ErrInvalidQuery, date)
+	}
+	body, err := os.ReadFile(filepath.Join(f.dir, "history", date+".json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: rates of %s", ErrNoFixture, date)
+		}
+		f.logger.Debug("error reading fixture", zap.Any("error", err))
+		return nil, err
+	}
+	var val HistoricalRates
+	if err := json.Unmarshal(body, &val); err != nil {
+		f.logger.Debug("error unmarshalling fixture", zap.Any("error", err))
+		return nil, err
+	}
+	val.Date = date
+	val.Source = f.Name()
+	return &val, nil
+}
+
+// readRatesCSV reads symbol,rate rows. a header row is skipped
+// when its rate column is not a number.
+func readRatesCSV(r io.Reader) (map[string]float64, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	rates := make(map[string]float64, len(rows))
+	for i, row := range rows {
+		rate, err := strconv.ParseFloat(row[1], 64)
+		if err != nil {
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		rates[strings.ToUpper(row[0])] = rate
+	}
+	return rates, nil
+}
@@ -1,24 +1,34 @@
 package finance
 
 import (
-	"encoding/json"
-	"log"
-	"net/http"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
 
 	"go.uber.org/zap"
 )
 
 type CryptoData interface {
-	GetAllCryptoData() (*AllCrypto, error)
-	GetLiveCryptoData() (*LiveData, error)
-	ConvertCrypto(coinfrom string, cointo string, amount int) (float64, error)
+	GetAllCryptoData(ctx context.Context) (*AllCrypto, error)
+	GetLiveCryptoData(ctx context.Context, target string) (*LiveData, error)
+	ConvertCrypto(ctx context.Context, coinfrom string, cointo string, amount Decimal, target string) (*Conversion, error)
+	GetHistoricalRates(ctx context.Context, date string) (*HistoricalRates, error)
+	GetTimeframe(ctx context.Context, start string, end string, symbols []string) (*Timeframe, error)
+	GetStats(ctx context.Context, query StatsQuery) (*CryptoStats, error)
 }
 
+var (
+	ErrUnknownCoin = errors.New("unknown coin or currency")
+	ErrNoRate      = errors.New("coin has no usable rate")
+)
+
 var _ CryptoData = &Cryptos{}
 
 type Cryptos struct {
-	logger  *zap.Logger
-	sclient RequestClient
+	logger   *zap.Logger
+	provider CryptoRateProvider
+	fx       *FX
 }
 
 type CryptoResponse struct {
@@ -30,6 +40,7 @@ type CryptoResponse struct {
 type AllCrypto struct {
 	Success bool        `json:"success"`
 	Crypto  interface{} `json:"crypto"`
+	Source  string      `json:"source,omitempty"`
 }
 
 type LiveData struct {
@@ -37,63 +48,172 @@ type LiveData struct {
 
 	// currency we want to display
 	// the current rates in
-	Target string             `json:"target"`
-	Rates  map[string]float64 `json:"rates"`
+	Target   string             `json:"target"`
+	Rates    map[string]float64 `json:"rates"`
+	Source   string             `json:"source,omitempty"`
+	Warnings []string           `json:"warnings,omitempty"`
 }
 
-func NewCryptos(logger *zap.Logger, sclient RequestClient) *Cryptos {
+// NewCryptos quotes coins through provider and fiat currencies through
+// fx, which may be nil to stick to the provider's own target.
+func NewCryptos(logger *zap.Logger, provider CryptoRateProvider, fx *FX) *Cryptos {
 	return &Cryptos{
-		logger:  logger,
-		sclient: sclient,
+		logger:   logger,
+		provider: provider,
+		fx:       fx,
 	}
 }
 
-func (cs *Cryptos) GetAllCryptoData() (*AllCrypto, error) {
-	req, err := cs.sclient.MakeGetRequest(http.MethodGet, "http://api.coinlayer.com/api/list?access_key=09e5664c792fbfa119e714e95095eedc")
+func (cs *Cryptos) GetAllCryptoData(ctx context.Context) (*AllCrypto, error) {
+	val, err := cs.provider.List(ctx)
 	if err != nil {
 		cs.logger.Debug("error fetching data", zap.Any("error", err))
 		return nil, err
 	}
-	var val AllCrypto
-	_ = json.Unmarshal(req, &val)
-	return &val, nil
+	return val, nil
 }
 
-func (cs *Cryptos) GetLiveCryptoData() (*LiveData, error) {
-	req, err := cs.sclient.MakeGetRequest(http.MethodGet, "http://api.coinlayer.com/api/live?access_key=09e5664c792fbfa119e714e95095eedc")
+// GetLiveCryptoData returns the live rates, priced in target when one
+// is given.
+func (cs *Cryptos) GetLiveCryptoData(ctx context.Context, target string) (*LiveData, error) {
+	val, err := cs.provider.Live(ctx)
 	if err != nil {
 		cs.logger.Debug("error fetching data", zap.Any("error", err))
 		return nil, err
 	}
-	var val LiveData
-	_ = json.Unmarshal(req, &val)
-	return &val, nil
+	target = strings.ToUpper(strings.TrimSpace(target))
+	if target == "" || target == val.Target {
+		return val, nil
+	}
+	if cs.fx == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCurrency, target)
+	}
+	factor, err := cs.fx.Price(val.Target, target)
+	if err != nil {
+		return nil, err
+	}
+	f := factor.Float64()
+	fxRates, err := cs.fx.Rates()
+	if err != nil {
+		return nil, err
+	}
+	priced := &LiveData{
+		Timestamp: val.Timestamp,
+		Target:    target,
+		Rates:     make(map[string]float64, len(val.Rates)),
+		Source:    val.Source + "+" + fxRates.Source,
+		Warnings:  val.Warnings,
+	}
+	for coin, rate := range val.Rates {
+		priced.Rates[coin] = rate * f
+	}
+	return priced, nil
 }
 
-func (cs *Cryptos) ConvertCrypto(coinfrom string, cointo string, amount int) (float64, error) {
-	req, err := cs.sclient.MakeGetRequest(http.MethodGet, "http://api.coinlayer.com/api/live?access_key=09e5664c792fbfa119e714e95095eedc")
+// Conversion is an amount of one coin or currency expressed in another.
+// Rate is how many of To one From is worth and Target the currency the
+// rates were quoted in. Value is the amount priced in Target, only set
+// when a target was asked for.
+type Conversion struct {
+	From      string   `json:"converted_from"`
+	To        string   `json:"converted_to"`
+	Amount    Decimal  `json:"amount_to_convert"`
+	Result    Decimal  `json:"amount_to_receive"`
+	Rate      Decimal  `json:"rate"`
+	Target    string   `json:"target"`
+	Value     *Decimal `json:"value,omitempty"`
+	Timestamp int      `json:"timestamp"`
+	Source    string   `json:"source,omitempty"`
+}
+
+// ConvertCrypto converts amount of coinfrom into cointo, either of
+// which may be a coin or a fiat currency. coins are priced at the live
+// rates and fiat through the fx table, so fiat to fiat needs no coin
+// rates at all.
+func (cs *Cryptos) ConvertCrypto(ctx context.Context, coinfrom string, cointo string, amount Decimal, target string) (*Conversion, error) {
+	coinfrom, cointo = strings.ToUpper(strings.TrimSpace(coinfrom)), strings.ToUpper(strings.TrimSpace(cointo))
+	target = strings.ToUpper(strings.TrimSpace(target))
+	if amount.Sign() < 0 {
+		return nil, fmt.Errorf("%w: amount must not be negative", ErrInvalidQuery)
+	}
+
+	var quotes *LiveData
+	if cs.isFiat(coinfrom) && cs.isFiat(cointo) && (target == "" || cs.isFiat(target)) {
+		rates, err := cs.fx.Rates()
+		if err != nil {
+			return nil, err
+		}
+		quotes = &LiveData{Timestamp: rates.Timestamp, Target: rates.Target, Source: rates.Source}
+	} else {
+		live, err := cs.provider.Live(ctx)
+		if err != nil {
+			cs.logger.Debug("error fetching data", zap.Any("error", err))
+			return nil, err
+		}
+		quotes = live
+	}
+
+	fromPrice, err := cs.price(quotes, coinfrom)
 	if err != nil {
-		cs.logger.Debug("error fetching data", zap.Any("error", err))
-		return 0.0, err
-	}
-	var val LiveData
-	_ = json.Unmarshal(req, &val)
-	if val.Rates != nil {
-		var coinFromPrice float64
-		var coinToPrice float64
-		for k, v := range val.Rates {
-			if k == coinfrom {
-				log.Print("coinfrom price -> ", v)
-				coinFromPrice = v
-			}
-			if k == cointo {
-				log.Print("cointo price -> ", v)
-				coinToPrice = v
-			}
+		return nil, err
+	}
+	toPrice, err := cs.price(quotes, cointo)
+	if err != nil {
+		return nil, err
+	}
+	rate := fromPrice.Quo(toPrice)
+	conv := &Conversion{
+		From:      coinfrom,
+		To:        cointo,
+		Amount:    amount,
+		Result:    amount.Mul(rate),
+		Rate:      rate,
+		Target:    quotes.Target,
+		Timestamp: quotes.Timestamp,
+		Source:    quotes.Source,
+	}
+	if target != "" {
+		targetPrice, err := cs.price(quotes, target)
+		if err != nil {
+			return nil, err
 		}
-		calcCoinFromAndAmount := coinFromPrice * float64(amount)
-		calcConversionPrice := calcCoinFromAndAmount / coinToPrice
-		return calcConversionPrice, nil
+		value := amount.Mul(fromPrice.Quo(targetPrice))
+		conv.Target = target
+		conv.Value = &value
+	}
+	return conv, nil
+}
+
+func (cs *Cryptos) isFiat(ccy string) bool {
+	return cs.fx != nil && cs.fx.Has(ccy)
+}
+
+// price is what one unit of a coin or fiat currency costs in the
+// currency quotes are given in. a coin rate wins over a fiat one of
+// the same symbol.
+func (cs *Cryptos) price(quotes *LiveData, symbol string) (Decimal, error) {
+	p, err := quotes.rate(symbol)
+	if !errors.Is(err, ErrUnknownCoin) || !cs.isFiat(symbol) {
+		return p, err
+	}
+	return cs.fx.Price(symbol, quotes.Target)
+}
+
+// rate is the price of coin in the target currency, one for the
+// target itself.
+func (l *LiveData) rate(coin string) (Decimal, error) {
+	if coin == "" {
+		return Decimal{}, fmt.Errorf("%w: no coin given", ErrInvalidQuery)
+	}
+	if strings.EqualFold(coin, l.Target) {
+		return DecimalFromFloat(1), nil
+	}
+	price, ok := l.Rates[coin]
+	if !ok {
+		return Decimal{}, fmt.Errorf("%w: %s", ErrUnknownCoin, coin)
+	}
+	if price <= 0 {
+		return Decimal{}, fmt.Errorf("%w: %s is priced at %v", ErrNoRate, coin, price)
 	}
-	return 0.0, nil
+	return DecimalFromFloat(price), nil
 }
@@ -0,0 +1,256 @@
+package finance
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// days of history stats look back over by default
+	DefaultStatsWindow = 30
+	// days a rolling volatility point is taken over by default
+	DefaultVolatilityPeriod = 7
+	// most coins correlated with each other in one request
+	MaxCorrelationCoins = 20
+)
+
+// StatsQuery picks the coins and the window of a stats request. zero
+// values fall back to DefaultStatsWindow and DefaultVolatilityPeriod.
+type StatsQuery struct {
+	Symbols []string
+	Window  int
+	Period  int
+}
+
+// CryptoStats sums up how every coin moved over the window. Correlation
+// is only filled in when between two and MaxCorrelationCoins symbols
+// were asked for.
+type CryptoStats struct {
+	Start       string                        `json:"start_date"`
+	End         string                        `json:"end_date"`
+	Window      int                           `json:"window"`
+	Period      int                           `json:"volatility_period"`
+	Target      string                        `json:"target"`
+	Coins       []CoinStats                   `json:"coins"`
+	Correlation map[string]map[string]float64 `json:"correlation,omitempty"`
+	Missing     []string                      `json:"missing,omitempty"`
+	Source      string                        `json:"source,omitempty"`
+}
+
+// CoinStats are the figures of one coin. Change compares the latest
+// rate with the one of the day before, WindowChange with the first day
+// of the window. volatility is the standard deviation of daily log
+// returns and MaxDrawdown the worst fall from a peak, as a fraction.
+type CoinStats struct {
+	Symbol              string      `json:"symbol"`
+	Rate                float64     `json:"rate"`
+	Previous            float64     `json:"previous_rate"`
+	Change              float64     `json:"change"`
+	ChangePercent       float64     `json:"change_percent"`
+	WindowChange        float64     `json:"window_change"`
+	WindowChangePercent float64     `json:"window_change_percent"`
+	Volatility          float64     `json:"volatility"`
+	AnnualVolatility    float64     `json:"annualized_volatility"`
+	RollingVolatility   []RatePoint `json:"rolling_volatility,omitempty"`
+	MaxDrawdown         float64     `json:"max_drawdown"`
+	Points              int         `json:"points"`
+}
+
+// GetStats works the stats out from the stored daily rates of the
+// window, with the live rate added as today when it is quoted in the
+// same currency.
+func (cs *Cryptos) GetStats(ctx context.Context, query StatsQuery) (*CryptoStats, error) {
+	if query.Window == 0 {
+		query.Window = DefaultStatsWindow
+	}
+	if query.Period == 0 {
+		query.Period = DefaultVolatilityPeriod
+	}
+	if query.Window < 2 || query.Window > MaxTimeframeDays {
+		return nil, fmt.Errorf("%w: window must be between 2 and %d days", ErrInvalidQuery, MaxTimeframeDays)
+	}
+	if query.Period < 2 || query.Period > query.Window {
+		return nil, fmt.Errorf("%w: volatility period must be between 2 and the window", ErrInvalidQuery)
+	}
+
+	today := time.Now().UTC().Format(dateLayout)
+	tf, err := cs.GetTimeframe(ctx, addDays(today, -query.Window), addDays(today, -1), query.Symbols)
+	if err != nil {
+		return nil, err
+	}
+	series := tf.Series
+	source := tf.Source
+	if live, err := cs.provider.Live(ctx); err != nil {
+		cs.logger.Debug("no live rates for stats, using history only", zap.Any("error", err))
+	} else if live.Target == tf.Target {
+		for coin, points := range series {
+			if rate, ok := live.Rates[coin]; ok {
+				series[coin] = append(points, RatePoint{Date: today, Rate: rate})
+			}
+		}
+		source = source + "+" + live.Source
+	}
+
+	stats := &CryptoStats{
+		Start:   tf.Start,
+		End:     today,
+		Window:  query.Window,
+		Period:  query.Period,
+		Target:  tf.Target,
+		Coins:   make([]CoinStats, 0, len(series)),
+		Missing: tf.Missing,
+		Source:  source,
+	}
+	for coin, points := range series {
+		stats.Coins = append(stats.Coins, coinStats(coin, points, query.Period))
+	}
+	sort.Slice(stats.Coins, func(i, j int) bool {
+		return stats.Coins[i].Symbol < stats.Coins[j].Symbol
+	})
+	if n := len(query.Symbols); n >= 2 && n <= MaxCorrelationCoins {
+		stats.Correlation = correlations(series)
+	}
+	return stats, nil
+}
+
+func coinStats(symbol string, points []RatePoint, period int) CoinStats {
+	st := CoinStats{Symbol: symbol, Points: len(points)}
+	if len(points) == 0 {
+		return st
+	}
+	first, last := points[0].Rate, points[len(points)-1].Rate
+	st.Rate = last
+	st.WindowChange, st.WindowChangePercent = change(first, last)
+	if len(points) > 1 {
+		st.Previous = points[len(points)-2].Rate
+		st.Change, st.ChangePercent = change(st.Previous, last)
+	}
+
+	returns := logReturns(points)
+	moves := make([]float64, len(returns))
+	for i, r := range returns {
+		moves[i] = r.Rate
+	}
+	st.Volatility = stddev(moves)
+	st.AnnualVolatility = st.Volatility * math.Sqrt(365)
+	for i := period - 1; i < len(returns); i++ {
+		st.RollingVolatility = append(st.RollingVolatility, RatePoint{Date: returns[i].Date, Rate: stddev(moves[i-period+1 : i+1])})
+	}
+
+	peak := first
+	for _, p := range points {
+		if p.Rate > peak {
+			peak = p.Rate
+		}
+		if peak > 0 {
+			if dd := (peak - p.Rate) / peak; dd > st.MaxDrawdown {
+				st.MaxDrawdown = dd
+			}
+		}
+	}
+	return st
+}
+
+func change(from float64, to float64) (float64, float64) {
+	if from == 0 {
+		return to - from, 0
+	}
+	return to - from, (to - from) / from * 100
+}
+
+// logReturns are the day to day log returns, each dated with the day
+// it moved into. pairs with a rate of zero are skipped, so the dates
+// may have gaps.
+func logReturns(points []RatePoint) []RatePoint {
+	returns := make([]RatePoint, 0, len(points))
+	for i := 1; i < len(points); i++ {
+		if points[i-1].Rate > 0 && points[i].Rate > 0 {
+			returns = append(returns, RatePoint{Date: points[i].Date, Rate: math.Log(points[i].Rate / points[i-1].Rate)})
+		}
+	}
+	return returns
+}
+
+// stddev is the sample standard deviation, zero for fewer than two values.
+func stddev(vals []float64) float64 {
+	if len(vals) < 2 {
+		return 0
+	}
+	var mean float64
+	for _, v := range vals {
+		mean += v
+	}
+	mean /= float64(len(vals))
+	var sum float64
+	for _, v := range vals {
+		sum += (v - mean) * (v - mean)
+	}
+	return math.Sqrt(sum / float64(len(vals)-1))
+}
+
+// correlations pairs up every two coins over the days both have a
+// return for. pairs without enough common days are left out.
+func correlations(series map[string][]RatePoint) map[string]map[string]float64 {
+	returns := make(map[string]map[string]float64, len(series))
+	for coin, points := range series {
+		byDay := map[string]float64{}
+		for _, r := range logReturns(points) {
+			byDay[r.Date] = r.Rate
+		}
+		returns[coin] = byDay
+	}
+	matrix := make(map[string]map[string]float64, len(series))
+	for a := range returns {
+		matrix[a] = map[string]float64{}
+	}
+	for a, ra := range returns {
+		for b, rb := range returns {
+			if a >= b {
+				continue
+			}
+			xs, ys := make([]float64, 0, len(ra)), make([]float64, 0, len(ra))
+			for day, x := range ra {
+				if y, ok := rb[day]; ok {
+					xs = append(xs, x)
+					ys = append(ys, y)
+				}
+			}
+			if r, ok := pearson(xs, ys); ok {
+				matrix[a][b] = r
+				matrix[b][a] = r
+			}
+		}
+		matrix[a][a] = 1
+	}
+	return matrix
+}
+
+// pearson is the correlation of xs and ys, not ok when there are
+// fewer than three pairs or one side never moves.
+func pearson(xs []float64, ys []float64) (float64, bool) {
+	n := float64(len(xs))
+	if len(xs) < 3 {
+		return 0, false
+	}
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx, my = mx/n, my/n
+	var cov, vx, vy float64
+	for i := range xs {
+		cov += (xs[i] - mx) * (ys[i] - my)
+		vx += (xs[i] - mx) * (xs[i] - mx)
+		vy += (ys[i] - my) * (ys[i] - my)
+	}
+	if vx == 0 || vy == 0 {
+		return 0, false
+	}
+	return cov / math.Sqrt(vx*vy), true
+}
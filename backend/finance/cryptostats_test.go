@@ -0,0 +1,118 @@
+package finance
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCoinStats(t *testing.T) {
+	series := func(rates ...float64) []RatePoint {
+		points := make([]RatePoint, len(rates))
+		for i, r := range rates {
+			points[i] = RatePoint{Date: addDays("2024-03-01", i), Rate: r}
+		}
+		return points
+	}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	up, down := math.Log(1.1), math.Log(0.9)
+	tests := []struct {
+		name          string
+		points        []RatePoint
+		period        int
+		rate          float64
+		changePercent float64
+		windowPercent float64
+		volatility    float64
+		drawdown      float64
+		rolling       []RatePoint
+	}{
+		{
+			name:   "no points",
+			period: 2,
+		},
+		{
+			name:   "one point",
+			points: series(100),
+			period: 2,
+			rate:   100,
+		},
+		{
+			name:          "rolling volatility is dated by the day moved into",
+			points:        series(100, 110, 99, 99),
+			period:        2,
+			rate:          99,
+			changePercent: 0,
+			windowPercent: -1,
+			volatility:    stddev([]float64{up, down, 0}),
+			drawdown:      0.1,
+			rolling: []RatePoint{
+				{Date: "2024-03-03", Rate: stddev([]float64{up, down})},
+				{Date: "2024-03-04", Rate: stddev([]float64{down, 0})},
+			},
+		},
+		{
+			name:          "zero rates leave gaps without shifting dates",
+			points:        series(100, 0, 100, 110, 121),
+			period:        2,
+			rate:          121,
+			changePercent: 10,
+			windowPercent: 21,
+			drawdown:      1,
+			rolling:       []RatePoint{{Date: "2024-03-05", Rate: 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := coinStats("BTC", tt.points, tt.period)
+			if st.Points != len(tt.points) || st.Rate != tt.rate {
+				t.Errorf("points %d at %v, want %d at %v", st.Points, st.Rate, len(tt.points), tt.rate)
+			}
+			if !near(st.ChangePercent, tt.changePercent) || !near(st.WindowChangePercent, tt.windowPercent) {
+				t.Errorf("change %v%%, window %v%%, want %v%% and %v%%", st.ChangePercent, st.WindowChangePercent, tt.changePercent, tt.windowPercent)
+			}
+			if !near(st.Volatility, tt.volatility) || !near(st.AnnualVolatility, tt.volatility*math.Sqrt(365)) {
+				t.Errorf("volatility %v, want %v", st.Volatility, tt.volatility)
+			}
+			if !near(st.MaxDrawdown, tt.drawdown) {
+				t.Errorf("drawdown %v, want %v", st.MaxDrawdown, tt.drawdown)
+			}
+			if len(st.RollingVolatility) != len(tt.rolling) {
+				t.Fatalf("rolling volatility %v, want %v", st.RollingVolatility, tt.rolling)
+			}
+			for i, want := range tt.rolling {
+				got := st.RollingVolatility[i]
+				if got.Date != want.Date || !near(got.Rate, want.Rate) {
+					t.Errorf("rolling volatility %d = %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCorrelations(t *testing.T) {
+	series := func(rates ...float64) []RatePoint {
+		points := make([]RatePoint, len(rates))
+		for i, r := range rates {
+			points[i] = RatePoint{Date: addDays("2024-03-01", i), Rate: r}
+		}
+		return points
+	}
+	matrix := correlations(map[string][]RatePoint{
+		"BTC":  series(100, 110, 99, 120),
+		"ETH":  series(10, 11, 9.9, 12),
+		"XRP":  series(1, 0.9, 0.99, 0.8),
+		"FLAT": series(5, 5, 5, 5),
+	})
+	if r := matrix["BTC"]["ETH"]; math.Abs(r-1) > 1e-9 {
+		t.Errorf("BTC and ETH move together, got %v", r)
+	}
+	if r := matrix["BTC"]["XRP"]; r >= 0 {
+		t.Errorf("BTC and XRP move apart, got %v", r)
+	}
+	if _, ok := matrix["BTC"]["FLAT"]; ok {
+		t.Error("a coin that never moves has no correlation")
+	}
+	if matrix["FLAT"]["FLAT"] != 1 {
+		t.Error("every coin correlates with itself")
+	}
+}
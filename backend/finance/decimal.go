@@ -0,0 +1,123 @@
+package finance
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// decimals kept when a Decimal is printed, enough for the smallest
+// unit of the coins we quote
+const decimalPlaces = 18
+
+// Decimal is an exact decimal number for amounts and rates that must
+// not pick up float rounding on the way through a conversion. it is
+// immutable: every operation builds its result in a new big.Rat, so
+// copies never share a value that later changes. the zero value is 0.
+type Decimal struct {
+	rat *big.Rat
+}
+
+// ParseDecimal reads a plain or exponent decimal such as 0.5 or 1e-3.
+func ParseDecimal(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.Contains(s, "/") {
+		return Decimal{}, fmt.Errorf("%w: %q is not a decimal number", ErrInvalidQuery, s)
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Decimal{}, fmt.Errorf("%w: %q is not a decimal number", ErrInvalidQuery, s)
+	}
+	return Decimal{rat: r}, nil
+}
+
+// DecimalFromFloat takes the shortest decimal that reads back as f, so
+// a rate of 0.1 is 0.1 and not the binary value closest to it.
+func DecimalFromFloat(f float64) Decimal {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'f', -1, 64))
+	if !ok {
+		return Decimal{}
+	}
+	return Decimal{rat: r}
+}
+
+// value is the rat behind d, never nil and never to be written to.
+func (d Decimal) value() *big.Rat {
+	if d.rat == nil {
+		return new(big.Rat)
+	}
+	return d.rat
+}
+
+func (d Decimal) Sign() int {
+	return d.value().Sign()
+}
+
+// Float64 is the nearest float to d, for values only shown to people.
+func (d Decimal) Float64() float64 {
+	f, _ := d.value().Float64()
+	return f
+}
+
+// Cmp is -1, 0 or 1 as d is less than, equal to or greater than o.
+func (d Decimal) Cmp(o Decimal) int {
+	return d.value().Cmp(o.value())
+}
+
+func (d Decimal) Add(o Decimal) Decimal {
+	return Decimal{rat: new(big.Rat).Add(d.value(), o.value())}
+}
+
+func (d Decimal) Sub(o Decimal) Decimal {
+	return Decimal{rat: new(big.Rat).Sub(d.value(), o.value())}
+}
+
+func (d Decimal) Mul(o Decimal) Decimal {
+	return Decimal{rat: new(big.Rat).Mul(d.value(), o.value())}
+}
+
+// Quo divides d by o, which must not be zero.
+func (d Decimal) Quo(o Decimal) Decimal {
+	return Decimal{rat: new(big.Rat).Quo(d.value(), o.value())}
+}
+
+// Fits tells whether d has no more than places decimals and digits
+// digits before the point, as a DECIMAL(digits+places, places) column
+// holds it without rounding.
+func (d Decimal) Fits(digits int, places int) bool {
+	ten := big.NewInt(10)
+	scaled := new(big.Rat).Mul(d.value(), new(big.Rat).SetInt(new(big.Int).Exp(ten, big.NewInt(int64(places)), nil)))
+	if !scaled.IsInt() {
+		return false
+	}
+	limit := new(big.Int).Exp(ten, big.NewInt(int64(digits+places)), nil)
+	return new(big.Int).Abs(scaled.Num()).Cmp(limit) < 0
+}
+
+// String prints d rounded to decimalPlaces without trailing zeros.
+func (d Decimal) String() string {
+	s := d.value().FloatString(decimalPlaces)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// MarshalJSON writes d as a json number with all its digits, leaving
+// it to the reader whether to lose precision.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Decimal) UnmarshalJSON(b []byte) error {
+	v, err := ParseDecimal(strings.Trim(string(b), `"`))
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
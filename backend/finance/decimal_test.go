@@ -0,0 +1,206 @@
+package finance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "0.5", want: "0.5"},
+		{in: " 12 ", want: "12"},
+		{in: "-3.250", want: "-3.25"},
+		{in: "1e-3", want: "0.001"},
+		{in: "2.5E2", want: "250"},
+		{in: "0.0000000000000000001", want: "0"},
+		{in: "-0.0000000000000000001", want: "0"},
+		{in: "", wantErr: true},
+		{in: "1/3", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			d, err := ParseDecimal(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Fatalf("got %s, %v, want ErrInvalidQuery", d, err)
+				}
+				return
+			}
+			if err != nil || d.String() != tt.want {
+				t.Fatalf("got %s, %v, want %s", d, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	dec := func(s string) Decimal {
+		d, err := ParseDecimal(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	var zero Decimal
+	tests := []struct {
+		name string
+		got  Decimal
+		want string
+	}{
+		{"no float rounding", DecimalFromFloat(0.1).Add(DecimalFromFloat(0.2)), "0.3"},
+		{"sub", dec("1").Sub(dec("0.9")), "0.1"},
+		{"mul", dec("1.5").Mul(dec("-2")), "-3"},
+		{"quo rounds when printed", dec("1").Quo(dec("3")), "0.333333333333333333"},
+		{"zero value adds", zero.Add(dec("2")), "2"},
+		{"zero value prints", zero, "0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got.String() != tt.want {
+				t.Errorf("got %s, want %s", tt.got, tt.want)
+			}
+		})
+	}
+	if zero.Sign() != 0 || zero.Cmp(dec("0")) != 0 || dec("-1").Cmp(zero) != -1 {
+		t.Error("zero value does not compare as 0")
+	}
+
+	// results never share their value with the operands
+	a := dec("1")
+	b := a
+	sum := a.Add(dec("1"))
+	if a.String() != "1" || b.String() != "1" || sum.String() != "2" {
+		t.Errorf("a = %s, b = %s, sum = %s, want 1, 1, 2", a, b, sum)
+	}
+}
+
+func TestDecimalFits(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{in: "0", want: true},
+		{in: "1.5", want: true},
+		{in: "0.000000000000000001", want: true},
+		{in: "0.0000000000000000001", want: false},
+		{in: "99999999999999999999.999999999999999999", want: true},
+		{in: "100000000000000000000", want: false},
+		{in: "-99999999999999999999", want: true},
+		{in: "-100000000000000000000", want: false},
+		{in: "1e19", want: true},
+		{in: "1e20", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			d, err := ParseDecimal(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := d.Fits(20, 18); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	var v struct {
+		Amount Decimal `json:"amount"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount":"0.10"}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(v)
+	if err != nil || string(b) != `{"amount":0.1}` {
+		t.Errorf("got %s, %v", b, err)
+	}
+}
+
+// liveCryptos serves fixed live rates and counts the calls.
+type liveCryptos struct {
+	live  LiveData
+	calls int
+}
+
+func (f *liveCryptos) Name() string { return "fake" }
+
+func (f *liveCryptos) List(ctx context.Context) (*AllCrypto, error) { return &AllCrypto{}, nil }
+
+func (f *liveCryptos) Live(ctx context.Context) (*LiveData, error) {
+	f.calls++
+	live := f.live
+	return &live, nil
+}
+
+func (f *liveCryptos) Historical(ctx context.Context, date string) (*HistoricalRates, error) {
+	return nil, ErrNoFixture
+}
+
+func TestConvertCrypto(t *testing.T) {
+	fx := NewFX(zap.NewNop(), nil, 0)
+	// one EUR costs 1.25 USD
+	fx.set(&LiveData{Target: "USD", Rates: map[string]float64{"EUR": 1.25}, Source: "fx"})
+
+	tests := []struct {
+		name      string
+		from, to  string
+		amount    string
+		target    string
+		result    string
+		rate      string
+		value     string
+		liveCalls int
+		wantErr   error
+	}{
+		{name: "coin to coin", from: "btc", to: "eth", amount: "2", result: "40", rate: "20", liveCalls: 1},
+		{name: "coin to fiat", from: "BTC", to: "EUR", amount: "0.1", result: "4000", rate: "40000", liveCalls: 1},
+		{name: "coin to target", from: "BTC", to: "USD", amount: "1", result: "50000", rate: "50000", liveCalls: 1},
+		{name: "valued in a target", from: "ETH", to: "BTC", amount: "4", target: "eur", result: "0.2", rate: "0.05", value: "8000", liveCalls: 1},
+		{name: "fiat to fiat needs no coin rates", from: "EUR", to: "USD", amount: "10", result: "12.5", rate: "1.25"},
+		{name: "unknown coin", from: "NOPE", to: "USD", amount: "1", liveCalls: 1, wantErr: ErrUnknownCoin},
+		{name: "zero rate", from: "DEAD", to: "USD", amount: "1", liveCalls: 1, wantErr: ErrNoRate},
+		{name: "negative amount", from: "BTC", to: "USD", amount: "-1", wantErr: ErrInvalidQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &liveCryptos{live: LiveData{Target: "USD", Rates: map[string]float64{"BTC": 50000, "ETH": 2500, "DEAD": 0}, Source: "fake"}}
+			cs := NewCryptos(zap.NewNop(), provider, fx)
+			amount, err := ParseDecimal(tt.amount)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conv, err := cs.ConvertCrypto(context.Background(), tt.from, tt.to, amount, tt.target)
+			if provider.calls != tt.liveCalls {
+				t.Errorf("live rates asked %d times, want %d", provider.calls, tt.liveCalls)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conv.Result.String() != tt.result || conv.Rate.String() != tt.rate {
+				t.Errorf("result %s at %s, want %s at %s", conv.Result, conv.Rate, tt.result, tt.rate)
+			}
+			switch {
+			case tt.value == "" && conv.Value != nil:
+				t.Errorf("value %s, want none", conv.Value)
+			case tt.value != "" && (conv.Value == nil || conv.Value.String() != tt.value):
+				t.Errorf("value %v, want %s", conv.Value, tt.value)
+			}
+		})
+	}
+}
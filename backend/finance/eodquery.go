@@ -0,0 +1,222 @@
+package finance
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// marketstack refuses pages bigger than this
+	maxEODPage = 1000
+
+	// upper bound on bars returned for one query, roughly
+	// forty years of trading days
+	MaxEODLimit = 10000
+
+	DefaultEODLimit = 100
+	dateLayout      = "2006-01-02"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// EODQuery narrows an EOD request. dates are YYYY-MM-DD and
+// inclusive, Sort is ASC or DESC by date (DESC when empty) and a
+// zero Limit means DefaultEODLimit.
+type EODQuery struct {
+	DateFrom string
+	DateTo   string
+	Limit    int
+	Offset   int
+	Sort     string
+}
+
+// ParseEODQuery reads date_from, date_to, limit, offset and sort.
+func ParseEODQuery(values url.Values) (EODQuery, error) {
+	q := EODQuery{
+		DateFrom: values.Get("date_from"),
+		DateTo:   values.Get("date_to"),
+		Sort:     strings.ToUpper(values.Get("sort")),
+	}
+	var err error
+	if v := values.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil {
+			return EODQuery{}, fmt.Errorf("%w: limit %q", ErrInvalidQuery, v)
+		}
+	}
+	if v := values.Get("offset"); v != "" {
+		if q.Offset, err = strconv.Atoi(v); err != nil {
+			return EODQuery{}, fmt.Errorf("%w: offset %q", ErrInvalidQuery, v)
+		}
+	}
+	if err := q.Validate(); err != nil {
+		return EODQuery{}, err
+	}
+	return q, nil
+}
+
+func (q EODQuery) Validate() error {
+	for _, d := range []string{q.DateFrom, q.DateTo} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse(dateLayout, d); err != nil {
+			return fmt.Errorf("%w: date %q must be YYYY-MM-DD", ErrInvalidQuery, d)
+		}
+	}
+	if q.DateFrom != "" && q.DateTo != "" && q.DateFrom > q.DateTo {
+		return fmt.Errorf("%w: date_from is after date_to", ErrInvalidQuery)
+	}
+	if q.Limit < 0 || q.Limit > MaxEODLimit {
+		return fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, MaxEODLimit)
+	}
+	if q.Offset < 0 {
+		return fmt.Errorf("%w: offset cannot be negative", ErrInvalidQuery)
+	}
+	if q.Sort != "" && q.Sort != "ASC" && q.Sort != "DESC" {
+		return fmt.Errorf("%w: sort must be ASC or DESC", ErrInvalidQuery)
+	}
+	return nil
+}
+
+func (q EODQuery) limit() int {
+	if q.Limit == 0 {
+		return DefaultEODLimit
+	}
+	return q.Limit
+}
+
+func (q EODQuery) sort() string {
+	if q.Sort == "" {
+		return "DESC"
+	}
+	return q.Sort
+}
+
+// params are the upstream query values for one page of the query.
+func (q EODQuery) params(limit int, offset int) url.Values {
+	params := url.Values{}
+	if q.DateFrom != "" {
+		params.Set("date_from", q.DateFrom)
+	}
+	if q.DateTo != "" {
+		params.Set("date_to", q.DateTo)
+	}
+	params.Set("sort", q.sort())
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("offset", strconv.Itoa(offset))
+	return params
+}
+
+// most days one ranged intraday query may span
+const MaxIntradayDays = 31
+
+// IntradayQuery is an inclusive range of YYYY-MM-DD days of intraday
+// bars. the zero query asks for the vendor's latest bars.
+type IntradayQuery struct {
+	DateFrom string
+	DateTo   string
+}
+
+// ParseIntradayQuery reads date_from and date_to, which are given
+// together or not at all.
+func ParseIntradayQuery(values url.Values) (IntradayQuery, error) {
+	q := IntradayQuery{DateFrom: values.Get("date_from"), DateTo: values.Get("date_to")}
+	if err := q.Validate(); err != nil {
+		return IntradayQuery{}, err
+	}
+	return q, nil
+}
+
+func (q IntradayQuery) Validate() error {
+	if q.DateFrom == "" && q.DateTo == "" {
+		return nil
+	}
+	from, err := time.Parse(dateLayout, q.DateFrom)
+	if err != nil {
+		return fmt.Errorf("%w: date_from %q must be YYYY-MM-DD", ErrInvalidQuery, q.DateFrom)
+	}
+	to, err := time.Parse(dateLayout, q.DateTo)
+	if err != nil {
+		return fmt.Errorf("%w: date_to %q must be YYYY-MM-DD", ErrInvalidQuery, q.DateTo)
+	}
+	if from.After(to) {
+		return fmt.Errorf("%w: date_from is after date_to", ErrInvalidQuery)
+	}
+	if to.Sub(from) >= MaxIntradayDays*24*time.Hour {
+		return fmt.Errorf("%w: intraday ranges span at most %d days", ErrInvalidQuery, MaxIntradayDays)
+	}
+	return nil
+}
+
+// Ranged tells whether q asks for a range rather than the latest bars.
+func (q IntradayQuery) Ranged() bool {
+	return q.DateFrom != "" && q.DateTo != ""
+}
+
+// params are the upstream query values for one page of a ranged query,
+// nil for the latest bars.
+func (q IntradayQuery) params(limit int, offset int) url.Values {
+	if !q.Ranged() {
+		return nil
+	}
+	return url.Values{
+		"date_from": {q.DateFrom},
+		"date_to":   {q.DateTo},
+		"sort":      {"ASC"},
+		"limit":     {strconv.Itoa(limit)},
+		"offset":    {strconv.Itoa(offset)},
+	}
+}
+
+// eodDay is the YYYY-MM-DD part of a vendor timestamp.
+func eodDay(date string) string {
+	if len(date) > len(dateLayout) {
+		return date[:len(dateLayout)]
+	}
+	return date
+}
+
+// applyEODQuery filters, sorts and pages bars held in memory the same
+// way the upstream api would.
+func applyEODQuery(p *ParentStockEOD, q EODQuery) {
+	bars := make([]EOD, 0, len(p.Data.EOD))
+	for _, bar := range p.Data.EOD {
+		day := eodDay(bar.Date)
+		if q.DateFrom != "" && day < q.DateFrom {
+			continue
+		}
+		if q.DateTo != "" && day > q.DateTo {
+			continue
+		}
+		bars = append(bars, bar)
+	}
+	asc := q.sort() == "ASC"
+	sort.SliceStable(bars, func(i, j int) bool {
+		if asc {
+			return bars[i].Date < bars[j].Date
+		}
+		return bars[i].Date > bars[j].Date
+	})
+
+	total := len(bars)
+	start := q.Offset
+	if start > total {
+		start = total
+	}
+	end := start + q.limit()
+	if end > total {
+		end = total
+	}
+	p.Data.EOD = bars[start:end]
+	p.Pagination = StockPagination{
+		Limit:  q.limit(),
+		Offset: q.Offset,
+		Count:  len(p.Data.EOD),
+		Total:  total,
+	}
+}
@@ -0,0 +1,77 @@
+package finance
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseEODQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		values url.Values
+		want   EODQuery
+		err    bool
+	}{
+		{"empty", url.Values{}, EODQuery{}, false},
+		{"full", url.Values{"date_from": {"2024-01-01"}, "date_to": {"2024-02-01"}, "limit": {"50"}, "offset": {"10"}, "sort": {"asc"}}, EODQuery{DateFrom: "2024-01-01", DateTo: "2024-02-01", Limit: 50, Offset: 10, Sort: "ASC"}, false},
+		{"bad date", url.Values{"date_from": {"2024/01/01"}}, EODQuery{}, true},
+		{"reversed range", url.Values{"date_from": {"2024-02-01"}, "date_to": {"2024-01-01"}}, EODQuery{}, true},
+		{"limit not a number", url.Values{"limit": {"ten"}}, EODQuery{}, true},
+		{"limit too big", url.Values{"limit": {"10001"}}, EODQuery{}, true},
+		{"negative offset", url.Values{"offset": {"-1"}}, EODQuery{}, true},
+		{"bad sort", url.Values{"sort": {"up"}}, EODQuery{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEODQuery(tt.values)
+			if tt.err {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Fatalf("got error %v, want ErrInvalidQuery", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEODQuery(t *testing.T) {
+	days := []string{"2024-01-01", "2024-01-02", "2024-01-03", "2024-01-04", "2024-01-05"}
+	tests := []struct {
+		name  string
+		query EODQuery
+		want  []string
+		total int
+	}{
+		{"newest first by default", EODQuery{}, []string{"2024-01-05", "2024-01-04", "2024-01-03", "2024-01-02", "2024-01-01"}, 5},
+		{"range ascending", EODQuery{DateFrom: "2024-01-02", DateTo: "2024-01-04", Sort: "ASC"}, []string{"2024-01-02", "2024-01-03", "2024-01-04"}, 3},
+		{"paged", EODQuery{Limit: 2, Offset: 1, Sort: "ASC"}, []string{"2024-01-02", "2024-01-03"}, 5},
+		{"offset past the end", EODQuery{Offset: 9}, []string{}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ParentStockEOD{}
+			for _, d := range days {
+				p.Data.EOD = append(p.Data.EOD, EOD{Date: d + "T00:00:00+0000"})
+			}
+			applyEODQuery(p, tt.query)
+			got := make([]string, 0, len(p.Data.EOD))
+			for _, bar := range p.Data.EOD {
+				got = append(got, eodDay(bar.Date))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if p.Pagination.Total != tt.total || p.Pagination.Count != len(tt.want) {
+				t.Errorf("pagination %+v, want total %d count %d", p.Pagination, tt.total, len(tt.want))
+			}
+		})
+	}
+}
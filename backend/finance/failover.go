@@ -0,0 +1,423 @@
+package finance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	_ StockProvider      = &stockFailover{}
+	_ CryptoRateProvider = &cryptoFailover{}
+
+	ErrProviderTimeout = errors.New("provider timed out")
+	ErrNoProviders     = errors.New("no providers configured")
+)
+
+// FailoverConfig controls how a list of providers is used.
+// providers are tried in order until one answers within Timeout.
+// with Quorum set, quotes are asked from every provider and the
+// median is returned, flagging rates that spread wider than
+// Divergence (a fraction of the median, 0.01 is 1%).
+type FailoverConfig struct {
+	Timeout    time.Duration
+	Quorum     bool
+	Divergence float64
+}
+
+// FailoverConfigFromEnv reads PROVIDER_TIMEOUT, QUOTE_QUORUM and
+// QUORUM_DIVERGENCE, falling back to a 10s timeout and 1% divergence.
+func FailoverConfigFromEnv() FailoverConfig {
+	cfg := FailoverConfig{
+		Timeout:    10 * time.Second,
+		Divergence: 0.01,
+	}
+	if v, err := time.ParseDuration(os.Getenv("PROVIDER_TIMEOUT")); err == nil && v > 0 {
+		cfg.Timeout = v
+	}
+	if v, err := strconv.ParseBool(os.Getenv("QUOTE_QUORUM")); err == nil {
+		cfg.Quorum = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("QUORUM_DIVERGENCE"), 64); err == nil && v > 0 {
+		cfg.Divergence = v
+	}
+	return cfg
+}
+
+// ProviderError collects the failure of every provider that was tried.
+type ProviderError struct {
+	Failures []ProviderFailure
+}
+
+type ProviderFailure struct {
+	Provider string
+	Err      error
+}
+
+func (e *ProviderError) Error() string {
+	if len(e.Failures) == 0 {
+		return ErrNoProviders.Error()
+	}
+	msgs := make([]string, 0, len(e.Failures))
+	for _, f := range e.Failures {
+		msgs = append(msgs, f.Provider+": "+f.Err.Error())
+	}
+	return "all providers failed: " + strings.Join(msgs, "; ")
+}
+
+type namedProvider interface {
+	Name() string
+}
+
+type sourced[T any] struct {
+	source string
+	val    T
+}
+
+// withTimeout runs call and gives up once timeout has passed or ctx
+// is done, cancelling the context handed to call either way.
+func withTimeout[T any](ctx context.Context, timeout time.Duration, call func(ctx context.Context) (T, error)) (T, error) {
+	type result struct {
+		val T
+		err error
+	}
+	callCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan result, 1)
+	go func() {
+		val, err := call(callCtx)
+		done <- result{val, err}
+	}()
+	select {
+	case res := <-done:
+		return res.val, res.err
+	case <-callCtx.Done():
+		var zero T
+		if err := ctx.Err(); err != nil {
+			return zero, err
+		}
+		return zero, ErrProviderTimeout
+	}
+}
+
+// failover asks each provider in turn and returns the first answer.
+func failover[P namedProvider, T any](ctx context.Context, logger *zap.Logger, timeout time.Duration, providers []P, call func(context.Context, P) (T, error)) (T, error) {
+	perr := &ProviderError{}
+	for _, p := range providers {
+		p := p
+		val, err := withTimeout(ctx, timeout, func(ctx context.Context) (T, error) { return call(ctx, p) })
+		if err == nil {
+			return val, nil
+		}
+		if ctx.Err() != nil {
+			// nobody is waiting for the next provider
+			var zero T
+			return zero, ctx.Err()
+		}
+		logger.Warn("provider failed, trying next", zap.String("provider", p.Name()), zap.Any("error", err))
+		perr.Failures = append(perr.Failures, ProviderFailure{Provider: p.Name(), Err: err})
+	}
+	var zero T
+	return zero, perr
+}
+
+// gather asks every provider at once and keeps the ones that answered.
+func gather[P namedProvider, T any](ctx context.Context, logger *zap.Logger, timeout time.Duration, providers []P, call func(context.Context, P) (T, error)) ([]sourced[T], error) {
+	type result struct {
+		idx int
+		val T
+		err error
+	}
+	results := make(chan result, len(providers))
+	for i, p := range providers {
+		i, p := i, p
+		go func() {
+			val, err := withTimeout(ctx, timeout, func(ctx context.Context) (T, error) { return call(ctx, p) })
+			results <- result{i, val, err}
+		}()
+	}
+	ordered := make([]*result, len(providers))
+	for range providers {
+		res := <-results
+		ordered[res.idx] = &res
+	}
+
+	perr := &ProviderError{}
+	answers := make([]sourced[T], 0, len(providers))
+	for i, res := range ordered {
+		if res.err != nil {
+			logger.Warn("provider failed", zap.String("provider", providers[i].Name()), zap.Any("error", res.err))
+			perr.Failures = append(perr.Failures, ProviderFailure{Provider: providers[i].Name(), Err: res.err})
+			continue
+		}
+		answers = append(answers, sourced[T]{source: providers[i].Name(), val: res.val})
+	}
+	if len(answers) == 0 {
+		return nil, perr
+	}
+	return answers, nil
+}
+
+func providerNames[P namedProvider](providers []P) string {
+	names := make([]string, 0, len(providers))
+	for _, p := range providers {
+		names = append(names, p.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func median(vals []float64) float64 {
+	if len(vals) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), vals...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// diverges reports whether the spread of vals around their median
+// is wider than the allowed fraction.
+func diverges(vals []float64, mid float64, allowed float64) bool {
+	if len(vals) < 2 || mid == 0 {
+		return false
+	}
+	lo, hi := vals[0], vals[0]
+	for _, v := range vals[1:] {
+		lo = math.Min(lo, v)
+		hi = math.Max(hi, v)
+	}
+	return (hi-lo)/math.Abs(mid) > allowed
+}
+
+func quorumSource[T any](answers []sourced[T]) string {
+	names := make([]string, 0, len(answers))
+	for _, a := range answers {
+		names = append(names, a.source)
+	}
+	return "median(" + strings.Join(names, ",") + ")"
+}
+
+type stockFailover struct {
+	logger    *zap.Logger
+	config    FailoverConfig
+	providers []StockProvider
+}
+
+func NewStockFailover(logger *zap.Logger, config FailoverConfig, providers ...StockProvider) *stockFailover {
+	return &stockFailover{
+		logger:    logger,
+		config:    config,
+		providers: providers,
+	}
+}
+
+func (f *stockFailover) Name() string {
+	return "failover(" + providerNames(f.providers) + ")"
+}
+
+func (f *stockFailover) Tickers(ctx context.Context, limit int, offset int) (allStockTickers, error) {
+	return failover(ctx, f.logger, f.config.Timeout, f.providers, func(ctx context.Context, p StockProvider) (allStockTickers, error) {
+		return p.Tickers(ctx, limit, offset)
+	})
+}
+
+func (f *stockFailover) Ticker(ctx context.Context, symbol string) (*allTickers, error) {
+	return failover(ctx, f.logger, f.config.Timeout, f.providers, func(ctx context.Context, p StockProvider) (*allTickers, error) {
+		return p.Ticker(ctx, symbol)
+	})
+}
+
+func (f *stockFailover) EOD(ctx context.Context, symbol string, query EODQuery) (*ParentStockEOD, error) {
+	return failover(ctx, f.logger, f.config.Timeout, f.providers, func(ctx context.Context, p StockProvider) (*ParentStockEOD, error) {
+		return p.EOD(ctx, symbol, query)
+	})
+}
+
+func (f *stockFailover) EODLatest(ctx context.Context, symbols []string) (*LatestEOD, error) {
+	call := func(ctx context.Context, p StockProvider) (*LatestEOD, error) {
+		return p.EODLatest(ctx, symbols)
+	}
+	if !f.config.Quorum {
+		return failover(ctx, f.logger, f.config.Timeout, f.providers, call)
+	}
+	answers, err := gather(ctx, f.logger, f.config.Timeout, f.providers, call)
+	if err != nil {
+		return nil, err
+	}
+	return f.medianEOD(symbols, answers), nil
+}
+
+// medianEOD takes, for every symbol, the whole bar of the provider
+// whose close is the median of the closes reported for the same symbol
+// on the newest date any provider reported, so open, high, low and
+// volume stay consistent with it and a provider lagging a day behind
+// is left out. with an even count the bar closest to the median wins.
+func (f *stockFailover) medianEOD(symbols []string, answers []sourced[*LatestEOD]) *LatestEOD {
+	latest := &LatestEOD{Data: make([]EOD, 0, len(symbols)), Missing: make([]string, 0), Source: quorumSource(answers)}
+	for _, symbol := range symbols {
+		found := make([]*EOD, 0, len(answers))
+		day := ""
+		for _, a := range answers {
+			bar, err := a.val.find(symbol)
+			if err != nil {
+				continue
+			}
+			found = append(found, bar)
+			if d := eodDay(bar.Date); d > day {
+				day = d
+			}
+		}
+		if len(found) == 0 {
+			latest.Missing = append(latest.Missing, symbol)
+			continue
+		}
+		var (
+			bars   = make([]*EOD, 0, len(found))
+			closes = make([]float64, 0, len(found))
+		)
+		for _, bar := range found {
+			if eodDay(bar.Date) == day {
+				bars = append(bars, bar)
+				closes = append(closes, bar.Close)
+			}
+		}
+		mid := median(closes)
+		if diverges(closes, mid, f.config.Divergence) {
+			warning := fmt.Sprintf("%s close on %s diverges across providers: %v", symbol, eodDay(bars[0].Date), closes)
+			f.logger.Warn("quorum divergence", zap.String("warning", warning))
+			latest.Warnings = append(latest.Warnings, warning)
+		}
+		chosen := bars[0]
+		for _, bar := range bars[1:] {
+			if math.Abs(bar.Close-mid) < math.Abs(chosen.Close-mid) {
+				chosen = bar
+			}
+		}
+		merged := *chosen
+		merged.Source = ""
+		latest.Data = append(latest.Data, merged)
+	}
+	return latest
+}
+
+func (f *stockFailover) Splits(ctx context.Context, symbol string) (*Split, error) {
+	return failover(ctx, f.logger, f.config.Timeout, f.providers, func(ctx context.Context, p StockProvider) (*Split, error) {
+		return p.Splits(ctx, symbol)
+	})
+}
+
+func (f *stockFailover) Dividends(ctx context.Context, symbol string) (*Dividend, error) {
+	return failover(ctx, f.logger, f.config.Timeout, f.providers, func(ctx context.Context, p StockProvider) (*Dividend, error) {
+		return p.Dividends(ctx, symbol)
+	})
+}
+
+func (f *stockFailover) Intraday(ctx context.Context, symbol string, query IntradayQuery) (*Intraday, error) {
+	return failover(ctx, f.logger, f.config.Timeout, f.providers, func(ctx context.Context, p StockProvider) (*Intraday, error) {
+		return p.Intraday(ctx, symbol, query)
+	})
+}
+
+func (f *stockFailover) IntradayLatest(ctx context.Context, symbols []string) (*LatestIntraday, error) {
+	return failover(ctx, f.logger, f.config.Timeout, f.providers, func(ctx context.Context, p StockProvider) (*LatestIntraday, error) {
+		return p.IntradayLatest(ctx, symbols)
+	})
+}
+
+type cryptoFailover struct {
+	logger    *zap.Logger
+	config    FailoverConfig
+	providers []CryptoRateProvider
+}
+
+func NewCryptoFailover(logger *zap.Logger, config FailoverConfig, providers ...CryptoRateProvider) *cryptoFailover {
+	return &cryptoFailover{
+		logger:    logger,
+		config:    config,
+		providers: providers,
+	}
+}
+
+func (f *cryptoFailover) Name() string {
+	return "failover(" + providerNames(f.providers) + ")"
+}
+
+func (f *cryptoFailover) List(ctx context.Context) (*AllCrypto, error) {
+	return failover(ctx, f.logger, f.config.Timeout, f.providers, func(ctx context.Context, p CryptoRateProvider) (*AllCrypto, error) {
+		return p.List(ctx)
+	})
+}
+
+func (f *cryptoFailover) Live(ctx context.Context) (*LiveData, error) {
+	call := func(ctx context.Context, p CryptoRateProvider) (*LiveData, error) {
+		return p.Live(ctx)
+	}
+	if !f.config.Quorum {
+		return failover(ctx, f.logger, f.config.Timeout, f.providers, call)
+	}
+	answers, err := gather(ctx, f.logger, f.config.Timeout, f.providers, call)
+	if err != nil {
+		return nil, err
+	}
+	return f.medianRates(answers), nil
+}
+
+func (f *cryptoFailover) Historical(ctx context.Context, date string) (*HistoricalRates, error) {
+	return failover(ctx, f.logger, f.config.Timeout, f.providers, func(ctx context.Context, p CryptoRateProvider) (*HistoricalRates, error) {
+		return p.Historical(ctx, date)
+	})
+}
+
+// medianRates merges the live rates of every provider, taking the
+// median for each coin. only answers quoted in the same target
+// currency as the first one are compared.
+func (f *cryptoFailover) medianRates(answers []sourced[*LiveData]) *LiveData {
+	first := answers[0].val
+	quotes := map[string][]float64{}
+	used := make([]sourced[*LiveData], 0, len(answers))
+	for _, a := range answers {
+		if a.val.Target != first.Target {
+			f.logger.Warn("skipping provider with different target", zap.String("provider", a.source), zap.String("target", a.val.Target))
+			continue
+		}
+		used = append(used, a)
+		for coin, rate := range a.val.Rates {
+			quotes[coin] = append(quotes[coin], rate)
+		}
+	}
+
+	live := &LiveData{
+		Timestamp: first.Timestamp,
+		Target:    first.Target,
+		Rates:     make(map[string]float64, len(quotes)),
+		Source:    quorumSource(used),
+	}
+	coins := make([]string, 0, len(quotes))
+	for coin := range quotes {
+		coins = append(coins, coin)
+	}
+	sort.Strings(coins)
+	for _, coin := range coins {
+		rates := quotes[coin]
+		mid := median(rates)
+		if diverges(rates, mid, f.config.Divergence) {
+			warning := fmt.Sprintf("%s rate diverges across providers: %v", coin, rates)
+			f.logger.Warn("quorum divergence", zap.String("warning", warning))
+			live.Warnings = append(live.Warnings, warning)
+		}
+		live.Rates[coin] = mid
+	}
+	return live
+}
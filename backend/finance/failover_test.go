@@ -0,0 +1,70 @@
+package finance
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestMedianEODTakesWholeBar(t *testing.T) {
+	f := &stockFailover{logger: zap.NewNop(), config: FailoverConfig{Divergence: 0.5}}
+	answer := func(source string, bar EOD) sourced[*LatestEOD] {
+		return sourced[*LatestEOD]{source: source, val: &LatestEOD{Data: []EOD{bar}, Source: source}}
+	}
+	tests := []struct {
+		name    string
+		answers []sourced[*LatestEOD]
+		want    EOD
+	}{
+		{
+			name: "odd count takes the median provider",
+			answers: []sourced[*LatestEOD]{
+				answer("a", EOD{Symbol: "AAPL", Date: "2024-01-02", Open: 9, High: 12, Low: 8, Close: 11, Volume: 1}),
+				answer("b", EOD{Symbol: "AAPL", Date: "2024-01-02", Open: 10, High: 10.5, Low: 9.5, Close: 10, Volume: 2}),
+				answer("c", EOD{Symbol: "AAPL", Date: "2024-01-02", Open: 9, High: 9.8, Low: 8.5, Close: 9.5, Volume: 3}),
+			},
+			want: EOD{Symbol: "AAPL", Date: "2024-01-02", Open: 10, High: 10.5, Low: 9.5, Close: 10, Volume: 2},
+		},
+		{
+			name: "even count takes the bar closest to the median",
+			answers: []sourced[*LatestEOD]{
+				answer("a", EOD{Symbol: "AAPL", Date: "2024-01-02", High: 12, Low: 8, Close: 11}),
+				answer("b", EOD{Symbol: "AAPL", Date: "2024-01-02", High: 10, Low: 9, Close: 9.5}),
+				answer("c", EOD{Symbol: "AAPL", Date: "2024-01-02", High: 10.2, Low: 9.9, Close: 10}),
+				answer("d", EOD{Symbol: "AAPL", Date: "2024-01-02", High: 13, Low: 11, Close: 12}),
+			},
+			want: EOD{Symbol: "AAPL", Date: "2024-01-02", High: 12, Low: 8, Close: 11},
+		},
+		{
+			name: "bars of an older day are left out",
+			answers: []sourced[*LatestEOD]{
+				answer("a", EOD{Symbol: "AAPL", Date: "2024-01-01", High: 20, Low: 19, Close: 19.5}),
+				answer("b", EOD{Symbol: "AAPL", Date: "2024-01-02", High: 10, Low: 9, Close: 9.5}),
+			},
+			want: EOD{Symbol: "AAPL", Date: "2024-01-02", High: 10, Low: 9, Close: 9.5},
+		},
+		{
+			name: "the date most recent among several providers wins",
+			answers: []sourced[*LatestEOD]{
+				answer("a", EOD{Symbol: "AAPL", Date: "2024-01-01T00:00:00+0000", High: 20, Low: 19, Close: 19.5}),
+				answer("b", EOD{Symbol: "AAPL", Date: "2024-01-02T00:00:00+0000", High: 10.5, Low: 9, Close: 10}),
+				answer("c", EOD{Symbol: "AAPL", Date: "2024-01-02T00:00:00+0000", High: 10, Low: 9, Close: 9.8}),
+			},
+			want: EOD{Symbol: "AAPL", Date: "2024-01-02T00:00:00+0000", High: 10.5, Low: 9, Close: 10},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := f.medianEOD([]string{"AAPL"}, tt.answers)
+			if len(got.Data) != 1 {
+				t.Fatalf("got %d bars, want 1", len(got.Data))
+			}
+			if got.Data[0] != tt.want {
+				t.Errorf("got %+v, want %+v", got.Data[0], tt.want)
+			}
+			if bar := got.Data[0]; bar.Close < bar.Low || bar.Close > bar.High {
+				t.Errorf("close %v outside [%v, %v]", bar.Close, bar.Low, bar.High)
+			}
+		})
+	}
+}
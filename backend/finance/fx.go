@@ -0,0 +1,286 @@
+package finance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownCurrency = errors.New("unknown currency")
+	ErrNoFXRates       = errors.New("no fx rates loaded")
+)
+
+// FXProvider is a source of fiat exchange rates, given in the same
+// shape as live coin rates: the price of one unit of every currency
+// in Target.
+type FXProvider interface {
+	Name() string
+	Rates(ctx context.Context) (*LiveData, error)
+}
+
+var (
+	_ FXProvider = &erapi{}
+	_ FXProvider = &fileFX{}
+)
+
+// NewFXProvider builds the provider named by FX_PROVIDER. erapi, the
+// default, fetches daily rates from open.er-api.com, "file" rereads
+// FX_RATES_FILE and "none" leaves the table to the seed file alone.
+func NewFXProvider(logger *zap.Logger, client RequestClient) (FXProvider, error) {
+	_ = godotenv.Load()
+	switch name := strings.TrimSpace(os.Getenv("FX_PROVIDER")); name {
+	case "", "erapi":
+		return NewERAPI(logger, client), nil
+	case "file":
+		return NewFileFX(logger, os.Getenv("FX_RATES_FILE")), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+}
+
+type erapi struct {
+	logger  *zap.Logger
+	client  RequestClient
+	baseURL string
+}
+
+func NewERAPI(logger *zap.Logger, client RequestClient) *erapi {
+	return &erapi{
+		logger:  logger,
+		client:  client,
+		baseURL: "https://open.er-api.com/v6",
+	}
+}
+
+func (e *erapi) Name() string {
+	return "erapi"
+}
+
+// Rates fetches USD rates. the vendor quotes units per dollar, which
+// are turned around into dollar prices here.
+func (e *erapi) Rates(ctx context.Context) (*LiveData, error) {
+	body, err := e.client.MakeGetRequest(ctx, http.MethodGet, e.baseURL+"/latest/USD")
+	if err != nil {
+		e.logger.Debug("error fetching fx rates", zap.Any("error", err))
+		return nil, err
+	}
+	var val struct {
+		Result    string             `json:"result"`
+		ErrorType string             `json:"error-type"`
+		Updated   int                `json:"time_last_update_unix"`
+		Base      string             `json:"base_code"`
+		Rates     map[string]float64 `json:"rates"`
+	}
+	if err := json.Unmarshal(body, &val); err != nil {
+		e.logger.Debug("error unmarshalling fx rates", zap.Any("error", err))
+		return nil, err
+	}
+	if val.Result != "success" {
+		return nil, &APIError{Host: "open.er-api.com", Status: http.StatusOK, Code: val.ErrorType, Message: "fx rates not available"}
+	}
+	live := &LiveData{Timestamp: val.Updated, Target: val.Base, Rates: make(map[string]float64, len(val.Rates)), Source: e.Name()}
+	for ccy, perBase := range val.Rates {
+		if perBase > 0 {
+			live.Rates[ccy] = 1 / perBase
+		}
+	}
+	return live, nil
+}
+
+// fileFX reads rates from a coinlayer style json file or a csv of
+// currency,rate rows priced in USD.
+type fileFX struct {
+	logger *zap.Logger
+	path   string
+}
+
+func NewFileFX(logger *zap.Logger, path string) *fileFX {
+	return &fileFX{
+		logger: logger,
+		path:   path,
+	}
+}
+
+func (f *fileFX) Name() string {
+	return "file"
+}
+
+func (f *fileFX) Rates(ctx context.Context) (*LiveData, error) {
+	if f.path == "" {
+		return nil, fmt.Errorf("%w: FX_RATES_FILE is not set", ErrNoFixture)
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		f.logger.Debug("error reading fx rates", zap.Any("error", err))
+		return nil, err
+	}
+	defer file.Close()
+	var val LiveData
+	if strings.EqualFold(filepath.Ext(f.path), ".json") {
+		if err := json.NewDecoder(file).Decode(&val); err != nil {
+			f.logger.Debug("error unmarshalling fx rates", zap.Any("error", err))
+			return nil, err
+		}
+	} else {
+		stat, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		rates, err := readRatesCSV(file)
+		if err != nil {
+			f.logger.Debug("error parsing fx rates csv", zap.Any("error", err))
+			return nil, err
+		}
+		val = LiveData{Timestamp: int(stat.ModTime().Unix()), Target: "USD", Rates: rates}
+	}
+	val.Source = f.Name()
+	return &val, nil
+}
+
+// FX is the local table of fiat rates. it is seeded once and then kept
+// up to date from its provider, keeping the last good table when a
+// refresh fails.
+type FX struct {
+	logger   *zap.Logger
+	provider FXProvider
+	refresh  time.Duration
+
+	mu    sync.RWMutex
+	rates *LiveData
+}
+
+// NewFX keeps rates from provider, which may be nil for a table that
+// only ever holds its seed.
+func NewFX(logger *zap.Logger, provider FXProvider, refresh time.Duration) *FX {
+	return &FX{
+		logger:   logger,
+		provider: provider,
+		refresh:  refresh,
+	}
+}
+
+// FXRefreshFromEnv reads FX_REFRESH, twelve hours by default.
+func FXRefreshFromEnv() time.Duration {
+	if v, err := time.ParseDuration(os.Getenv("FX_REFRESH")); err == nil && v > 0 {
+		return v
+	}
+	return 12 * time.Hour
+}
+
+// Seed loads the table from a rates file before the provider has been
+// asked. an empty path is ignored.
+func (x *FX) Seed(ctx context.Context, path string) error {
+	if path == "" {
+		return nil
+	}
+	rates, err := NewFileFX(x.logger, path).Rates(ctx)
+	if err != nil {
+		return err
+	}
+	x.set(rates)
+	return nil
+}
+
+func (x *FX) Refresh(ctx context.Context) error {
+	if x.provider == nil {
+		return nil
+	}
+	rates, err := x.provider.Rates(ctx)
+	if err != nil {
+		return err
+	}
+	x.set(rates)
+	return nil
+}
+
+// Run refreshes the table now and then every refresh interval until
+// ctx is done.
+func (x *FX) Run(ctx context.Context) {
+	if x.provider == nil {
+		return
+	}
+	if err := x.Refresh(ctx); err != nil {
+		x.logger.Warn("could not load fx rates", zap.Any("error", err))
+	}
+	t := time.NewTicker(x.refresh)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := x.Refresh(ctx); err != nil {
+				x.logger.Warn("could not refresh fx rates", zap.Any("error", err))
+			}
+		}
+	}
+}
+
+func (x *FX) set(rates *LiveData) {
+	upper := make(map[string]float64, len(rates.Rates))
+	for ccy, rate := range rates.Rates {
+		upper[strings.ToUpper(ccy)] = rate
+	}
+	rates.Rates = upper
+	rates.Target = strings.ToUpper(rates.Target)
+	x.mu.Lock()
+	x.rates = rates
+	x.mu.Unlock()
+}
+
+// Rates is the current table.
+func (x *FX) Rates() (*LiveData, error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if x.rates == nil {
+		return nil, ErrNoFXRates
+	}
+	return x.rates, nil
+}
+
+// Has tells whether ccy is a currency in the table.
+func (x *FX) Has(ccy string) bool {
+	rates, err := x.Rates()
+	if err != nil {
+		return false
+	}
+	_, ok := rates.Rates[ccy]
+	return ok || ccy == rates.Target
+}
+
+// Price is what one unit of ccy costs in the currency in.
+func (x *FX) Price(ccy string, in string) (Decimal, error) {
+	rates, err := x.Rates()
+	if err != nil {
+		return Decimal{}, err
+	}
+	price := func(c string) (Decimal, error) {
+		p, err := rates.rate(c)
+		if errors.Is(err, ErrUnknownCoin) {
+			return Decimal{}, fmt.Errorf("%w: %s", ErrUnknownCurrency, c)
+		}
+		return p, err
+	}
+	of, err := price(ccy)
+	if err != nil {
+		return Decimal{}, err
+	}
+	base, err := price(in)
+	if err != nil {
+		return Decimal{}, err
+	}
+	return of.Quo(base), nil
+}
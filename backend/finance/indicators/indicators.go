@@ -0,0 +1,323 @@
+package indicators
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
+)
+
+// every function here returns a slice aligned with its input.
+// values that cannot be computed yet (the warm up period) are NaN
+// and are left out when a Result is built.
+
+var (
+	ErrUnknownIndicator = errors.New("unknown indicator")
+	ErrInvalidPeriod    = errors.New("period must be positive")
+)
+
+// Params tunes an indicator. zero values fall back to the usual
+// defaults: 20 for SMA, EMA and Bollinger Bands, 14 for RSI and
+// ATR, 12/26/9 for MACD and 2 standard deviations for the bands.
+// a zero VWAP period anchors VWAP to each trading day.
+type Params struct {
+	Period int
+	Fast   int
+	Slow   int
+	Signal int
+	StdDev float64
+}
+
+type Point struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+type Result struct {
+	Indicator string             `json:"indicator"`
+	Params    Params             `json:"params"`
+	Lines     map[string][]Point `json:"lines"`
+}
+
+// Names lists the indicators Compute understands.
+var Names = []string{"sma", "ema", "rsi", "macd", "bollinger", "atr", "vwap"}
+
+// Compute runs the named indicator over bars, which must be oldest first.
+func Compute(name string, bars []finance.Bar, params Params) (*Result, error) {
+	if params.Period < 0 || params.Fast < 0 || params.Slow < 0 || params.Signal < 0 {
+		return nil, ErrInvalidPeriod
+	}
+	name = strings.ToLower(name)
+	closes := finance.Closes(bars)
+	res := &Result{Indicator: name, Lines: map[string][]Point{}}
+	switch name {
+	case "sma":
+		params.Period = orDefault(params.Period, 20)
+		res.Lines["sma"] = points(bars, SMA(closes, params.Period))
+	case "ema":
+		params.Period = orDefault(params.Period, 20)
+		res.Lines["ema"] = points(bars, EMA(closes, params.Period))
+	case "rsi":
+		params.Period = orDefault(params.Period, 14)
+		res.Lines["rsi"] = points(bars, RSI(closes, params.Period))
+	case "macd":
+		params.Fast = orDefault(params.Fast, 12)
+		params.Slow = orDefault(params.Slow, 26)
+		params.Signal = orDefault(params.Signal, 9)
+		if params.Fast >= params.Slow {
+			return nil, fmt.Errorf("%w: fast period must be shorter than slow", ErrInvalidPeriod)
+		}
+		macd, signal, hist := MACD(closes, params.Fast, params.Slow, params.Signal)
+		res.Lines["macd"] = points(bars, macd)
+		res.Lines["signal"] = points(bars, signal)
+		res.Lines["histogram"] = points(bars, hist)
+	case "bollinger":
+		params.Period = orDefault(params.Period, 20)
+		if params.StdDev <= 0 {
+			params.StdDev = 2
+		}
+		middle, upper, lower := Bollinger(closes, params.Period, params.StdDev)
+		res.Lines["middle"] = points(bars, middle)
+		res.Lines["upper"] = points(bars, upper)
+		res.Lines["lower"] = points(bars, lower)
+	case "atr":
+		params.Period = orDefault(params.Period, 14)
+		res.Lines["atr"] = points(bars, ATR(bars, params.Period))
+	case "vwap":
+		res.Lines["vwap"] = points(bars, VWAP(bars, params.Period))
+	default:
+		return nil, fmt.Errorf("%w: %q, want one of %s", ErrUnknownIndicator, name, strings.Join(Names, ", "))
+	}
+	res.Params = params
+	return res, nil
+}
+
+func orDefault(v int, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+func points(bars []finance.Bar, vals []float64) []Point {
+	out := make([]Point, 0, len(vals))
+	for i, v := range vals {
+		if math.IsNaN(v) {
+			continue
+		}
+		out = append(out, Point{Time: bars[i].Time, Value: v})
+	}
+	return out
+}
+
+func nans(n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = math.NaN()
+	}
+	return out
+}
+
+// SMA is the simple moving average over period values.
+func SMA(vals []float64, period int) []float64 {
+	out := nans(len(vals))
+	if period <= 0 {
+		return out
+	}
+	var sum float64
+	for i, v := range vals {
+		sum += v
+		if i >= period {
+			sum -= vals[i-period]
+		}
+		if i >= period-1 {
+			out[i] = sum / float64(period)
+		}
+	}
+	return out
+}
+
+// EMA is the exponential moving average, seeded with the SMA of the
+// first period values. NaN inputs are skipped so EMA can be chained
+// onto another indicator's output.
+func EMA(vals []float64, period int) []float64 {
+	out := nans(len(vals))
+	if period <= 0 {
+		return out
+	}
+	k := 2 / float64(period+1)
+	var (
+		seen int
+		sum  float64
+		prev float64
+	)
+	for i, v := range vals {
+		if math.IsNaN(v) {
+			continue
+		}
+		seen++
+		switch {
+		case seen < period:
+			sum += v
+		case seen == period:
+			sum += v
+			prev = sum / float64(period)
+			out[i] = prev
+		default:
+			prev = v*k + prev*(1-k)
+			out[i] = prev
+		}
+	}
+	return out
+}
+
+// RSI is Wilder's relative strength index.
+func RSI(closes []float64, period int) []float64 {
+	out := nans(len(closes))
+	if period <= 0 || len(closes) <= period {
+		return out
+	}
+	var gain, loss float64
+	for i := 1; i <= period; i++ {
+		change := closes[i] - closes[i-1]
+		if change > 0 {
+			gain += change
+		} else {
+			loss -= change
+		}
+	}
+	gain /= float64(period)
+	loss /= float64(period)
+	out[period] = rsi(gain, loss)
+	for i := period + 1; i < len(closes); i++ {
+		change := closes[i] - closes[i-1]
+		up, down := 0.0, 0.0
+		if change > 0 {
+			up = change
+		} else {
+			down = -change
+		}
+		gain = (gain*float64(period-1) + up) / float64(period)
+		loss = (loss*float64(period-1) + down) / float64(period)
+		out[i] = rsi(gain, loss)
+	}
+	return out
+}
+
+func rsi(gain float64, loss float64) float64 {
+	if loss == 0 {
+		if gain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+gain/loss)
+}
+
+// MACD returns the macd line (fast EMA minus slow EMA), its signal
+// EMA and the histogram between the two.
+func MACD(closes []float64, fast int, slow int, signal int) ([]float64, []float64, []float64) {
+	fastEMA := EMA(closes, fast)
+	slowEMA := EMA(closes, slow)
+	macd := nans(len(closes))
+	for i := range closes {
+		if !math.IsNaN(fastEMA[i]) && !math.IsNaN(slowEMA[i]) {
+			macd[i] = fastEMA[i] - slowEMA[i]
+		}
+	}
+	sig := EMA(macd, signal)
+	hist := nans(len(closes))
+	for i := range closes {
+		if !math.IsNaN(macd[i]) && !math.IsNaN(sig[i]) {
+			hist[i] = macd[i] - sig[i]
+		}
+	}
+	return macd, sig, hist
+}
+
+// Bollinger returns the middle SMA and the bands k population
+// standard deviations above and below it.
+func Bollinger(closes []float64, period int, k float64) ([]float64, []float64, []float64) {
+	middle := SMA(closes, period)
+	upper := nans(len(closes))
+	lower := nans(len(closes))
+	for i := range closes {
+		if math.IsNaN(middle[i]) {
+			continue
+		}
+		var variance float64
+		for _, v := range closes[i-period+1 : i+1] {
+			variance += (v - middle[i]) * (v - middle[i])
+		}
+		sd := math.Sqrt(variance / float64(period))
+		upper[i] = middle[i] + k*sd
+		lower[i] = middle[i] - k*sd
+	}
+	return middle, upper, lower
+}
+
+// ATR is Wilder's average true range.
+func ATR(bars []finance.Bar, period int) []float64 {
+	out := nans(len(bars))
+	if period <= 0 || len(bars) < period {
+		return out
+	}
+	tr := make([]float64, len(bars))
+	for i, b := range bars {
+		tr[i] = b.High - b.Low
+		if i > 0 {
+			prev := bars[i-1].Close
+			tr[i] = math.Max(tr[i], math.Max(math.Abs(b.High-prev), math.Abs(b.Low-prev)))
+		}
+	}
+	var atr float64
+	for i := 0; i < period; i++ {
+		atr += tr[i]
+	}
+	atr /= float64(period)
+	out[period-1] = atr
+	for i := period; i < len(bars); i++ {
+		atr = (atr*float64(period-1) + tr[i]) / float64(period)
+		out[i] = atr
+	}
+	return out
+}
+
+// VWAP is the volume weighted typical price. with a positive period
+// it rolls over that many bars, otherwise it restarts every day.
+func VWAP(bars []finance.Bar, period int) []float64 {
+	out := nans(len(bars))
+	var pv, vol float64
+	for i, b := range bars {
+		if period <= 0 && i > 0 && !sameDay(b.Time, bars[i-1].Time) {
+			pv, vol = 0, 0
+		}
+		pv += typical(b) * b.Volume
+		vol += b.Volume
+		if period > 0 && i >= period {
+			old := bars[i-period]
+			pv -= typical(old) * old.Volume
+			vol -= old.Volume
+		}
+		if period > 0 && i < period-1 {
+			continue
+		}
+		if vol > 0 {
+			out[i] = pv / vol
+		}
+	}
+	return out
+}
+
+func typical(b finance.Bar) float64 {
+	return (b.High + b.Low + b.Close) / 3
+}
+
+func sameDay(a time.Time, b time.Time) bool {
+	ay, am, ad := a.UTC().Date()
+	by, bm, bd := b.UTC().Date()
+	return ay == by && am == bm && ad == bd
+}
@@ -0,0 +1,164 @@
+package indicators
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
+)
+
+var nan = math.NaN()
+
+// same compares two indicator outputs, NaN matching NaN.
+func same(t *testing.T, name string, got []float64, want []float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %d values, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		if math.IsNaN(want[i]) != math.IsNaN(got[i]) || (!math.IsNaN(want[i]) && math.Abs(got[i]-want[i]) > 1e-9) {
+			t.Errorf("%s[%d] = %v, want %v", name, i, got[i], want[i])
+		}
+	}
+}
+
+func flat(at time.Time, price float64, volume float64) finance.Bar {
+	return finance.Bar{Time: at, Open: price, High: price, Low: price, Close: price, Volume: volume}
+}
+
+func TestMovingAverages(t *testing.T) {
+	tests := []struct {
+		name   string
+		fn     func([]float64, int) []float64
+		vals   []float64
+		period int
+		want   []float64
+	}{
+		{"sma", SMA, []float64{1, 2, 3, 4, 5}, 3, []float64{nan, nan, 2, 3, 4}},
+		{"sma longer than input", SMA, []float64{1, 2}, 3, []float64{nan, nan}},
+		{"sma zero period", SMA, []float64{1, 2}, 0, []float64{nan, nan}},
+		{"ema seeded with sma", EMA, []float64{1, 2, 3, 4, 5}, 3, []float64{nan, nan, 2, 3, 4}},
+		{"ema skips leading nan", EMA, []float64{nan, 1, 2, 3}, 2, []float64{nan, nan, 1.5, 2.5}},
+		{"rsi only gains", RSI, []float64{1, 2, 3, 4}, 2, []float64{nan, nan, 100, 100}},
+		{"rsi no change", RSI, []float64{5, 5, 5}, 2, []float64{nan, nan, 50}},
+		{"rsi wilder smoothing", RSI, []float64{1, 2, 1, 2}, 2, []float64{nan, nan, 50, 75}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			same(t, tt.name, tt.fn(tt.vals, tt.period), tt.want)
+		})
+	}
+}
+
+func TestMACD(t *testing.T) {
+	macd, signal, hist := MACD([]float64{1, 2, 3, 4, 5, 6}, 2, 3, 2)
+	same(t, "macd", macd, []float64{nan, nan, 0.5, 0.5, 0.5, 0.5})
+	same(t, "signal", signal, []float64{nan, nan, nan, 0.5, 0.5, 0.5})
+	same(t, "histogram", hist, []float64{nan, nan, nan, 0, 0, 0})
+}
+
+func TestBollinger(t *testing.T) {
+	sd := math.Sqrt(2.0 / 3)
+	tests := []struct {
+		name                 string
+		closes               []float64
+		middle, upper, lower []float64
+	}{
+		{
+			name:   "constant closes give no width",
+			closes: []float64{4, 4, 4},
+			middle: []float64{nan, 4, 4},
+			upper:  []float64{nan, 4, 4},
+			lower:  []float64{nan, 4, 4},
+		},
+		{
+			name:   "population standard deviation",
+			closes: []float64{1, 2, 3},
+			middle: []float64{nan, 1.5, 2.5},
+			upper:  []float64{nan, 2.5, 3.5},
+			lower:  []float64{nan, 0.5, 1.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middle, upper, lower := Bollinger(tt.closes, 2, 2)
+			same(t, "middle", middle, tt.middle)
+			same(t, "upper", upper, tt.upper)
+			same(t, "lower", lower, tt.lower)
+		})
+	}
+	_, upper, _ := Bollinger([]float64{1, 2, 3}, 3, 2)
+	same(t, "upper over 3", upper, []float64{nan, nan, 2 + 2*sd})
+}
+
+func TestATR(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := []finance.Bar{
+		{Time: day, High: 2, Low: 1, Close: 1.5},
+		{Time: day.AddDate(0, 0, 1), High: 3, Low: 2, Close: 2.5},
+		{Time: day.AddDate(0, 0, 2), High: 4, Low: 3, Close: 3.5},
+	}
+	// true ranges 1, 1.5 (gap from the previous close) and 1.5
+	same(t, "atr", ATR(bars, 2), []float64{nan, 1.25, 1.375})
+	same(t, "atr longer than input", ATR(bars, 4), []float64{nan, nan, nan})
+}
+
+func TestVWAP(t *testing.T) {
+	day := time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		bars   []finance.Bar
+		period int
+		want   []float64
+	}{
+		{
+			name:   "rolling",
+			bars:   []finance.Bar{flat(day, 1, 1), flat(day.Add(time.Hour), 2, 1), flat(day.Add(2*time.Hour), 3, 2)},
+			period: 2,
+			want:   []float64{nan, 1.5, 8.0 / 3},
+		},
+		{
+			name:   "anchored restarts each day",
+			bars:   []finance.Bar{flat(day, 1, 1), flat(day.Add(time.Hour), 3, 1), flat(day.AddDate(0, 0, 1), 10, 5)},
+			period: 0,
+			want:   []float64{1, 2, 10},
+		},
+		{
+			name:   "no volume",
+			bars:   []finance.Bar{flat(day, 1, 0)},
+			period: 0,
+			want:   []float64{nan},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			same(t, tt.name, VWAP(tt.bars, tt.period), tt.want)
+		})
+	}
+}
+
+func TestCompute(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := []finance.Bar{flat(day, 1, 1), flat(day.AddDate(0, 0, 1), 2, 1), flat(day.AddDate(0, 0, 2), 3, 1)}
+
+	res, err := Compute("SMA", bars, Params{Period: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	points := res.Lines["sma"]
+	if len(points) != 2 || !points[0].Time.Equal(bars[1].Time) || points[0].Value != 1.5 || points[1].Value != 2.5 {
+		t.Errorf("sma points = %+v, want the warm up left out", points)
+	}
+
+	if _, err := Compute("macd", bars, Params{Fast: 26, Slow: 12}); !errors.Is(err, ErrInvalidPeriod) {
+		t.Errorf("macd with fast >= slow: got %v, want ErrInvalidPeriod", err)
+	}
+	if _, err := Compute("nope", bars, Params{}); !errors.Is(err, ErrUnknownIndicator) {
+		t.Errorf("unknown indicator: got %v, want ErrUnknownIndicator", err)
+	}
+	if _, err := Compute("sma", bars, Params{Period: -1}); !errors.Is(err, ErrInvalidPeriod) {
+		t.Errorf("negative period: got %v, want ErrInvalidPeriod", err)
+	}
+}
@@ -0,0 +1,189 @@
+package finance
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+var ErrMalformedBar = errors.New("malformed bar")
+
+// Number is a price or size that the vendor may send as a number,
+// a numeric string, an empty string or null. Valid is false for the
+// last two, and NaN or infinite values are refused. it stores as a
+// nullable column and encodes back as a plain number or null.
+type Number struct {
+	Float64 float64
+	Valid   bool
+}
+
+func NewNumber(v float64) Number {
+	return Number{Float64: v, Valid: true}
+}
+
+func (n *Number) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		*n = Number{}
+		return nil
+	}
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		if s == "" {
+			*n = Number{}
+			return nil
+		}
+		b = []byte(s)
+	}
+	v, err := strconv.ParseFloat(string(b), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("%w: %s is not a finite number", ErrMalformedBar, b)
+	}
+	*n = NewNumber(v)
+	return nil
+}
+
+func (n Number) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.Float64)
+}
+
+func (n *Number) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*n = Number{}
+	case float64:
+		*n = NewNumber(v)
+	case int64:
+		*n = NewNumber(float64(v))
+	case []byte:
+		return n.UnmarshalJSON(v)
+	case string:
+		return n.UnmarshalJSON([]byte(v))
+	default:
+		return fmt.Errorf("cannot scan %T into Number", src)
+	}
+	return nil
+}
+
+func (n Number) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Float64, nil
+}
+
+type Intraday struct {
+	Data   IntradayData `json:"data"`
+	Source string       `json:"source,omitempty"`
+}
+
+// IntradayData holds the bars that decoded and validated cleanly in
+// Intraday and reports every other row in Malformed instead of failing
+// the whole response.
+type IntradayData struct {
+	Name        string         `json:"name"`
+	Symbol      string         `json:"symbol"`
+	Country     string         `json:"country"`
+	HasIntraday bool           `json:"has_intraday"`
+	HasEOD      bool           `json:"has_eod"`
+	Intraday    []IntradayBar  `json:"intraday"`
+	Malformed   []MalformedRow `json:"malformed,omitempty"`
+}
+
+type MalformedRow struct {
+	Index int             `json:"index"`
+	Error string          `json:"error"`
+	Row   json.RawMessage `json:"row"`
+}
+
+func (d *IntradayData) UnmarshalJSON(b []byte) error {
+	// plain has no methods, so decoding into it does not recurse here
+	type plain IntradayData
+	var raw struct {
+		plain
+		Intraday []json.RawMessage `json:"intraday"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*d = IntradayData(raw.plain)
+	d.Intraday, d.Malformed = decodeIntradayRows(raw.Intraday, d.Malformed)
+	return nil
+}
+
+// decodeIntradayRows keeps the rows that decode and validate and adds
+// the rest to malformed.
+func decodeIntradayRows(rows []json.RawMessage, malformed []MalformedRow) ([]IntradayBar, []MalformedRow) {
+	bars := make([]IntradayBar, 0, len(rows))
+	for i, row := range rows {
+		var bar IntradayBar
+		err := json.Unmarshal(row, &bar)
+		if err == nil {
+			err = bar.Validate()
+		}
+		if err != nil {
+			malformed = append(malformed, MalformedRow{Index: i, Error: err.Error(), Row: row})
+			continue
+		}
+		bars = append(bars, bar)
+	}
+	return bars, malformed
+}
+
+type IntradayBar struct {
+	Open     Number `json:"open"`
+	High     Number `json:"high"`
+	Low      Number `json:"low"`
+	Last     Number `json:"last"`
+	Close    Number `json:"close"`
+	Volume   Number `json:"volume"`
+	Date     string `json:"date"`
+	Symbol   string `json:"symbol"`
+	Exchange string `json:"exchange"`
+	Source   string `json:"source,omitempty"`
+}
+
+// Time parses the vendor timestamp of the bar.
+func (b IntradayBar) Time() (time.Time, error) {
+	return time.Parse(vendorTimeLayout, b.Date)
+}
+
+// Price is the close of the bar, or the last trade while the vendor
+// has not closed it yet.
+func (b IntradayBar) Price() Number {
+	if b.Close.Valid {
+		return b.Close
+	}
+	return b.Last
+}
+
+// Validate checks the bar can be used: a readable date, a price and
+// a high that is not below the low.
+func (b IntradayBar) Validate() error {
+	if _, err := b.Time(); err != nil {
+		return fmt.Errorf("%w: date %q", ErrMalformedBar, b.Date)
+	}
+	if !b.Price().Valid {
+		return fmt.Errorf("%w: no close or last price", ErrMalformedBar)
+	}
+	if b.High.Valid && b.Low.Valid && b.High.Float64 < b.Low.Float64 {
+		return fmt.Errorf("%w: high %v below low %v", ErrMalformedBar, b.High.Float64, b.Low.Float64)
+	}
+	for name, n := range map[string]Number{"open": b.Open, "high": b.High, "low": b.Low, "volume": b.Volume} {
+		if n.Valid && n.Float64 < 0 {
+			return fmt.Errorf("%w: negative %s", ErrMalformedBar, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package finance
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNumberUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Number
+		wantErr bool
+	}{
+		{in: `12.5`, want: NewNumber(12.5)},
+		{in: `"12.5"`, want: NewNumber(12.5)},
+		{in: `null`, want: Number{}},
+		{in: `""`, want: Number{}},
+		{in: `"abc"`, wantErr: true},
+		{in: `"NaN"`, wantErr: true},
+		{in: `"nan"`, wantErr: true},
+		{in: `"Inf"`, wantErr: true},
+		{in: `"-Infinity"`, wantErr: true},
+		{in: `1e400`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var n Number
+			err := n.UnmarshalJSON([]byte(tt.in))
+			if tt.wantErr {
+				if !errors.Is(err, ErrMalformedBar) {
+					t.Fatalf("got %v, %v, want ErrMalformedBar", n, err)
+				}
+				return
+			}
+			if err != nil || n != tt.want {
+				t.Fatalf("got %v, %v, want %v", n, err, tt.want)
+			}
+		})
+	}
+}
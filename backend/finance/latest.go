@@ -0,0 +1,105 @@
+package finance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// marketstack takes at most this many symbols per request
+const maxSymbolsPerRequest = 100
+
+var ErrSymbolNotFound = errors.New("symbol not found")
+
+// LatestEOD is the most recent EOD bar of several symbols. symbols
+// the provider had nothing for are listed in Missing.
+type LatestEOD struct {
+	Data     []EOD    `json:"data"`
+	Missing  []string `json:"missing,omitempty"`
+	Source   string   `json:"source,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// LatestIntraday is the most recent intraday bar of several symbols.
+type LatestIntraday struct {
+	Data      []IntradayBar  `json:"data"`
+	Malformed []MalformedRow `json:"malformed,omitempty"`
+	Missing   []string       `json:"missing,omitempty"`
+	Source    string         `json:"source,omitempty"`
+}
+
+func (l *LatestIntraday) UnmarshalJSON(b []byte) error {
+	type plain LatestIntraday
+	var raw struct {
+		plain
+		Data []json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*l = LatestIntraday(raw.plain)
+	l.Data, l.Malformed = decodeIntradayRows(raw.Data, l.Malformed)
+	return nil
+}
+
+// ParseSymbols splits a comma separated list into upper case
+// symbols, dropping blanks and repeats.
+func ParseSymbols(v string) []string {
+	seen := map[string]bool{}
+	symbols := make([]string, 0)
+	for _, s := range strings.Split(v, ",") {
+		s = strings.ToUpper(strings.TrimSpace(s))
+		if s == "" || seen[s] {
+			continue
+		}
+		seen[s] = true
+		symbols = append(symbols, s)
+	}
+	return symbols
+}
+
+// missingSymbols lists the requested symbols that found returns false for.
+func missingSymbols(symbols []string, found func(string) bool) []string {
+	missing := make([]string, 0)
+	for _, s := range symbols {
+		if !found(s) {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+func chunkSymbols(symbols []string) [][]string {
+	chunks := make([][]string, 0, len(symbols)/maxSymbolsPerRequest+1)
+	for len(symbols) > maxSymbolsPerRequest {
+		chunks = append(chunks, symbols[:maxSymbolsPerRequest])
+		symbols = symbols[maxSymbolsPerRequest:]
+	}
+	if len(symbols) > 0 {
+		chunks = append(chunks, symbols)
+	}
+	return chunks
+}
+
+func (l *LatestEOD) find(symbol string) (*EOD, error) {
+	for i := range l.Data {
+		if strings.EqualFold(l.Data[i].Symbol, symbol) {
+			bar := l.Data[i]
+			bar.Source = l.Source
+			return &bar, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+}
+
+func (l *LatestIntraday) find(symbol string) (*IntradayBar, error) {
+	for i := range l.Data {
+		if strings.EqualFold(l.Data[i].Symbol, symbol) {
+			bar := l.Data[i]
+			bar.Source = l.Source
+			return &bar, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSymbolNotFound, symbol)
+}
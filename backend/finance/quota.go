@@ -0,0 +1,237 @@
+package finance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+var ErrQuotaExceeded = errors.New("upstream quota exceeded")
+
+// quotaProviders names the vendors we account for by api host.
+var quotaProviders = map[string]string{
+	"api.marketstack.com": "marketstack",
+	"api.coinlayer.com":   "coinlayer",
+	"open.er-api.com":     "erapi",
+}
+
+// QuotaLimit is the call budget of one access key. zero means no limit.
+type QuotaLimit struct {
+	PerSecond float64 `json:"per_second"`
+	PerMonth  int     `json:"per_month"`
+}
+
+type QuotaConfig struct {
+	Limits map[string]QuotaLimit
+	// Queue holds calls over the per second budget for up to MaxWait
+	// instead of rejecting them straight away
+	Queue   bool
+	MaxWait time.Duration
+}
+
+// QuotaConfigFromEnv reads <PROVIDER>_PER_SECOND and <PROVIDER>_PER_MONTH
+// for every provider we know, plus QUOTA_OVERFLOW and QUOTA_MAX_WAIT.
+func QuotaConfigFromEnv() QuotaConfig {
+	_ = godotenv.Load()
+	cfg := QuotaConfig{
+		Limits:  map[string]QuotaLimit{},
+		Queue:   true,
+		MaxWait: 5 * time.Second,
+	}
+	for _, provider := range quotaProviders {
+		prefix := strings.ToUpper(provider)
+		var limit QuotaLimit
+		if v, err := strconv.ParseFloat(os.Getenv(prefix+"_PER_SECOND"), 64); err == nil && v > 0 {
+			limit.PerSecond = v
+		}
+		if v, err := strconv.Atoi(os.Getenv(prefix + "_PER_MONTH")); err == nil && v > 0 {
+			limit.PerMonth = v
+		}
+		cfg.Limits[provider] = limit
+	}
+	if os.Getenv("QUOTA_OVERFLOW") == "reject" {
+		cfg.Queue = false
+	}
+	if v, err := time.ParseDuration(os.Getenv("QUOTA_MAX_WAIT")); err == nil && v >= 0 {
+		cfg.MaxWait = v
+	}
+	return cfg
+}
+
+// QuotaTracker counts the calls made with every provider and access
+// key and holds back the ones over budget. counts live in memory and
+// start again from zero on restart and at the start of every month.
+type QuotaTracker struct {
+	config   QuotaConfig
+	mu       sync.Mutex
+	accounts map[string]*quotaAccount
+}
+
+type quotaAccount struct {
+	provider string
+	key      string
+	month    string
+	used     int
+	queued   int
+	rejected int
+	// next is the earliest time the per second budget allows a call
+	next time.Time
+}
+
+type QuotaUsage struct {
+	Provider  string     `json:"provider"`
+	Key       string     `json:"key"`
+	Month     string     `json:"month"`
+	Used      int        `json:"used"`
+	Remaining *int       `json:"remaining,omitempty"`
+	Queued    int        `json:"queued"`
+	Rejected  int        `json:"rejected"`
+	Limit     QuotaLimit `json:"limit"`
+}
+
+func NewQuotaTracker(config QuotaConfig) *QuotaTracker {
+	return &QuotaTracker{
+		config:   config,
+		accounts: map[string]*quotaAccount{},
+	}
+}
+
+// acquire books a call to rawURL against its budget, sleeping while it
+// is queued. it fails with ErrQuotaExceeded when the month is used up
+// or the call would have to wait longer than MaxWait.
+func (q *QuotaTracker) acquire(ctx context.Context, rawURL string) error {
+	provider, key := quotaIdentity(rawURL)
+	limit := q.config.Limits[provider]
+	now := time.Now()
+
+	q.mu.Lock()
+	a := q.account(provider, key, now)
+	if limit.PerMonth > 0 && a.used >= limit.PerMonth {
+		a.rejected++
+		q.mu.Unlock()
+		return fmt.Errorf("%w: %s monthly budget of %d calls used up", ErrQuotaExceeded, provider, limit.PerMonth)
+	}
+	var wait time.Duration
+	if limit.PerSecond > 0 {
+		at := a.next
+		if at.Before(now) {
+			at = now
+		}
+		wait = at.Sub(now)
+		if wait > 0 && (!q.config.Queue || wait > q.config.MaxWait) {
+			a.rejected++
+			q.mu.Unlock()
+			return fmt.Errorf("%w: %s allows %v calls per second", ErrQuotaExceeded, provider, limit.PerSecond)
+		}
+		if wait > 0 {
+			a.queued++
+		}
+		a.next = at.Add(time.Duration(float64(time.Second) / limit.PerSecond))
+	}
+	a.used++
+	q.mu.Unlock()
+
+	if wait == 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		// the slot stays booked, the vendor will not know either way
+		return ctx.Err()
+	case <-time.After(wait):
+		return nil
+	}
+}
+
+func (q *QuotaTracker) account(provider string, key string, now time.Time) *quotaAccount {
+	id := provider + "|" + key
+	a, ok := q.accounts[id]
+	if !ok {
+		a = &quotaAccount{provider: provider, key: key}
+		q.accounts[id] = a
+	}
+	if month := now.UTC().Format("2006-01"); a.month != month {
+		a.month = month
+		a.used = 0
+		a.queued = 0
+		a.rejected = 0
+	}
+	return a
+}
+
+// Usage reports the consumption of every provider and key so far this
+// month.
+func (q *QuotaTracker) Usage() []QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	usage := make([]QuotaUsage, 0, len(q.accounts))
+	for _, a := range q.accounts {
+		u := QuotaUsage{
+			Provider: a.provider,
+			Key:      a.key,
+			Month:    a.month,
+			Used:     a.used,
+			Queued:   a.queued,
+			Rejected: a.rejected,
+			Limit:    q.config.Limits[a.provider],
+		}
+		if u.Limit.PerMonth > 0 {
+			remaining := u.Limit.PerMonth - a.used
+			u.Remaining = &remaining
+		}
+		usage = append(usage, u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Provider != usage[j].Provider {
+			return usage[i].Provider < usage[j].Provider
+		}
+		return usage[i].Key < usage[j].Key
+	})
+	return usage
+}
+
+// Remaining is the fewest calls any key of provider has left this
+// month, false when provider has no monthly limit.
+func (q *QuotaTracker) Remaining(provider string) (int, bool) {
+	limit := q.config.Limits[provider]
+	if limit.PerMonth <= 0 {
+		return 0, false
+	}
+	month := time.Now().UTC().Format("2006-01")
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	remaining := limit.PerMonth
+	for _, a := range q.accounts {
+		if a.provider == provider && a.month == month && limit.PerMonth-a.used < remaining {
+			remaining = limit.PerMonth - a.used
+		}
+	}
+	return remaining, true
+}
+
+// quotaIdentity names the provider behind rawURL and masks its access
+// key down to the last four characters.
+func quotaIdentity(rawURL string) (string, string) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "unknown", ""
+	}
+	provider, ok := quotaProviders[u.Hostname()]
+	if !ok {
+		provider = u.Hostname()
+	}
+	key := u.Query().Get("access_key")
+	if len(key) > 4 {
+		key = strings.Repeat("*", len(key)-4) + key[len(key)-4:]
+	}
+	return provider, key
+}
@@ -0,0 +1,104 @@
+package finance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+const (
+	quotaURL      = "https://api.marketstack.com/v1/eod?access_key=abcdefgh1234&symbols=AAPL"
+	otherQuotaURL = "https://api.marketstack.com/v1/eod?access_key=zyxwvuts9876&symbols=AAPL"
+)
+
+func TestQuotaMonthlyBudget(t *testing.T) {
+	q := NewQuotaTracker(QuotaConfig{Limits: map[string]QuotaLimit{"marketstack": {PerMonth: 2}}})
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if err := q.acquire(ctx, quotaURL); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+	if err := q.acquire(ctx, quotaURL); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("got %v over the budget, want ErrQuotaExceeded", err)
+	}
+	// every access key has a budget of its own
+	if err := q.acquire(ctx, otherQuotaURL); err != nil {
+		t.Errorf("other key: %v", err)
+	}
+	if remaining, limited := q.Remaining("marketstack"); !limited || remaining != 0 {
+		t.Errorf("got %d remaining, limited %v, want 0 of a limited budget", remaining, limited)
+	}
+
+	usage := q.Usage()
+	if len(usage) != 2 || usage[0].Key != "********1234" || usage[0].Used != 2 || usage[0].Rejected != 1 {
+		t.Errorf("got usage %+v, want the first key at 2 used and 1 rejected", usage)
+	}
+
+	// the budget starts again with the month
+	a := q.account("marketstack", "********1234", time.Now().UTC().AddDate(0, 1, 0))
+	if a.used != 0 || a.rejected != 0 {
+		t.Errorf("got %d used, %d rejected in a new month, want 0", a.used, a.rejected)
+	}
+}
+
+func TestQuotaPerSecondBudget(t *testing.T) {
+	limits := map[string]QuotaLimit{"marketstack": {PerSecond: 10}}
+	ctx := context.Background()
+
+	t.Run("rejected", func(t *testing.T) {
+		q := NewQuotaTracker(QuotaConfig{Limits: limits})
+		if err := q.acquire(ctx, quotaURL); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.acquire(ctx, quotaURL); !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("got %v for a second call at once, want ErrQuotaExceeded", err)
+		}
+	})
+
+	t.Run("queued", func(t *testing.T) {
+		q := NewQuotaTracker(QuotaConfig{Limits: limits, Queue: true, MaxWait: time.Second})
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			if err := q.acquire(ctx, quotaURL); err != nil {
+				t.Fatalf("call %d: %v", i+1, err)
+			}
+		}
+		if took := time.Since(start); took < 150*time.Millisecond {
+			t.Errorf("three calls took %v, want them spaced 100ms apart", took)
+		}
+		if usage := q.Usage(); usage[0].Queued != 2 || usage[0].Used != 3 {
+			t.Errorf("got usage %+v, want 2 of 3 calls queued", usage[0])
+		}
+	})
+
+	t.Run("queue longer than the wait", func(t *testing.T) {
+		q := NewQuotaTracker(QuotaConfig{Limits: limits, Queue: true, MaxWait: 50 * time.Millisecond})
+		if err := q.acquire(ctx, quotaURL); err != nil {
+			t.Fatal(err)
+		}
+		if err := q.acquire(ctx, quotaURL); !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("got %v, want a call waiting past MaxWait rejected", err)
+		}
+	})
+}
+
+func TestQuotaIdentity(t *testing.T) {
+	tests := []struct {
+		url      string
+		provider string
+		key      string
+	}{
+		{url: quotaURL, provider: "marketstack", key: "********1234"},
+		{url: "https://api.coinlayer.com/live?access_key=ab", provider: "coinlayer", key: "ab"},
+		{url: "https://open.er-api.com/v6/latest/USD", provider: "erapi"},
+		{url: "https://example.com/x", provider: "example.com"},
+	}
+	for _, tt := range tests {
+		provider, key := quotaIdentity(tt.url)
+		if provider != tt.provider || key != tt.key {
+			t.Errorf("%s: got %s %s, want %s %s", tt.url, provider, key, tt.provider, tt.key)
+		}
+	}
+}
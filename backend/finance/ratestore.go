@@ -0,0 +1,154 @@
+package finance
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RateStore keeps the rates of past days, which never change once the
+// day is over.
+type RateStore interface {
+	// Historical reports false when date has not been stored
+	Historical(ctx context.Context, date string) (*HistoricalRates, bool, error)
+	SaveHistorical(ctx context.Context, rates *HistoricalRates) error
+}
+
+var _ RateStore = &sqlRateStore{}
+
+type sqlRateStore struct {
+	logger *zap.Logger
+	db     *sql.DB
+}
+
+func NewRateStore(logger *zap.Logger, db *sql.DB) *sqlRateStore {
+	return &sqlRateStore{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (s *sqlRateStore) Historical(ctx context.Context, date string) (*HistoricalRates, bool, error) {
+	val := &HistoricalRates{Date: date}
+	err := s.db.QueryRowContext(ctx, "select target, timestamp from crypto_rate_days where date = ?", date).Scan(&val.Target, &val.Timestamp)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		s.logger.Debug("could not fetch rate day", zap.Any("error", err))
+		return nil, false, err
+	}
+	rows, err := s.db.QueryContext(ctx, "select symbol, rate from crypto_rates where date = ?", date)
+	if err != nil {
+		s.logger.Debug("could not fetch rates", zap.Any("error", err))
+		return nil, false, err
+	}
+	defer rows.Close()
+	val.Rates = map[string]float64{}
+	for rows.Next() {
+		var (
+			symbol string
+			rate   float64
+		)
+		if err := rows.Scan(&symbol, &rate); err != nil {
+			s.logger.Debug("could not scan rate", zap.Any("error", err))
+			return nil, false, err
+		}
+		val.Rates[symbol] = rate
+	}
+	if err := rows.Err(); err != nil {
+		s.logger.Debug("could not read rates", zap.Any("error", err))
+		return nil, false, err
+	}
+	return val, true, nil
+}
+
+func (s *sqlRateStore) SaveHistorical(ctx context.Context, rates *HistoricalRates) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		s.logger.Debug("could not start transaction", zap.Any("error", err))
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, "insert into crypto_rates(date, symbol, rate) values(?,?,?) on duplicate key update rate=values(rate)")
+	if err != nil {
+		tx.Rollback()
+		s.logger.Debug("could not prepare rate insert", zap.Any("error", err))
+		return err
+	}
+	defer stmt.Close()
+	for symbol, rate := range rates.Rates {
+		if _, err := stmt.ExecContext(ctx, rates.Date, symbol, rate); err != nil {
+			tx.Rollback()
+			s.logger.Debug("could not save rate", zap.Any("error", err))
+			return err
+		}
+	}
+	// the day row goes in last, so a day is only found once all of
+	// its rates are there
+	if _, err := tx.ExecContext(ctx, "insert into crypto_rate_days(date, target, timestamp) values(?,?,?) on duplicate key update target=values(target), timestamp=values(timestamp)", rates.Date, rates.Target, rates.Timestamp); err != nil {
+		tx.Rollback()
+		s.logger.Debug("could not save rate day", zap.Any("error", err))
+		return err
+	}
+	return tx.Commit()
+}
+
+var _ CryptoRateProvider = &storedCryptos{}
+
+// storedCryptos answers past days from the local RateStore and only
+// asks upstream for days it has never seen. like storedStocks a
+// failing store is logged and skipped.
+type storedCryptos struct {
+	logger   *zap.Logger
+	upstream CryptoRateProvider
+	store    RateStore
+}
+
+func NewStoredCryptos(logger *zap.Logger, upstream CryptoRateProvider, store RateStore) *storedCryptos {
+	return &storedCryptos{
+		logger:   logger,
+		upstream: upstream,
+		store:    store,
+	}
+}
+
+func (s *storedCryptos) Name() string {
+	return s.upstream.Name()
+}
+
+func (s *storedCryptos) List(ctx context.Context) (*AllCrypto, error) {
+	return s.upstream.List(ctx)
+}
+
+func (s *storedCryptos) Live(ctx context.Context) (*LiveData, error) {
+	return s.upstream.Live(ctx)
+}
+
+func (s *storedCryptos) Historical(ctx context.Context, date string) (*HistoricalRates, error) {
+	stored, ok, err := s.store.Historical(ctx, date)
+	if err != nil {
+		s.logger.Warn("rate store unavailable, going upstream", zap.String("date", date), zap.Any("error", err))
+	}
+	if ok {
+		stored.Source = "store"
+		return stored, nil
+	}
+
+	res, err := s.upstream.Historical(ctx, date)
+	if err != nil {
+		return nil, err
+	}
+	if res.Date == "" {
+		res.Date = date
+	}
+	// only days that are over keep their rates
+	if date < time.Now().UTC().Format(dateLayout) {
+		if err := s.store.SaveHistorical(ctx, res); err != nil {
+			s.logger.Warn("could not store historical rates", zap.String("date", date), zap.Any("error", err))
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,108 @@
+package finance
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Interval is a candle width such as 5m, 1h, 1d, 1w or 1M.
+// m is minutes and M is calendar months.
+type Interval struct {
+	Count int
+	Unit  byte
+}
+
+// monday 1970-01-05, weeks are counted from here so they start on mondays
+var weekEpoch = time.Date(1970, 1, 5, 0, 0, 0, 0, time.UTC)
+
+func ParseInterval(v string) (Interval, error) {
+	if len(v) < 2 {
+		return Interval{}, fmt.Errorf("%w: interval %q", ErrInvalidQuery, v)
+	}
+	count, err := strconv.Atoi(v[:len(v)-1])
+	if err != nil || count <= 0 {
+		return Interval{}, fmt.Errorf("%w: interval %q", ErrInvalidQuery, v)
+	}
+	unit := v[len(v)-1]
+	switch unit {
+	case 'm', 'h', 'd', 'w', 'M':
+		return Interval{Count: count, Unit: unit}, nil
+	}
+	return Interval{}, fmt.Errorf("%w: interval %q must end in m, h, d, w or M", ErrInvalidQuery, v)
+}
+
+func (iv Interval) String() string {
+	return strconv.Itoa(iv.Count) + string(iv.Unit)
+}
+
+// start is the opening time of the candle t falls into. buckets are
+// aligned on UTC.
+func (iv Interval) start(t time.Time) time.Time {
+	t = t.UTC()
+	switch iv.Unit {
+	case 'm':
+		return t.Truncate(time.Duration(iv.Count) * time.Minute)
+	case 'h':
+		return t.Truncate(time.Duration(iv.Count) * time.Hour)
+	case 'd':
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		days := int(day.Sub(time.Unix(0, 0).UTC()).Hours() / 24)
+		return day.AddDate(0, 0, -(days % iv.Count))
+	case 'w':
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		days := int(day.Sub(weekEpoch).Hours() / 24)
+		offset := days % (7 * iv.Count)
+		if offset < 0 {
+			offset += 7 * iv.Count
+		}
+		return day.AddDate(0, 0, -offset)
+	default:
+		months := (t.Year()-1970)*12 + int(t.Month()) - 1
+		offset := months % iv.Count
+		if offset < 0 {
+			offset += iv.Count
+		}
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -offset, 0)
+	}
+}
+
+// Resample folds bars, oldest first, into candles of the given
+// interval: the first open, the highest high, the lowest low, the last
+// close and the summed volume. each candle is stamped with the start
+// of its bucket and empty buckets are not filled in.
+func Resample(bars []Bar, iv Interval) []Bar {
+	out := make([]Bar, 0)
+	for _, b := range bars {
+		start := iv.start(b.Time)
+		if n := len(out); n > 0 && out[n-1].Time.Equal(start) {
+			c := &out[n-1]
+			if b.High > c.High {
+				c.High = b.High
+			}
+			if b.Low < c.Low {
+				c.Low = b.Low
+			}
+			c.Close = b.Close
+			c.Volume += b.Volume
+			continue
+		}
+		out = append(out, Bar{
+			Time:   start,
+			Open:   b.Open,
+			High:   b.High,
+			Low:    b.Low,
+			Close:  b.Close,
+			Volume: b.Volume,
+		})
+	}
+	return out
+}
+
+// Candles is a resampled series as served to clients.
+type Candles struct {
+	Symbol   string `json:"symbol"`
+	Interval string `json:"interval"`
+	Bars     []Bar  `json:"bars"`
+	Source   string `json:"source,omitempty"`
+}
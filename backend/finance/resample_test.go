@@ -0,0 +1,159 @@
+package finance
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Interval
+		wantErr bool
+	}{
+		{in: "5m", want: Interval{Count: 5, Unit: 'm'}},
+		{in: "1h", want: Interval{Count: 1, Unit: 'h'}},
+		{in: "2d", want: Interval{Count: 2, Unit: 'd'}},
+		{in: "1w", want: Interval{Count: 1, Unit: 'w'}},
+		{in: "3M", want: Interval{Count: 3, Unit: 'M'}},
+		{in: "", wantErr: true},
+		{in: "m", wantErr: true},
+		{in: "0h", wantErr: true},
+		{in: "-1d", wantErr: true},
+		{in: "1y", wantErr: true},
+		{in: "xh", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseInterval(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Fatalf("got %v, %v, want ErrInvalidQuery", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("got %v, %v, want %v", got, err, tt.want)
+			}
+			if got.String() != tt.in {
+				t.Errorf("String() = %q, want %q", got.String(), tt.in)
+			}
+		})
+	}
+}
+
+func TestResample(t *testing.T) {
+	at := func(v string) time.Time {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	bar := func(v string, open, high, low, close, volume float64) Bar {
+		return Bar{Time: at(v), Open: open, High: high, Low: low, Close: close, Volume: volume}
+	}
+	tests := []struct {
+		name     string
+		interval string
+		bars     []Bar
+		want     []Bar
+	}{
+		{
+			name:     "minutes fold into one candle",
+			interval: "5m",
+			bars: []Bar{
+				bar("2024-01-02T10:01:00Z", 10, 11, 9, 10.5, 100),
+				bar("2024-01-02T10:03:00Z", 10.5, 12, 10, 11, 50),
+				bar("2024-01-02T10:05:00Z", 11, 11.5, 10.8, 11.2, 20),
+			},
+			want: []Bar{
+				bar("2024-01-02T10:00:00Z", 10, 12, 9, 11, 150),
+				bar("2024-01-02T10:05:00Z", 11, 11.5, 10.8, 11.2, 20),
+			},
+		},
+		{
+			name:     "hours are aligned on utc",
+			interval: "1h",
+			bars: []Bar{
+				bar("2024-01-02T10:30:00+01:00", 1, 1, 1, 1, 1),
+				bar("2024-01-02T09:45:00Z", 2, 2, 2, 2, 1),
+			},
+			want: []Bar{bar("2024-01-02T09:00:00Z", 1, 2, 1, 2, 2)},
+		},
+		{
+			name:     "empty buckets are skipped",
+			interval: "1d",
+			bars: []Bar{
+				bar("2024-01-02T00:00:00Z", 1, 1, 1, 1, 1),
+				bar("2024-01-05T00:00:00Z", 2, 2, 2, 2, 1),
+			},
+			want: []Bar{
+				bar("2024-01-02T00:00:00Z", 1, 1, 1, 1, 1),
+				bar("2024-01-05T00:00:00Z", 2, 2, 2, 2, 1),
+			},
+		},
+		{
+			name:     "multi day candles count from the epoch",
+			interval: "2d",
+			bars: []Bar{
+				bar("2023-12-31T00:00:00Z", 1, 1, 1, 1, 1),
+				bar("2024-01-01T00:00:00Z", 2, 2, 2, 2, 1),
+				bar("2024-01-02T00:00:00Z", 3, 3, 3, 3, 1),
+			},
+			want: []Bar{
+				bar("2023-12-31T00:00:00Z", 1, 2, 1, 2, 2),
+				bar("2024-01-02T00:00:00Z", 3, 3, 3, 3, 1),
+			},
+		},
+		{
+			name:     "weeks start on monday",
+			interval: "1w",
+			bars: []Bar{
+				bar("2024-01-03T00:00:00Z", 1, 1, 1, 1, 1),
+				bar("2024-01-07T00:00:00Z", 2, 2, 2, 2, 1),
+				bar("2024-01-08T00:00:00Z", 3, 3, 3, 3, 1),
+			},
+			want: []Bar{
+				bar("2024-01-01T00:00:00Z", 1, 2, 1, 2, 2),
+				bar("2024-01-08T00:00:00Z", 3, 3, 3, 3, 1),
+			},
+		},
+		{
+			name:     "months are calendar months",
+			interval: "3M",
+			bars: []Bar{
+				bar("2024-02-15T00:00:00Z", 1, 1, 1, 1, 1),
+				bar("2024-03-31T00:00:00Z", 2, 2, 2, 2, 1),
+				bar("2024-04-01T00:00:00Z", 3, 3, 3, 3, 1),
+			},
+			want: []Bar{
+				bar("2024-01-01T00:00:00Z", 1, 2, 1, 2, 2),
+				bar("2024-04-01T00:00:00Z", 3, 3, 3, 3, 1),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iv, err := ParseInterval(tt.interval)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := Resample(tt.bars, iv)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d candles, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range tt.want {
+				if !got[i].Time.Equal(tt.want[i].Time) {
+					t.Errorf("candle %d starts at %s, want %s", i, got[i].Time, tt.want[i].Time)
+				}
+				got[i].Time, tt.want[i].Time = time.Time{}, time.Time{}
+				if !reflect.DeepEqual(got[i], tt.want[i]) {
+					t.Errorf("candle %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package finance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+// StockProvider is a source of market data. every provider
+// returns the same domain types so the StockTicker does not
+// care where the data actually came from.
+type StockProvider interface {
+	Name() string
+	Tickers(ctx context.Context, limit int, offset int) (allStockTickers, error)
+	Ticker(ctx context.Context, symbol string) (*allTickers, error)
+	EOD(ctx context.Context, symbol string, query EODQuery) (*ParentStockEOD, error)
+	EODLatest(ctx context.Context, symbols []string) (*LatestEOD, error)
+	Splits(ctx context.Context, symbol string) (*Split, error)
+	Dividends(ctx context.Context, symbol string) (*Dividend, error)
+	Intraday(ctx context.Context, symbol string, query IntradayQuery) (*Intraday, error)
+	IntradayLatest(ctx context.Context, symbols []string) (*LatestIntraday, error)
+}
+
+var (
+	_ StockProvider = &marketstack{}
+	_ StockProvider = &fixtureStocks{}
+
+	ErrUnknownProvider = errors.New("unknown data provider")
+	ErrInvalidSymbol   = errors.New("invalid symbol")
+)
+
+// NewStockProvider builds the providers listed in the STOCK_PROVIDER
+// env value. marketstack is the default, "fixture" reads saved responses
+// from the STOCK_FIXTURES directory so we can run offline. a comma
+// separated list such as "marketstack,fixture" fails over in order.
+func NewStockProvider(logger *zap.Logger, client RequestClient) (StockProvider, error) {
+	_ = godotenv.Load()
+	names := splitNames(os.Getenv("STOCK_PROVIDER"), "marketstack")
+	providers := make([]StockProvider, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case "marketstack":
+			providers = append(providers, NewMarketstack(logger, client, os.Getenv("MARKETSTACK")))
+		case "fixture":
+			providers = append(providers, NewFixtureStocks(logger, os.Getenv("STOCK_FIXTURES")))
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+		}
+	}
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+	return NewStockFailover(logger, FailoverConfigFromEnv(), providers...), nil
+}
+
+func splitNames(value string, fallback string) []string {
+	names := []string{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return []string{fallback}
+	}
+	return names
+}
+
+type marketstack struct {
+	logger    *zap.Logger
+	client    RequestClient
+	baseURL   string
+	accessKey string
+}
+
+func NewMarketstack(logger *zap.Logger, client RequestClient, accessKey string) *marketstack {
+	return &marketstack{
+		logger:    logger,
+		client:    client,
+		baseURL:   "http://api.marketstack.com/v1",
+		accessKey: accessKey,
+	}
+}
+
+func (m *marketstack) Name() string {
+	return "marketstack"
+}
+
+func (m *marketstack) url(path string, params url.Values) string {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("access_key", m.accessKey)
+	return m.baseURL + path + "?" + params.Encode()
+}
+
+func (m *marketstack) get(ctx context.Context, path string, params url.Values, v any) error {
+	req, err := m.client.MakeGetRequest(ctx, http.MethodGet, m.url(path, params))
+	if err != nil {
+		m.logger.Debug("error making request", zap.Any("error", err))
+		return err
+	}
+	if err := json.Unmarshal(req, v); err != nil {
+		m.logger.Debug("error unmarshalling data", zap.Any("error", err))
+		return err
+	}
+	return nil
+}
+
+// Tickers fetches one page of the ticker list, a zero limit
+// leaving the page size to the vendor.
+func (m *marketstack) Tickers(ctx context.Context, limit int, offset int) (allStockTickers, error) {
+	params := url.Values{}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	if offset > 0 {
+		params.Set("offset", strconv.Itoa(offset))
+	}
+	var val allStockTickers
+	if err := m.get(ctx, "/tickers", params, &val); err != nil {
+		return allStockTickers{}, err
+	}
+	val.Source = m.Name()
+	return val, nil
+}
+
+func (m *marketstack) Ticker(ctx context.Context, symbol string) (*allTickers, error) {
+	var val allTickers
+	if err := m.get(ctx, "/tickers/"+url.PathEscape(symbol), nil, &val); err != nil {
+		return nil, err
+	}
+	val.Source = m.Name()
+	return &val, nil
+}
+
+// EOD walks upstream pages until the query limit is met or the
+// vendor runs out of bars.
+func (m *marketstack) EOD(ctx context.Context, symbol string, query EODQuery) (*ParentStockEOD, error) {
+	var val ParentStockEOD
+	limit := query.limit()
+	for len(val.Data.EOD) < limit {
+		size := limit - len(val.Data.EOD)
+		if size > maxEODPage {
+			size = maxEODPage
+		}
+		var page ParentStockEOD
+		if err := m.get(ctx, "/tickers/"+url.PathEscape(symbol)+"/eod", query.params(size, query.Offset+len(val.Data.EOD)), &page); err != nil {
+			return nil, err
+		}
+		bars := val.Data.EOD
+		val.Data = page.Data
+		val.Data.EOD = append(bars, page.Data.EOD...)
+		val.Pagination.Total = page.Pagination.Total
+		if len(page.Data.EOD) < size || query.Offset+len(val.Data.EOD) >= page.Pagination.Total {
+			break
+		}
+	}
+	val.Pagination.Limit = limit
+	val.Pagination.Offset = query.Offset
+	val.Pagination.Count = len(val.Data.EOD)
+	val.Source = m.Name()
+	return &val, nil
+}
+
+// EODLatest uses the multi symbol endpoint, asking for as many
+// symbols at once as marketstack allows.
+func (m *marketstack) EODLatest(ctx context.Context, symbols []string) (*LatestEOD, error) {
+	val := &LatestEOD{Data: make([]EOD, 0, len(symbols)), Source: m.Name()}
+	for _, chunk := range chunkSymbols(symbols) {
+		var page LatestEOD
+		if err := m.get(ctx, "/eod/latest", url.Values{"symbols": {strings.Join(chunk, ",")}, "limit": {strconv.Itoa(len(chunk))}}, &page); err != nil {
+			return nil, err
+		}
+		val.Data = append(val.Data, page.Data...)
+	}
+	val.Missing = missingSymbols(symbols, func(s string) bool { _, err := val.find(s); return err == nil })
+	return val, nil
+}
+
+func (m *marketstack) Splits(ctx context.Context, symbol string) (*Split, error) {
+	var val Split
+	if err := m.get(ctx, "/tickers/"+url.PathEscape(symbol)+"/splits", nil, &val); err != nil {
+		return nil, err
+	}
+	val.Source = m.Name()
+	return &val, nil
+}
+
+func (m *marketstack) Dividends(ctx context.Context, symbol string) (*Dividend, error) {
+	var val Dividend
+	if err := m.get(ctx, "/tickers/"+url.PathEscape(symbol)+"/dividends", nil, &val); err != nil {
+		return nil, err
+	}
+	val.Source = m.Name()
+	return &val, nil
+}
+
+// Intraday fetches the latest bars in one call, or walks the pages of
+// a ranged query until the vendor runs out of bars.
+func (m *marketstack) Intraday(ctx context.Context, symbol string, query IntradayQuery) (*Intraday, error) {
+	var val Intraday
+	for offset := 0; ; {
+		var page Intraday
+		if err := m.get(ctx, "/tickers/"+url.PathEscape(symbol)+"/intraday", query.params(maxEODPage, offset), &page); err != nil {
+			return nil, err
+		}
+		bars, malformed := val.Data.Intraday, val.Data.Malformed
+		val.Data = page.Data
+		if offset > 0 {
+			val.Data.Intraday = append(bars, page.Data.Intraday...)
+			val.Data.Malformed = append(malformed, page.Data.Malformed...)
+		}
+		rows := len(page.Data.Intraday) + len(page.Data.Malformed)
+		offset += rows
+		if !query.Ranged() || rows < maxEODPage {
+			break
+		}
+	}
+	if n := len(val.Data.Malformed); n > 0 {
+		m.logger.Warn("dropped malformed intraday rows", zap.String("symbol", symbol), zap.Int("rows", n))
+	}
+	val.Source = m.Name()
+	return &val, nil
+}
+
+func (m *marketstack) IntradayLatest(ctx context.Context, symbols []string) (*LatestIntraday, error) {
+	val := &LatestIntraday{Data: make([]IntradayBar, 0, len(symbols)), Source: m.Name()}
+	for _, chunk := range chunkSymbols(symbols) {
+		var page LatestIntraday
+		if err := m.get(ctx, "/intraday/latest", url.Values{"symbols": {strings.Join(chunk, ",")}, "limit": {strconv.Itoa(len(chunk))}}, &page); err != nil {
+			return nil, err
+		}
+		val.Data = append(val.Data, page.Data...)
+		val.Malformed = append(val.Malformed, page.Malformed...)
+	}
+	if n := len(val.Malformed); n > 0 {
+		m.logger.Warn("dropped malformed intraday rows", zap.Int("rows", n))
+	}
+	val.Missing = missingSymbols(symbols, func(s string) bool { _, err := val.find(s); return err == nil })
+	return val, nil
+}
+
+// fixtureStocks serves saved marketstack responses from disk.
+// the layout is <dir>/tickers.json for the ticker list and
+// <dir>/<SYMBOL>/<kind>.json for everything per symbol, where
+// kind is one of ticker, eod, eod_latest, splits, dividends,
+// intraday or intraday_latest.
+type fixtureStocks struct {
+	logger *zap.Logger
+	dir    string
+}
+
+func NewFixtureStocks(logger *zap.Logger, dir string) *fixtureStocks {
+	return &fixtureStocks{
+		logger: logger,
+		dir:    dir,
+	}
+}
+
+func (f *fixtureStocks) Name() string {
+	return "fixture"
+}
+
+func (f *fixtureStocks) read(v any, parts ...string) error {
+	body, err := os.ReadFile(filepath.Join(append([]string{f.dir}, parts...)...))
+	if err != nil {
+		f.logger.Debug("error reading fixture", zap.Any("error", err))
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		f.logger.Debug("error unmarshalling fixture", zap.Any("error", err))
+		return err
+	}
+	return nil
+}
+
+func (f *fixtureStocks) readSymbol(symbol string, kind string, v any) error {
+	symbol = strings.ToUpper(symbol)
+	if symbol == "" || filepath.Base(symbol) != symbol || symbol == ".." {
+		return fmt.Errorf("%w: %q", ErrInvalidSymbol, symbol)
+	}
+	return f.read(v, symbol, kind+".json")
+}
+
+func (f *fixtureStocks) Tickers(ctx context.Context, limit int, offset int) (allStockTickers, error) {
+	var val allStockTickers
+	if err := f.read(&val, "tickers.json"); err != nil {
+		return allStockTickers{}, err
+	}
+	if limit == 0 {
+		limit = defaultTickerPage
+	}
+	total := len(val.Data)
+	start, end := offset, offset+limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	val.Data = val.Data[start:end]
+	val.Pagination = StockPagination{Limit: limit, Offset: offset, Count: len(val.Data), Total: total}
+	val.Source = f.Name()
+	return val, nil
+}
+
+func (f *fixtureStocks) Ticker(ctx context.Context, symbol string) (*allTickers, error) {
+	var val allTickers
+	if err := f.readSymbol(symbol, "ticker", &val); err != nil {
+		return nil, err
+	}
+	val.Source = f.Name()
+	return &val, nil
+}
+
+func (f *fixtureStocks) EOD(ctx context.Context, symbol string, query EODQuery) (*ParentStockEOD, error) {
+	var val ParentStockEOD
+	if err := f.readSymbol(symbol, "eod", &val); err != nil {
+		return nil, err
+	}
+	applyEODQuery(&val, query)
+	val.Source = f.Name()
+	return &val, nil
+}
+
+func (f *fixtureStocks) EODLatest(ctx context.Context, symbols []string) (*LatestEOD, error) {
+	val := &LatestEOD{Data: make([]EOD, 0, len(symbols)), Missing: make([]string, 0), Source: f.Name()}
+	for _, symbol := range symbols {
+		var bar EOD
+		if err := f.readSymbol(symbol, "eod_latest", &bar); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				val.Missing = append(val.Missing, symbol)
+				continue
+			}
+			return nil, err
+		}
+		val.Data = append(val.Data, bar)
+	}
+	return val, nil
+}
+
+func (f *fixtureStocks) Splits(ctx context.Context, symbol string) (*Split, error) {
+	var val Split
+	if err := f.readSymbol(symbol, "splits", &val); err != nil {
+		return nil, err
+	}
+	val.Source = f.Name()
+	return &val, nil
+}
+
+func (f *fixtureStocks) Dividends(ctx context.Context, symbol string) (*Dividend, error) {
+	var val Dividend
+	if err := f.readSymbol(symbol, "dividends", &val); err != nil {
+		return nil, err
+	}
+	val.Source = f.Name()
+	return &val, nil
+}
+
+func (f *fixtureStocks) Intraday(ctx context.Context, symbol string, query IntradayQuery) (*Intraday, error) {
+	var val Intraday
+	if err := f.readSymbol(symbol, "intraday", &val); err != nil {
+		return nil, err
+	}
+	if query.Ranged() {
+		bars := make([]IntradayBar, 0, len(val.Data.Intraday))
+		for _, bar := range val.Data.Intraday {
+			if day := eodDay(bar.Date); day >= query.DateFrom && day <= query.DateTo {
+				bars = append(bars, bar)
+			}
+		}
+		val.Data.Intraday = bars
+	}
+	val.Source = f.Name()
+	return &val, nil
+}
+
+func (f *fixtureStocks) IntradayLatest(ctx context.Context, symbols []string) (*LatestIntraday, error) {
+	val := &LatestIntraday{Data: make([]IntradayBar, 0, len(symbols)), Missing: make([]string, 0), Source: f.Name()}
+	for i, symbol := range symbols {
+		var bar IntradayBar
+		if err := f.readSymbol(symbol, "intraday_latest", &bar); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				val.Missing = append(val.Missing, symbol)
+				continue
+			}
+			return nil, err
+		}
+		if err := bar.Validate(); err != nil {
+			val.Malformed = append(val.Malformed, MalformedRow{Index: i, Error: err.Error()})
+			continue
+		}
+		val.Data = append(val.Data, bar)
+	}
+	return val, nil
+}
@@ -1,34 +1,39 @@
 package finance
 
 import (
-	"encoding/json"
-	"io"
-	"log"
-	"net/http"
-	"os"
+	"context"
 
-	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 )
 
 type StockTicker interface {
-	GetAllTickers() (allStockTickers, error)
-	GetCompanyTicker(companyTicker string) (*allTickers, error)
-	GetCompanyEOD(symbol string) (*ParentStockEOD, error)
-	GetCompanySplits(symbol string) (*Split, error)
-	GetCompanyIntraday(symbol string) (*Intraday, error)
+	GetAllTickers(ctx context.Context) (allStockTickers, error)
+	GetCompanyTicker(ctx context.Context, companyTicker string) (*allTickers, error)
+	GetCompanyEOD(ctx context.Context, symbol string, query EODQuery) (*ParentStockEOD, error)
+	GetCompanySplits(ctx context.Context, symbol string) (*Split, error)
+	GetCompanyDividends(ctx context.Context, symbol string) (*Dividend, error)
+	GetCompanyIntraday(ctx context.Context, symbol string, query IntradayQuery) (*Intraday, error)
+	GetAdjustedEOD(ctx context.Context, symbol string, query EODQuery) (*AdjustedSeries, error)
+	GetCompanyEODLatest(ctx context.Context, symbol string) (*EOD, error)
+	GetCompanyIntradayLatest(ctx context.Context, symbol string) (*IntradayBar, error)
+	GetEODLatest(ctx context.Context, symbols []string) (*LatestEOD, error)
+	GetIntradayLatest(ctx context.Context, symbols []string) (*LatestIntraday, error)
+	GetBatch(ctx context.Context, kind string, symbols []string, parallelism int) (*Batch[any], error)
 }
 
 var _ StockTicker = &stockTickers{}
 
 type stockTickers struct {
-	logger      *zap.Logger
-	stockClient RequestClient
+	logger   *zap.Logger
+	provider StockProvider
 }
 
 type allStockTickers struct {
-	// Pagination StockPagination `json:"pagination"`
-	Data []allTickers `json:"data"`
+	Pagination StockPagination `json:"pagination"`
+	Data       []allTickers    `json:"data"`
+	// the ticker catalog is still being filled
+	Partial bool   `json:"partial,omitempty"`
+	Source  string `json:"source,omitempty"`
 }
 
 type StockPagination struct {
@@ -45,6 +50,7 @@ type allTickers struct {
 	HasEOD        bool          `json:"has_eod"`
 	Country       string        `json:"country"`
 	StockExchange StockExchange `json:"stock_exchange"`
+	Source        string        `json:"source,omitempty"`
 }
 
 type StockExchange struct {
@@ -58,8 +64,10 @@ type StockExchange struct {
 }
 
 type ParentStockEOD struct {
-	// Pagination StockPagination `json:"pagination"`
-	Data StockEOD `json:"data"`
+	Pagination StockPagination `json:"pagination"`
+	Data       StockEOD        `json:"data"`
+	Source     string          `json:"source,omitempty"`
+	Warnings   []string        `json:"warnings,omitempty"`
 }
 
 type StockEOD struct {
@@ -87,238 +95,146 @@ type EOD struct {
 	Symbol      string  `json:"symbol"`
 	Exchange    string  `json:"exchange"`
 	Date        string  `json:"date"`
+	Source      string  `json:"source,omitempty"`
 }
 
 type Split struct {
-	Data []struct {
-		Date        string  `json:"date"`
-		SplitFactor float64 `json:"split_factor"`
-		Symbol      string  `json:"symbol"`
-	} `json:"data"`
+	Data   []StockSplit `json:"data"`
+	Source string       `json:"source,omitempty"`
+}
+
+type StockSplit struct {
+	Date        string  `json:"date"`
+	SplitFactor float64 `json:"split_factor"`
+	Symbol      string  `json:"symbol"`
 }
 
 type Dividend struct {
-	Data []struct {
-		Date     string  `json:"date"`
-		Dividend float64 `json:"dividend"`
-		Symbol   string  `json:"symbol"`
-	} `json:"data"`
+	Data   []StockDividend `json:"data"`
+	Source string          `json:"source,omitempty"`
 }
 
-type Intraday struct {
-	Data struct {
-		Name        string `json:"name"`
-		Symbol      string `json:"symbol"`
-		Country     string `json:"country"`
-		HasIntraday bool   `json:"has_intraday"`
-		HasEOD      bool   `json:"has_eod"`
-		Intraday    []struct {
-			Open     float64 `json:"open"`
-			High     float64 `json:"high"`
-			Low      float64 `json:"low"`
-			Last     string  `json:"last"`
-			Close    string  `json:"close"`
-			Volume   string  `json:"volume"`
-			Date     string  `json:"date"`
-			Symbol   string  `json:"symbol"`
-			Exchange string  `json:"exchange"`
-		} `json:"intraday"`
-	} `json:"data"`
+type StockDividend struct {
+	Date     string  `json:"date"`
+	Dividend float64 `json:"dividend"`
+	Symbol   string  `json:"symbol"`
 }
 
-func NewStockTicker(logger *zap.Logger, stockclient RequestClient) *stockTickers {
+func NewStockTicker(logger *zap.Logger, provider StockProvider) *stockTickers {
 	return &stockTickers{
-		logger:      logger,
-		stockClient: stockclient,
+		logger:   logger,
+		provider: provider,
 	}
 }
 
-func (s *stockTickers) GetAllTickers() (allStockTickers, error) {
-	req, err := http.NewRequest(http.MethodGet, "http://api.marketstack.com/v1/tickers?access_key=214e04d7d20abb7cbd47894b00c2c334", nil)
+func (s *stockTickers) GetAllTickers(ctx context.Context) (allStockTickers, error) {
+	res, err := s.provider.Tickers(ctx, 0, 0)
 	if err != nil {
-		s.logger.Debug("error fetching stock tickers", zap.Any("error", err.Error()))
+		s.logger.Debug("error fetching stock tickers", zap.Any("error", err))
 		return allStockTickers{}, err
 	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-
-	client := &http.Client{}
-	res, err := client.Do(req)
-	if err != nil {
-		s.logger.Debug("cannot process response", zap.Any("error", err.Error()))
-		return allStockTickers{}, err
-	}
-	defer res.Body.Close()
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		s.logger.Debug("failed to process response byte", zap.Any("error", err.Error()))
-		return allStockTickers{}, err
-	}
-
-	var val allStockTickers
-	data := json.Unmarshal(body, &val)
-	if data != nil {
-		s.logger.Debug("error mapping data to struct", zap.Any("error", data))
-		return allStockTickers{}, err
-	}
-	return val, nil
+	return res, nil
 }
 
-func (s *stockTickers) GetCompanyTicker(symbol string) (*allTickers, error) {
-	err := godotenv.Load()
-	if err != nil {
-		s.logger.Error("error loading env file", zap.Error(err))
-		return nil, err
-	}
-	accessKey := os.Getenv("MARKETSTACK")
-	req, err := http.NewRequest(http.MethodGet, "http://api.marketstack.com/v1/tickers/"+symbol+"?access_key="+accessKey, nil)
+func (s *stockTickers) GetCompanyTicker(ctx context.Context, symbol string) (*allTickers, error) {
+	res, err := s.provider.Ticker(ctx, symbol)
 	if err != nil {
-		s.logger.Debug("error fetching stock tickers", zap.Any("error", err.Error()))
+		s.logger.Debug("error fetching company ticker", zap.Any("error", err))
 		return nil, err
 	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
+	return res, nil
+}
 
-	client := &http.Client{}
-	res, err := client.Do(req)
-	if err != nil {
-		s.logger.Debug("error", zap.String("error", err.Error()))
+func (s *stockTickers) GetCompanyEOD(ctx context.Context, symbol string, query EODQuery) (*ParentStockEOD, error) {
+	if err := query.Validate(); err != nil {
 		return nil, err
 	}
-	defer res.Body.Close()
-	body, err := io.ReadAll(res.Body)
+	res, err := s.provider.EOD(ctx, symbol, query)
 	if err != nil {
-		s.logger.Debug("error", zap.String("error", err.Error()))
+		s.logger.Debug("error fetching company eod", zap.Any("error", err))
 		return nil, err
 	}
-	var val allTickers
-	datast := json.Unmarshal(body, &val)
-	if datast != nil {
-		s.logger.Debug("error unmarshaling to struct", zap.Any("error", datast))
-		return nil, err
-	}
-	return &val, nil
+	return res, nil
 }
 
-func (s *stockTickers) GetCompanyEOD(symbol string) (*ParentStockEOD, error) {
-	err := godotenv.Load()
+func (s *stockTickers) GetCompanySplits(ctx context.Context, symbol string) (*Split, error) {
+	res, err := s.provider.Splits(ctx, symbol)
 	if err != nil {
-		s.logger.Error("error loading env file", zap.Error(err))
+		s.logger.Debug("error fetching company splits", zap.Any("error", err))
 		return nil, err
 	}
-	accessKey := os.Getenv("MARKETSTACK")
-	req, err := s.stockClient.MakeGetRequest(http.MethodGet, "http://api.marketstack.com/v1/tickers/"+symbol+"/eod?access_key="+accessKey)
-	if err != nil {
-		s.logger.Debug("error making request", zap.Any("error", err))
-		return nil, err
-	}
-	var val ParentStockEOD
-	datast := json.Unmarshal(req, &val)
-	if datast != nil {
-		s.logger.Debug("error unmarshalling data", zap.Any("error", datast))
-		return nil, datast
-	}
-	return &val, nil
+	return res, nil
 }
 
-func (s *stockTickers) GetCompanySplits(symbol string) (*Split, error) {
-	err := godotenv.Load()
+func (s *stockTickers) GetCompanyDividends(ctx context.Context, symbol string) (*Dividend, error) {
+	res, err := s.provider.Dividends(ctx, symbol)
 	if err != nil {
-		s.logger.Error("error loading env file", zap.Error(err))
+		s.logger.Debug("error fetching company dividends", zap.Any("error", err))
 		return nil, err
 	}
-	accessKey := os.Getenv("MARKETSTACK")
-	req, err := s.stockClient.MakeGetRequest(http.MethodGet, "http://api.marketstack.com/v1/tickers/"+symbol+"/splits?access_key="+accessKey)
-	if err != nil {
-		s.logger.Debug("error making request", zap.Any("error", err))
-		return nil, err
-	}
-	var val Split
-	datast := json.Unmarshal(req, &val)
-	if datast != nil {
-		s.logger.Debug("error unmarshalling data", zap.Any("error", datast))
-		return nil, datast
-	}
-	return &val, nil
+	return res, nil
 }
 
-func (s *stockTickers) GetCompanyDividends(symbol string) (*Dividend, error) {
-	err := godotenv.Load()
-	if err != nil {
-		s.logger.Error("error loading env file", zap.Error(err))
-		return nil, err
-	}
-	accessKey := os.Getenv("MARKETSTACK")
-	req, err := s.stockClient.MakeGetRequest(http.MethodGet, "http://api.marketstack.com/v1/tickers/"+symbol+"/dividends?access_key="+accessKey)
+func (s *stockTickers) GetCompanyEODLatest(ctx context.Context, symbol string) (*EOD, error) {
+	res, err := s.GetEODLatest(ctx, []string{symbol})
 	if err != nil {
-		s.logger.Debug("error making request", zap.Any("error", err))
 		return nil, err
 	}
-	log.Print("dividends", string(req))
-	var val Dividend
-	datast := json.Unmarshal(req, &val)
-	if datast != nil {
-		s.logger.Debug("error unmarshalling data", zap.Any("error", datast))
-		return nil, datast
-	}
-	return &val, nil
+	return res.find(symbol)
 }
 
-func (s *stockTickers) GetCompanyEODLatest(symbol string) (*ParentStockEOD, error) {
-	err := godotenv.Load()
+func (s *stockTickers) GetEODLatest(ctx context.Context, symbols []string) (*LatestEOD, error) {
+	res, err := s.provider.EODLatest(ctx, symbols)
 	if err != nil {
-		s.logger.Error("error loading env file", zap.Error(err))
+		s.logger.Debug("error fetching latest eod", zap.Any("error", err))
 		return nil, err
 	}
-	accessKey := os.Getenv("MARKETSTACK")
-	req, err := s.stockClient.MakeGetRequest(http.MethodGet, "http://api.marketstack.com/v1/tickers/"+symbol+"/eod/latest?access_key="+accessKey)
+	return res, nil
+}
+
+func (s *stockTickers) GetCompanyIntraday(ctx context.Context, symbol string, query IntradayQuery) (*Intraday, error) {
+	res, err := s.provider.Intraday(ctx, symbol, query)
 	if err != nil {
-		s.logger.Debug("error making request", zap.Any("error", err))
+		s.logger.Debug("error fetching company intraday", zap.Any("error", err))
 		return nil, err
 	}
-	var val ParentStockEOD
-	datast := json.Unmarshal(req, &val)
-	if datast != nil {
-		s.logger.Debug("error unmarshalling data", zap.Any("error", datast))
-		return nil, datast
-	}
-	return &val, nil
+	return res, nil
 }
 
-func (s *stockTickers) GetCompanyIntraday(symbol string) (*Intraday, error) {
-	err := godotenv.Load()
+func (s *stockTickers) GetCompanyIntradayLatest(ctx context.Context, symbol string) (*IntradayBar, error) {
+	res, err := s.GetIntradayLatest(ctx, []string{symbol})
 	if err != nil {
-		s.logger.Error("error loading env file", zap.Error(err))
 		return nil, err
 	}
-	accessKey := os.Getenv("MARKETSTACK")
-	req, err := s.stockClient.MakeGetRequest(http.MethodGet, "http://api.marketstack.com/v1/tickers/"+symbol+"/intraday?access_key="+accessKey)
+	return res.find(symbol)
+}
+
+func (s *stockTickers) GetIntradayLatest(ctx context.Context, symbols []string) (*LatestIntraday, error) {
+	res, err := s.provider.IntradayLatest(ctx, symbols)
 	if err != nil {
-		s.logger.Debug("error making request", zap.Any("error", err))
+		s.logger.Debug("error fetching latest intraday", zap.Any("error", err))
 		return nil, err
 	}
-	var val Intraday
-	_ = json.Unmarshal(req, &val)
-	return &val, nil
+	return res, nil
 }
 
-func (s *stockTickers) GetCompanyIntradayLatest(symbol string) (*ParentStockEOD, error) {
-	err := godotenv.Load()
+func (s *stockTickers) GetAdjustedEOD(ctx context.Context, symbol string, query EODQuery) (*AdjustedSeries, error) {
+	eod, err := s.GetCompanyEOD(ctx, symbol, query)
 	if err != nil {
-		s.logger.Error("error loading env file", zap.Error(err))
 		return nil, err
 	}
-	accessKey := os.Getenv("MARKETSTACK")
-	req, err := s.stockClient.MakeGetRequest(http.MethodGet, "http://api.marketstack.com/v1/tickers/"+symbol+"/intraday/latest?access_key="+accessKey)
+	splits, err := s.GetCompanySplits(ctx, symbol)
 	if err != nil {
-		s.logger.Debug("error making request", zap.Any("error", err))
 		return nil, err
 	}
-	var val ParentStockEOD
-	datast := json.Unmarshal(req, &val)
-	if datast != nil {
-		s.logger.Debug("error unmarshalling data", zap.Any("error", datast))
-		return nil, datast
+	dividends, err := s.GetCompanyDividends(ctx, symbol)
+	if err != nil {
+		return nil, err
 	}
-	return &val, nil
+	return &AdjustedSeries{
+		Symbol:     symbol,
+		Pagination: eod.Pagination,
+		Bars:       AdjustEOD(eod.Data.EOD, splits.Data, dividends.Data),
+		Source:     eod.Source,
+	}, nil
 }
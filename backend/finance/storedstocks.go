@@ -0,0 +1,182 @@
+package finance
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var _ StockProvider = &storedStocks{}
+
+// storedStocks answers bounded EOD and intraday ranges from the local
+// BarStore, fetching only the days it has never seen from upstream.
+// unbounded requests go upstream and are written through. a failing
+// store is logged and skipped so the api keeps working without a
+// database.
+type storedStocks struct {
+	logger   *zap.Logger
+	upstream StockProvider
+	store    BarStore
+}
+
+func NewStoredStocks(logger *zap.Logger, upstream StockProvider, store BarStore) *storedStocks {
+	return &storedStocks{
+		logger:   logger,
+		upstream: upstream,
+		store:    store,
+	}
+}
+
+func (s *storedStocks) Name() string {
+	return s.upstream.Name()
+}
+
+func (s *storedStocks) Tickers(ctx context.Context, limit int, offset int) (allStockTickers, error) {
+	return s.upstream.Tickers(ctx, limit, offset)
+}
+
+func (s *storedStocks) Ticker(ctx context.Context, symbol string) (*allTickers, error) {
+	return s.upstream.Ticker(ctx, symbol)
+}
+
+func (s *storedStocks) EOD(ctx context.Context, symbol string, query EODQuery) (*ParentStockEOD, error) {
+	if query.DateFrom == "" || query.DateTo == "" {
+		res, err := s.upstream.EOD(ctx, symbol, query)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.store.SaveEOD(ctx, res.Data.EOD); err != nil {
+			s.logger.Warn("could not store eod bars", zap.String("symbol", symbol), zap.Any("error", err))
+		}
+		return res, nil
+	}
+
+	res, err := s.rangeFromStore(ctx, symbol, query)
+	if err != nil && ctx.Err() == nil {
+		s.logger.Warn("bar store unavailable, going upstream", zap.String("symbol", symbol), zap.Any("error", err))
+		return s.upstream.EOD(ctx, symbol, query)
+	}
+	return res, err
+}
+
+// rangeFromStore back-fills whatever part of the query range the store
+// is missing and then answers the whole query from the store.
+func (s *storedStocks) rangeFromStore(ctx context.Context, symbol string, query EODQuery) (*ParentStockEOD, error) {
+	covered, err := s.store.EODCoverage(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	val := &ParentStockEOD{Source: "store"}
+	val.Data.Symbol = symbol
+	gaps := missingRanges(DateRange{From: query.DateFrom, To: query.DateTo}, covered)
+	for _, gap := range gaps {
+		fetched, err := s.upstream.EOD(ctx, symbol, EODQuery{DateFrom: gap.From, DateTo: gap.To, Limit: MaxEODLimit, Sort: "ASC"})
+		if err != nil {
+			return nil, err
+		}
+		if err := s.store.SaveEOD(ctx, fetched.Data.EOD); err != nil {
+			return nil, err
+		}
+		// today's bar may still change, only mark closed days as covered
+		if yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(dateLayout); gap.To > yesterday {
+			gap.To = yesterday
+		}
+		if gap.From <= gap.To {
+			if err := s.store.AddEODCoverage(ctx, symbol, gap); err != nil {
+				return nil, err
+			}
+		}
+		val.Data = fetched.Data
+		val.Source = "store+" + fetched.Source
+	}
+
+	bars, err := s.store.EODBars(ctx, symbol, query.DateFrom, query.DateTo)
+	if err != nil {
+		return nil, err
+	}
+	val.Data.EOD = bars
+	applyEODQuery(val, query)
+	return val, nil
+}
+
+func (s *storedStocks) EODLatest(ctx context.Context, symbols []string) (*LatestEOD, error) {
+	return s.upstream.EODLatest(ctx, symbols)
+}
+
+func (s *storedStocks) Splits(ctx context.Context, symbol string) (*Split, error) {
+	return s.upstream.Splits(ctx, symbol)
+}
+
+func (s *storedStocks) Dividends(ctx context.Context, symbol string) (*Dividend, error) {
+	return s.upstream.Dividends(ctx, symbol)
+}
+
+func (s *storedStocks) Intraday(ctx context.Context, symbol string, query IntradayQuery) (*Intraday, error) {
+	if !query.Ranged() {
+		res, err := s.upstream.Intraday(ctx, symbol, query)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.store.SaveIntraday(ctx, res.Data.Intraday); err != nil {
+			s.logger.Warn("could not store intraday bars", zap.String("symbol", symbol), zap.Any("error", err))
+		}
+		return res, nil
+	}
+
+	res, err := s.intradayFromStore(ctx, symbol, query)
+	if err != nil && ctx.Err() == nil {
+		s.logger.Warn("bar store unavailable, going upstream", zap.String("symbol", symbol), zap.Any("error", err))
+		return s.upstream.Intraday(ctx, symbol, query)
+	}
+	return res, err
+}
+
+// intradayFromStore back-fills the days of the query range the store
+// is missing and then answers the whole range from the store.
+func (s *storedStocks) intradayFromStore(ctx context.Context, symbol string, query IntradayQuery) (*Intraday, error) {
+	covered, err := s.store.IntradayCoverage(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	val := &Intraday{Source: "store"}
+	val.Data.Symbol = symbol
+	var malformed []MalformedRow
+	for _, gap := range missingRanges(DateRange{From: query.DateFrom, To: query.DateTo}, covered) {
+		fetched, err := s.upstream.Intraday(ctx, symbol, IntradayQuery{DateFrom: gap.From, DateTo: gap.To})
+		if err != nil {
+			return nil, err
+		}
+		if err := s.store.SaveIntraday(ctx, fetched.Data.Intraday); err != nil {
+			return nil, err
+		}
+		// today's bars are still coming in, only mark closed days as covered
+		if yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(dateLayout); gap.To > yesterday {
+			gap.To = yesterday
+		}
+		if gap.From <= gap.To {
+			if err := s.store.AddIntradayCoverage(ctx, symbol, gap); err != nil {
+				return nil, err
+			}
+		}
+		val.Data = fetched.Data
+		val.Source = "store+" + fetched.Source
+		malformed = append(malformed, fetched.Data.Malformed...)
+	}
+
+	from, _ := time.Parse(dateLayout, query.DateFrom)
+	to, _ := time.Parse(dateLayout, query.DateTo)
+	bars, err := s.store.IntradayBars(ctx, symbol, from, to.AddDate(0, 0, 1).Add(-time.Second))
+	if err != nil {
+		return nil, err
+	}
+	val.Data.Intraday = bars
+	val.Data.Malformed = malformed
+	return val, nil
+}
+
+func (s *storedStocks) IntradayLatest(ctx context.Context, symbols []string) (*LatestIntraday, error) {
+	return s.upstream.IntradayLatest(ctx, symbols)
+}
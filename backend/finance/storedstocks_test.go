@@ -0,0 +1,175 @@
+package finance
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// memBarStore is a BarStore held in memory.
+type memBarStore struct {
+	BarStore
+	intraday map[string]IntradayBar
+	covered  []DateRange
+}
+
+func (m *memBarStore) IntradayBars(ctx context.Context, symbol string, from time.Time, to time.Time) ([]IntradayBar, error) {
+	bars := make([]IntradayBar, 0)
+	for _, bar := range m.intraday {
+		at, _ := bar.Time()
+		if bar.Symbol == symbol && !at.Before(from) && !at.After(to) {
+			bars = append(bars, bar)
+		}
+	}
+	sort.Slice(bars, func(i, j int) bool { return bars[i].Date < bars[j].Date })
+	return bars, nil
+}
+
+func (m *memBarStore) SaveIntraday(ctx context.Context, bars []IntradayBar) error {
+	for _, bar := range bars {
+		m.intraday[bar.Symbol+bar.Date] = bar
+	}
+	return nil
+}
+
+func (m *memBarStore) IntradayCoverage(ctx context.Context, symbol string) ([]DateRange, error) {
+	return m.covered, nil
+}
+
+func (m *memBarStore) AddIntradayCoverage(ctx context.Context, symbol string, covered DateRange) error {
+	m.covered = append(m.covered, covered)
+	return nil
+}
+
+// countingStocks serves one bar a day at noon and remembers the
+// ranges it was asked for.
+type countingStocks struct {
+	StockProvider
+	asked []IntradayQuery
+}
+
+func (c *countingStocks) Name() string {
+	return "counting"
+}
+
+func (c *countingStocks) Intraday(ctx context.Context, symbol string, query IntradayQuery) (*Intraday, error) {
+	c.asked = append(c.asked, query)
+	val := &Intraday{Source: c.Name()}
+	val.Data.Symbol = symbol
+	from, to := query.DateFrom, query.DateTo
+	if !query.Ranged() {
+		from, to = "2024-01-10", "2024-01-10"
+	}
+	for day := from; day <= to; day = addDays(day, 1) {
+		val.Data.Intraday = append(val.Data.Intraday, IntradayBar{
+			Symbol: symbol,
+			Date:   day + "T12:00:00+0000",
+			Open:   NewNumber(1),
+			High:   NewNumber(2),
+			Low:    NewNumber(1),
+			Last:   NewNumber(1.5),
+			Close:  NewNumber(1.5),
+			Volume: NewNumber(100),
+		})
+	}
+	return val, nil
+}
+
+func TestStoredIntradayServesStoredRanges(t *testing.T) {
+	upstream := &countingStocks{}
+	store := &memBarStore{intraday: map[string]IntradayBar{}}
+	stocks := NewStoredStocks(zap.NewNop(), upstream, store)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		query  IntradayQuery
+		asked  []IntradayQuery
+		bars   int
+		source string
+	}{
+		{"new range goes upstream", IntradayQuery{"2024-01-02", "2024-01-04"}, []IntradayQuery{{"2024-01-02", "2024-01-04"}}, 3, "store+counting"},
+		{"same range comes from the store", IntradayQuery{"2024-01-02", "2024-01-04"}, nil, 3, "store"},
+		{"wider range fetches only the gap", IntradayQuery{"2024-01-03", "2024-01-06"}, []IntradayQuery{{"2024-01-05", "2024-01-06"}}, 4, "store+counting"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream.asked = nil
+			res, err := stocks.Intraday(ctx, "AAPL", tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(upstream.asked, tt.asked) {
+				t.Errorf("asked upstream for %v, want %v", upstream.asked, tt.asked)
+			}
+			if len(res.Data.Intraday) != tt.bars {
+				t.Fatalf("got %d bars, want %d", len(res.Data.Intraday), tt.bars)
+			}
+			if res.Source != tt.source {
+				t.Errorf("source %q, want %q", res.Source, tt.source)
+			}
+			bar := res.Data.Intraday[0]
+			if !bar.Last.Valid || !bar.Close.Valid || !bar.Volume.Valid {
+				t.Errorf("stored bar lost its last, close or volume: %+v", bar)
+			}
+		})
+	}
+}
+
+func TestStoredIntradayLatestGoesUpstream(t *testing.T) {
+	upstream := &countingStocks{}
+	stocks := NewStoredStocks(zap.NewNop(), upstream, &memBarStore{intraday: map[string]IntradayBar{}})
+	for i := 0; i < 2; i++ {
+		if _, err := stocks.Intraday(context.Background(), "AAPL", IntradayQuery{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(upstream.asked) != 2 {
+		t.Errorf("latest bars asked upstream %d times, want 2", len(upstream.asked))
+	}
+}
+
+func TestMissingRanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    DateRange
+		covered []DateRange
+		gaps    []DateRange
+	}{
+		{"nothing covered", DateRange{"2024-01-01", "2024-01-10"}, nil, []DateRange{{"2024-01-01", "2024-01-10"}}},
+		{"all covered", DateRange{"2024-01-02", "2024-01-05"}, []DateRange{{"2024-01-01", "2024-01-10"}}, []DateRange{}},
+		{"hole in the middle", DateRange{"2024-01-01", "2024-01-10"}, []DateRange{{"2024-01-01", "2024-01-03"}, {"2024-01-07", "2024-01-10"}}, []DateRange{{"2024-01-04", "2024-01-06"}}},
+		{"unsorted overlapping coverage", DateRange{"2024-01-01", "2024-01-10"}, []DateRange{{"2024-01-05", "2024-01-08"}, {"2024-01-02", "2024-01-06"}}, []DateRange{{"2024-01-01", "2024-01-01"}, {"2024-01-09", "2024-01-10"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingRanges(tt.want, tt.covered); !reflect.DeepEqual(got, tt.gaps) {
+				t.Errorf("got %v, want %v", got, tt.gaps)
+			}
+		})
+	}
+}
+
+func TestParseIntradayQuery(t *testing.T) {
+	tests := []struct {
+		from, to string
+		ok       bool
+	}{
+		{"", "", true},
+		{"2024-01-01", "2024-01-31", true},
+		{"2024-01-01", "", false},
+		{"2024-01-05", "2024-01-01", false},
+		{"2024-01-01", "2024-03-01", false},
+		{"01/01/2024", "2024-01-02", false},
+	}
+	for _, tt := range tests {
+		_, err := ParseIntradayQuery(map[string][]string{"date_from": {tt.from}, "date_to": {tt.to}})
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseIntradayQuery(%q, %q) error %v, want ok %v", tt.from, tt.to, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package portfolios
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
+	"github.com/jim-nnamdi/coldfinance/backend/users"
+	"github.com/jim-nnamdi/coldfinance/backend/watchlists"
+	"go.uber.org/zap"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidTransaction), errors.Is(err, watchlists.ErrInvalidItem):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrTransactionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrOversold):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// formDecimal reads the form value name, zero when it is empty. it must
+// fit the store's columns as given, so it is never rounded on the way
+// in.
+func formDecimal(r *http.Request, name string) (finance.Decimal, error) {
+	v := r.FormValue(name)
+	if v == "" {
+		return finance.Decimal{}, nil
+	}
+	d, err := finance.ParseDecimal(v)
+	if err != nil {
+		return d, fmt.Errorf("%w: %s must be a decimal number", ErrInvalidTransaction, name)
+	}
+	if !d.Fits(amountDigits, amountPlaces) {
+		return finance.Decimal{}, fmt.Errorf("%w: %s takes at most %d digits before the point and %d after", ErrInvalidTransaction, name, amountDigits, amountPlaces)
+	}
+	return d, nil
+}
+
+// formDay reads the date form value, a day, today when it is empty.
+// times of day are not taken: trades are ordered by day and then by
+// when they were recorded, which a mix of days and times would upset.
+func formDay(r *http.Request) (time.Time, error) {
+	v := r.FormValue("date")
+	if v == "" {
+		return time.Now().UTC(), nil
+	}
+	t, err := time.Parse(tradeDayLayout, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: date must be YYYY-MM-DD", ErrInvalidTransaction)
+	}
+	return t, nil
+}
+
+// GetPortfolio returns the holdings and P&L of the current user, with
+// cost basis by the method form value, fifo or average.
+func (s *Service) GetPortfolio(w http.ResponseWriter, r *http.Request) {
+	user := users.RequireUser(w, r)
+	if user == nil {
+		return
+	}
+	p, err := s.Portfolio(r.Context(), user.Id, r.FormValue("method"))
+	if err != nil {
+		s.logger.Debug("could not value portfolio", zap.Int("user", user.Id), zap.Any("error", err))
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// ManageTransactions lists the transactions of the current user on GET
+// and records one on POST from the kind, symbol, side, quantity, price,
+// fee and date form values.
+func (s *Service) ManageTransactions(w http.ResponseWriter, r *http.Request) {
+	user := users.RequireUser(w, r)
+	if user == nil {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		txs, err := s.Transactions(r.Context(), user.Id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, txs)
+	case http.MethodPost:
+		tx := Transaction{
+			UserId: user.Id,
+			Kind:   r.FormValue("kind"),
+			Symbol: r.FormValue("symbol"),
+			Side:   r.FormValue("side"),
+		}
+		var err error
+		for name, to := range map[string]*finance.Decimal{"quantity": &tx.Quantity, "price": &tx.Price, "fee": &tx.Fee} {
+			if *to, err = formDecimal(r, name); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if tx.TradedAt, err = formDay(r); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := s.AddTransaction(r.Context(), &tx); err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, tx)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use GET or POST"))
+	}
+}
+
+// RemoveTransaction removes the transaction given by id.
+func (s *Service) RemoveTransaction(w http.ResponseWriter, r *http.Request) {
+	user := users.RequireUser(w, r)
+	if user == nil {
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use POST or DELETE"))
+		return
+	}
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, errors.New("id must be a positive whole number"))
+		return
+	}
+	if err := s.DeleteTransaction(r.Context(), user.Id, id); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"deleted": id})
+}
@@ -0,0 +1,105 @@
+package portfolios
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
+	"github.com/jim-nnamdi/coldfinance/backend/watchlists"
+)
+
+// cost basis methods: which buys a sell is taken from
+const (
+	FIFO    = "fifo"
+	Average = "average"
+)
+
+var ErrOversold = errors.New("sell is larger than the holding")
+
+// lot is a quantity bought at one cost per unit, fees included.
+type lot struct {
+	quantity finance.Decimal
+	cost     finance.Decimal
+}
+
+// holding is what the transactions of one symbol add up to. with
+// Average there is never more than one lot, at the average cost.
+type holding struct {
+	item     watchlists.Item
+	lots     []lot
+	realized finance.Decimal
+}
+
+func (h *holding) quantity() finance.Decimal {
+	var q finance.Decimal
+	for _, l := range h.lots {
+		q = q.Add(l.quantity)
+	}
+	return q
+}
+
+func (h *holding) costBasis() finance.Decimal {
+	var c finance.Decimal
+	for _, l := range h.lots {
+		c = c.Add(l.quantity.Mul(l.cost))
+	}
+	return c
+}
+
+func (h *holding) buy(tx Transaction, method string) {
+	total := tx.Quantity.Mul(tx.Price).Add(tx.Fee)
+	if method == Average && len(h.lots) > 0 {
+		q := h.quantity().Add(tx.Quantity)
+		h.lots = []lot{{quantity: q, cost: h.costBasis().Add(total).Quo(q)}}
+		return
+	}
+	h.lots = append(h.lots, lot{quantity: tx.Quantity, cost: total.Quo(tx.Quantity)})
+}
+
+// sell takes tx out of the oldest lots and books what it made over
+// their cost, fees off.
+func (h *holding) sell(tx Transaction) error {
+	if tx.Quantity.Cmp(h.quantity()) > 0 {
+		return fmt.Errorf("%w: selling %s %s on %s with %s held", ErrOversold, tx.Quantity, tx.Symbol, tx.TradedAt.Format(tradeDayLayout), h.quantity())
+	}
+	left := tx.Quantity
+	var cost finance.Decimal
+	for left.Sign() > 0 {
+		l := &h.lots[0]
+		if l.quantity.Cmp(left) > 0 {
+			cost = cost.Add(left.Mul(l.cost))
+			l.quantity = l.quantity.Sub(left)
+			break
+		}
+		cost = cost.Add(l.quantity.Mul(l.cost))
+		left = left.Sub(l.quantity)
+		h.lots = h.lots[1:]
+	}
+	h.realized = h.realized.Add(tx.Quantity.Mul(tx.Price).Sub(tx.Fee).Sub(cost))
+	return nil
+}
+
+// replay runs txs, oldest first, into a holding per symbol in the
+// order the symbols were first traded. it fails on a sell of more than
+// was held at the time.
+func replay(txs []Transaction, method string) ([]*holding, error) {
+	holdings := make([]*holding, 0)
+	bySymbol := map[watchlists.Item]*holding{}
+	for _, tx := range txs {
+		it := watchlists.Item{Kind: tx.Kind, Symbol: tx.Symbol}
+		h, ok := bySymbol[it]
+		if !ok {
+			h = &holding{item: it, lots: make([]lot, 0)}
+			bySymbol[it] = h
+			holdings = append(holdings, h)
+		}
+		if tx.Side == Sell {
+			if err := h.sell(tx); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		h.buy(tx, method)
+	}
+	return holdings, nil
+}
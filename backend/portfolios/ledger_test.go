@@ -0,0 +1,157 @@
+package portfolios
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	trade := func(side string, quantity string, price string, fee string) Transaction {
+		tx := Transaction{Kind: "coin", Symbol: "BTC", Side: side, Quantity: dec(quantity), Price: dec(price)}
+		if fee != "" {
+			tx.Fee = dec(fee)
+		}
+		return tx
+	}
+	tests := []struct {
+		name      string
+		method    string
+		txs       []Transaction
+		quantity  string
+		costBasis string
+		realized  string
+		lots      int
+		wantErr   error
+	}{
+		{
+			name:      "fifo sells the oldest lot first and part of the next",
+			method:    FIFO,
+			txs:       []Transaction{trade(Buy, "10", "10", ""), trade(Buy, "10", "20", ""), trade(Sell, "15", "30", "")},
+			quantity:  "5",
+			costBasis: "100",
+			realized:  "250",
+			lots:      1,
+		},
+		{
+			name:      "fifo keeps lots apart",
+			method:    FIFO,
+			txs:       []Transaction{trade(Buy, "10", "10", ""), trade(Buy, "10", "20", "")},
+			quantity:  "20",
+			costBasis: "300",
+			realized:  "0",
+			lots:      2,
+		},
+		{
+			name:      "average re-bases the cost on every buy",
+			method:    Average,
+			txs:       []Transaction{trade(Buy, "10", "10", ""), trade(Buy, "10", "20", ""), trade(Sell, "15", "30", "")},
+			quantity:  "5",
+			costBasis: "75",
+			realized:  "225",
+			lots:      1,
+		},
+		{
+			name:      "average after a sell",
+			method:    Average,
+			txs:       []Transaction{trade(Buy, "10", "10", ""), trade(Sell, "5", "12", ""), trade(Buy, "5", "16", "")},
+			quantity:  "10",
+			costBasis: "130",
+			realized:  "10",
+			lots:      1,
+		},
+		{
+			name:      "buy fee adds to the cost",
+			method:    FIFO,
+			txs:       []Transaction{trade(Buy, "10", "10", "5")},
+			quantity:  "10",
+			costBasis: "105",
+			realized:  "0",
+			lots:      1,
+		},
+		{
+			name:      "sell fee comes off the realized",
+			method:    FIFO,
+			txs:       []Transaction{trade(Buy, "10", "10", ""), trade(Sell, "4", "15", "2")},
+			quantity:  "6",
+			costBasis: "60",
+			realized:  "18",
+			lots:      1,
+		},
+		{
+			name:      "full close out",
+			method:    FIFO,
+			txs:       []Transaction{trade(Buy, "1.5", "100", ""), trade(Buy, "0.5", "200", ""), trade(Sell, "2", "150", "")},
+			quantity:  "0",
+			costBasis: "0",
+			realized:  "50",
+			lots:      0,
+		},
+		{
+			name:    "oversell",
+			method:  FIFO,
+			txs:     []Transaction{trade(Buy, "1", "100", ""), trade(Sell, "1.00000001", "150", "")},
+			wantErr: ErrOversold,
+		},
+		{
+			name:    "sell before any buy",
+			method:  Average,
+			txs:     []Transaction{trade(Sell, "1", "150", "")},
+			wantErr: ErrOversold,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holdings, err := replay(tt.txs, tt.method)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(holdings) != 1 {
+				t.Fatalf("got %d holdings, want 1", len(holdings))
+			}
+			h := holdings[0]
+			if got := h.quantity().String(); got != tt.quantity {
+				t.Errorf("quantity %s, want %s", got, tt.quantity)
+			}
+			if got := h.costBasis().String(); got != tt.costBasis {
+				t.Errorf("cost basis %s, want %s", got, tt.costBasis)
+			}
+			if got := h.realized.String(); got != tt.realized {
+				t.Errorf("realized %s, want %s", got, tt.realized)
+			}
+			if len(h.lots) != tt.lots {
+				t.Errorf("%d lots left, want %d", len(h.lots), tt.lots)
+			}
+		})
+	}
+}
+
+func TestReplayKeepsSymbolsApart(t *testing.T) {
+	txs := []Transaction{
+		{Kind: "coin", Symbol: "BTC", Side: Buy, Quantity: dec("1"), Price: dec("100")},
+		{Kind: "stock", Symbol: "BTC", Side: Buy, Quantity: dec("2"), Price: dec("5")},
+		{Kind: "coin", Symbol: "ETH", Side: Buy, Quantity: dec("3"), Price: dec("10")},
+		{Kind: "coin", Symbol: "BTC", Side: Sell, Quantity: dec("1"), Price: dec("110")},
+	}
+	holdings, err := replay(txs, FIFO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		kind, symbol, quantity string
+	}{{"coin", "BTC", "0"}, {"stock", "BTC", "2"}, {"coin", "ETH", "3"}}
+	if len(holdings) != len(want) {
+		t.Fatalf("got %d holdings, want %d", len(holdings), len(want))
+	}
+	for i, w := range want {
+		h := holdings[i]
+		if h.item.Kind != w.kind || h.item.Symbol != w.symbol || h.quantity().String() != w.quantity {
+			t.Errorf("holding %d is %s %s:%s, want %s %s:%s", i, h.quantity(), h.item.Kind, h.item.Symbol, w.quantity, w.kind, w.symbol)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package portfolios
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
+	"github.com/jim-nnamdi/coldfinance/backend/stream"
+	"github.com/jim-nnamdi/coldfinance/backend/watchlists"
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+var ErrInvalidTransaction = errors.New("invalid transaction")
+
+type Config struct {
+	// currency transactions are recorded and positions valued in
+	Currency string
+	// currency the stock vendor quotes in
+	StockCurrency string
+	// cost basis method used when a request names none
+	Method string
+	// most transactions one user may record
+	MaxTransactions int
+}
+
+// ConfigFromEnv reads PORTFOLIOS_CURRENCY and
+// PORTFOLIOS_STOCK_CURRENCY (USD by default), PORTFOLIOS_COST_METHOD
+// (fifo) and PORTFOLIOS_MAX_TRANSACTIONS (1000).
+func ConfigFromEnv() Config {
+	_ = godotenv.Load()
+	config := Config{Currency: "USD", StockCurrency: "USD", Method: FIFO, MaxTransactions: 1000}
+	if v := strings.ToUpper(strings.TrimSpace(os.Getenv("PORTFOLIOS_CURRENCY"))); v != "" {
+		config.Currency = v
+	}
+	if v := strings.ToUpper(strings.TrimSpace(os.Getenv("PORTFOLIOS_STOCK_CURRENCY"))); v != "" {
+		config.StockCurrency = v
+	}
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("PORTFOLIOS_COST_METHOD"))); v == FIFO || v == Average {
+		config.Method = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("PORTFOLIOS_MAX_TRANSACTIONS")); err == nil && v > 0 {
+		config.MaxTransactions = v
+	}
+	return config
+}
+
+// Pricer quotes stocks and coins, as the watchlists service does.
+// coins are asked for in target and come in the Target of their quote,
+// stocks in the currency the vendor quotes in.
+type Pricer interface {
+	Price(ctx context.Context, items []watchlists.Item, target string) []watchlists.Quote
+}
+
+// FXRates prices one fiat currency in another, as the finance FX table
+// does.
+type FXRates interface {
+	Price(ccy string, in string) (finance.Decimal, error)
+}
+
+// Position is one stock or coin of a portfolio. a position sold off
+// entirely stays listed for its realized P&L. the market fields are
+// only set for open positions that could be priced, Error telling why
+// when one could not.
+type Position struct {
+	watchlists.Item
+	Quantity    finance.Decimal `json:"quantity"`
+	AverageCost finance.Decimal `json:"average_cost"`
+	CostBasis   finance.Decimal `json:"cost_basis"`
+	Realized    finance.Decimal `json:"realized"`
+
+	Price             *finance.Decimal `json:"price,omitempty"`
+	MarketValue       *finance.Decimal `json:"market_value,omitempty"`
+	Unrealized        *finance.Decimal `json:"unrealized,omitempty"`
+	UnrealizedPercent *float64         `json:"unrealized_percent,omitempty"`
+	// share of the priced market value of the portfolio, in percent
+	Allocation float64 `json:"allocation"`
+	Source     string  `json:"source,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Portfolio is what the transactions of a user hold and made. the
+// market value and unrealized totals only count priced positions.
+type Portfolio struct {
+	Currency    string          `json:"currency"`
+	Method      string          `json:"method"`
+	CostBasis   finance.Decimal `json:"cost_basis"`
+	MarketValue finance.Decimal `json:"market_value"`
+	Realized    finance.Decimal `json:"realized"`
+	Unrealized  finance.Decimal `json:"unrealized"`
+	Positions   []Position      `json:"positions"`
+}
+
+// Service records transactions and values the portfolios they make up.
+type Service struct {
+	logger *zap.Logger
+	store  Store
+	pricer Pricer
+	fx     FXRates
+	config Config
+}
+
+// NewService values portfolios at the quotes of pricer, with stock
+// quotes converted to the portfolio currency at the rates of fx.
+func NewService(logger *zap.Logger, store Store, pricer Pricer, fx FXRates, config Config) *Service {
+	return &Service{
+		logger: logger,
+		store:  store,
+		pricer: pricer,
+		fx:     fx,
+		config: config,
+	}
+}
+
+func (s *Service) Transactions(ctx context.Context, userId int) ([]Transaction, error) {
+	return s.store.Transactions(ctx, userId)
+}
+
+// AddTransaction checks tx and records it, refusing a sell of more
+// than was held at that point of its day.
+func (s *Service) AddTransaction(ctx context.Context, tx *Transaction) error {
+	it, err := watchlists.NewItem(tx.Kind, tx.Symbol)
+	if err != nil {
+		return err
+	}
+	tx.Symbol = it.Symbol
+	switch {
+	case tx.Side != Buy && tx.Side != Sell:
+		return fmt.Errorf("%w: side must be %s or %s", ErrInvalidTransaction, Buy, Sell)
+	case tx.Quantity.Sign() <= 0:
+		return fmt.Errorf("%w: quantity must be more than zero", ErrInvalidTransaction)
+	case tx.Price.Sign() < 0 || tx.Fee.Sign() < 0:
+		return fmt.Errorf("%w: price and fee must not be negative", ErrInvalidTransaction)
+	}
+	tx.TradedAt = tradeDay(tx.TradedAt)
+	if tx.TradedAt.After(tradeDay(time.Now())) {
+		return fmt.Errorf("%w: trade date is in the future", ErrInvalidTransaction)
+	}
+
+	return s.store.AddTransaction(ctx, tx, func(txs []Transaction) error {
+		if len(txs) >= s.config.MaxTransactions {
+			return fmt.Errorf("%w: at most %d transactions per user", ErrInvalidTransaction, s.config.MaxTransactions)
+		}
+		// tx is recorded last, so it goes after the stored ones of its day
+		i := sort.Search(len(txs), func(i int) bool { return txs[i].TradedAt.After(tx.TradedAt) })
+		txs = append(txs[:i], append([]Transaction{*tx}, txs[i:]...)...)
+		_, err := replay(txs, FIFO)
+		return err
+	})
+}
+
+// tradeDay is the UTC day of t, the only precision trades are kept at.
+func tradeDay(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// DeleteTransaction removes a transaction of userId unless a later sell
+// would then be larger than the holding.
+func (s *Service) DeleteTransaction(ctx context.Context, userId int, id int) error {
+	return s.store.DeleteTransaction(ctx, userId, id, func(txs []Transaction) error {
+		rest := make([]Transaction, 0, len(txs))
+		for _, tx := range txs {
+			if tx.Id != id {
+				rest = append(rest, tx)
+			}
+		}
+		if len(rest) == len(txs) {
+			return ErrTransactionNotFound
+		}
+		_, err := replay(rest, FIFO)
+		return err
+	})
+}
+
+// Portfolio values the holdings of userId with method, the configured
+// one when empty, at the latest prices.
+func (s *Service) Portfolio(ctx context.Context, userId int, method string) (*Portfolio, error) {
+	method = strings.ToLower(strings.TrimSpace(method))
+	if method == "" {
+		method = s.config.Method
+	}
+	if method != FIFO && method != Average {
+		return nil, fmt.Errorf("%w: method must be %s or %s", ErrInvalidTransaction, FIFO, Average)
+	}
+	txs, err := s.store.Transactions(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	holdings, err := replay(txs, method)
+	if err != nil {
+		return nil, err
+	}
+
+	open := make([]watchlists.Item, 0, len(holdings))
+	for _, h := range holdings {
+		if h.quantity().Sign() > 0 {
+			open = append(open, h.item)
+		}
+	}
+	quotes := map[watchlists.Item]watchlists.Quote{}
+	if len(open) > 0 {
+		for _, q := range s.pricer.Price(ctx, open, s.config.Currency) {
+			quotes[q.Item] = q
+		}
+	}
+
+	p := &Portfolio{Currency: s.config.Currency, Method: method, Positions: make([]Position, 0, len(holdings))}
+	for _, h := range holdings {
+		pos := Position{Item: h.item, Quantity: h.quantity(), CostBasis: h.costBasis(), Realized: h.realized}
+		p.Realized = p.Realized.Add(pos.Realized)
+		p.CostBasis = p.CostBasis.Add(pos.CostBasis)
+		if pos.Quantity.Sign() > 0 {
+			pos.AverageCost = pos.CostBasis.Quo(pos.Quantity)
+			q := quotes[h.item]
+			currency := s.config.StockCurrency
+			if h.item.Kind != stream.KindStock {
+				// coins are asked for in the portfolio currency, but a
+				// provider may answer in its own
+				currency = q.Target
+			}
+			s.value(&pos, q, currency)
+		}
+		if pos.MarketValue != nil {
+			p.MarketValue = p.MarketValue.Add(*pos.MarketValue)
+			p.Unrealized = p.Unrealized.Add(*pos.Unrealized)
+		}
+		p.Positions = append(p.Positions, pos)
+	}
+	if p.MarketValue.Sign() > 0 {
+		for i, pos := range p.Positions {
+			if pos.MarketValue != nil {
+				p.Positions[i].Allocation = pos.MarketValue.Quo(p.MarketValue).Float64() * 100
+			}
+		}
+	}
+	return p, nil
+}
+
+// rate is what one unit of currency is worth in the portfolio
+// currency.
+func (s *Service) rate(currency string) (finance.Decimal, error) {
+	switch {
+	case currency == s.config.Currency:
+		return finance.DecimalFromFloat(1), nil
+	case currency == "":
+		return finance.Decimal{}, fmt.Errorf("%w: quote has no currency", finance.ErrUnknownCurrency)
+	case s.fx == nil:
+		return finance.Decimal{}, fmt.Errorf("%w: no fx rates to value %s quotes in %s", finance.ErrUnknownCurrency, currency, s.config.Currency)
+	}
+	return s.fx.Price(currency, s.config.Currency)
+}
+
+// value prices an open position at q, quoted in currency and converted
+// to the portfolio currency.
+func (s *Service) value(pos *Position, q watchlists.Quote, currency string) {
+	switch {
+	case q.Error != "":
+		pos.Error = q.Error
+		return
+	case q.Symbol == "":
+		pos.Error = finance.ErrSymbolNotFound.Error()
+		return
+	}
+	rate, err := s.rate(currency)
+	if err != nil {
+		pos.Error = err.Error()
+		return
+	}
+	price := finance.DecimalFromFloat(q.Price).Mul(rate)
+	market := pos.Quantity.Mul(price)
+	unrealized := market.Sub(pos.CostBasis)
+	pos.Price, pos.MarketValue, pos.Unrealized, pos.Source = &price, &market, &unrealized, q.Source
+	if pos.CostBasis.Sign() > 0 {
+		pct := unrealized.Quo(pos.CostBasis).Float64() * 100
+		pos.UnrealizedPercent = &pct
+	}
+}
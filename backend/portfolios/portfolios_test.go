@@ -0,0 +1,266 @@
+package portfolios
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
+	"github.com/jim-nnamdi/coldfinance/backend/watchlists"
+	"go.uber.org/zap"
+)
+
+// memStore keeps transactions in memory. like the locking read of the
+// sql store, a write holds the others back from its read to its
+// insert, and reads take a moment to come back.
+type memStore struct {
+	mu     sync.Mutex
+	nextId int
+	txs    []Transaction
+}
+
+func (m *memStore) Transactions(ctx context.Context, userId int) ([]Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.read(userId), nil
+}
+
+func (m *memStore) read(userId int) []Transaction {
+	out := make([]Transaction, 0)
+	for _, tx := range m.txs {
+		if tx.UserId == userId {
+			out = append(out, tx)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].TradedAt.Before(out[j].TradedAt) })
+	time.Sleep(5 * time.Millisecond)
+	return out
+}
+
+func (m *memStore) AddTransaction(ctx context.Context, tx *Transaction, check Check) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := check(m.read(tx.UserId)); err != nil {
+		return err
+	}
+	m.nextId++
+	tx.Id = m.nextId
+	m.txs = append(m.txs, *tx)
+	return nil
+}
+
+func (m *memStore) DeleteTransaction(ctx context.Context, userId int, id int, check Check) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := check(m.read(userId)); err != nil {
+		return err
+	}
+	for i, tx := range m.txs {
+		if tx.Id == id && tx.UserId == userId {
+			m.txs = append(m.txs[:i], m.txs[i+1:]...)
+			return nil
+		}
+	}
+	return ErrTransactionNotFound
+}
+
+func dec(s string) finance.Decimal {
+	d, err := finance.ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestConcurrentSellsCannotOversell(t *testing.T) {
+	store := &memStore{}
+	s := NewService(zap.NewNop(), store, nil, nil, Config{Currency: "USD", Method: FIFO, MaxTransactions: 100})
+	day := time.Now().UTC().AddDate(0, 0, -2)
+	buy := &Transaction{UserId: 1, Kind: "coin", Symbol: "BTC", Side: Buy, Quantity: dec("1"), Price: dec("100"), TradedAt: day}
+	if err := s.AddTransaction(context.Background(), buy); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sell := &Transaction{UserId: 1, Kind: "coin", Symbol: "BTC", Side: Sell, Quantity: dec("1"), Price: dec("120"), TradedAt: day.AddDate(0, 0, 1)}
+			errs[i] = s.AddTransaction(context.Background(), sell)
+		}(i)
+	}
+	wg.Wait()
+
+	sold := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			sold++
+		case !errors.Is(err, ErrOversold):
+			t.Errorf("got %v, want ErrOversold", err)
+		}
+	}
+	if sold != 1 {
+		t.Errorf("%d of the sells went through, want 1", sold)
+	}
+}
+
+// fixedPricer quotes every item at its price, stocks in USD and coins
+// in coinTarget, or else the target asked for.
+type fixedPricer struct {
+	prices     map[string]float64
+	coinTarget string
+}
+
+func (p fixedPricer) Price(ctx context.Context, items []watchlists.Item, target string) []watchlists.Quote {
+	if p.coinTarget != "" {
+		target = p.coinTarget
+	}
+	quotes := make([]watchlists.Quote, 0, len(items))
+	for _, it := range items {
+		q := watchlists.Quote{Item: it, Price: p.prices[it.Symbol]}
+		if it.Kind == "coin" {
+			q.Target = target
+		}
+		quotes = append(quotes, q)
+	}
+	return quotes
+}
+
+// fxTable prices currencies in USD.
+type fxTable map[string]string
+
+func (f fxTable) Price(ccy string, in string) (finance.Decimal, error) {
+	of, ok := f[ccy]
+	base, ok2 := f[in]
+	if !ok || !ok2 {
+		return finance.Decimal{}, finance.ErrUnknownCurrency
+	}
+	return dec(of).Quo(dec(base)), nil
+}
+
+func TestPortfolioConvertsQuotes(t *testing.T) {
+	day := time.Now().UTC().AddDate(0, 0, -1)
+	usdEur := fxTable{"USD": "1", "EUR": "1.25"}
+	tests := []struct {
+		name       string
+		currency   string
+		fx         FXRates
+		coinTarget string
+		stockPrice string
+		coinPrice  string
+	}{
+		{name: "same currency", currency: "USD", stockPrice: "100", coinPrice: "20"},
+		{name: "stocks converted", currency: "EUR", fx: usdEur, stockPrice: "80", coinPrice: "20"},
+		{name: "no stock rate", currency: "GBP", fx: usdEur, coinPrice: "20"},
+		{name: "no fx table", currency: "EUR", coinPrice: "20"},
+		{name: "coins in the provider's currency", currency: "EUR", fx: usdEur, coinTarget: "USD", stockPrice: "80", coinPrice: "16"},
+		{name: "coins in a currency without a rate", currency: "EUR", fx: usdEur, coinTarget: "JPY", stockPrice: "80"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memStore{txs: []Transaction{
+				{Id: 1, UserId: 1, Kind: "stock", Symbol: "AAPL", Side: Buy, Quantity: dec("2"), Price: dec("50"), TradedAt: day},
+				{Id: 2, UserId: 1, Kind: "coin", Symbol: "BTC", Side: Buy, Quantity: dec("1"), Price: dec("10"), TradedAt: day},
+			}}
+			pricer := fixedPricer{prices: map[string]float64{"AAPL": 100, "BTC": 20}, coinTarget: tt.coinTarget}
+			s := NewService(zap.NewNop(), store, pricer, tt.fx, Config{Currency: tt.currency, StockCurrency: "USD", Method: FIFO, MaxTransactions: 100})
+
+			p, err := s.Portfolio(context.Background(), 1, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			market := finance.Decimal{}
+			for _, c := range []struct {
+				pos  Position
+				want string
+			}{{p.Positions[0], tt.stockPrice}, {p.Positions[1], tt.coinPrice}} {
+				if c.want == "" {
+					if c.pos.Error == "" || c.pos.Price != nil {
+						t.Errorf("%s priced at %v with error %q, want an error and no price", c.pos.Symbol, c.pos.Price, c.pos.Error)
+					}
+					continue
+				}
+				if c.pos.Price == nil || c.pos.Price.String() != c.want {
+					t.Errorf("%s priced at %v (%s), want %s", c.pos.Symbol, c.pos.Price, c.pos.Error, c.want)
+					continue
+				}
+				market = market.Add(*c.pos.MarketValue)
+			}
+			if p.MarketValue.String() != market.String() {
+				t.Errorf("market value %s, want %s of the priced positions only", p.MarketValue, market)
+			}
+		})
+	}
+}
+
+func TestTradesOfOneDayKeepTheirOrder(t *testing.T) {
+	store := &memStore{}
+	s := NewService(zap.NewNop(), store, nil, nil, Config{Currency: "USD", Method: FIFO, MaxTransactions: 100})
+	ctx := context.Background()
+	morning := time.Now().UTC().AddDate(0, 0, -1)
+	day := tradeDay(morning)
+
+	sell := &Transaction{UserId: 1, Kind: "coin", Symbol: "BTC", Side: Sell, Quantity: dec("1"), Price: dec("10"), TradedAt: morning}
+	if err := s.AddTransaction(ctx, sell); !errors.Is(err, ErrOversold) {
+		t.Fatalf("sell before any buy: got %v, want ErrOversold", err)
+	}
+	buy := &Transaction{UserId: 1, Kind: "coin", Symbol: "BTC", Side: Buy, Quantity: dec("1"), Price: dec("10"), TradedAt: morning.Add(time.Hour)}
+	if err := s.AddTransaction(ctx, buy); err != nil {
+		t.Fatal(err)
+	}
+	if !buy.TradedAt.Equal(day) {
+		t.Errorf("traded at %s, want the day %s", buy.TradedAt, day)
+	}
+	// recorded after the buy, so it counts after it on the same day
+	if err := s.AddTransaction(ctx, sell); err != nil {
+		t.Errorf("sell after the buy of the same day: %v", err)
+	}
+
+	future := &Transaction{UserId: 1, Kind: "coin", Symbol: "BTC", Side: Buy, Quantity: dec("1"), Price: dec("10"), TradedAt: day.AddDate(0, 0, 2)}
+	if err := s.AddTransaction(ctx, future); !errors.Is(err, ErrInvalidTransaction) {
+		t.Errorf("trade in the future: got %v, want ErrInvalidTransaction", err)
+	}
+}
+
+func TestFormDecimal(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "", want: "0"},
+		{in: "1.25", want: "1.25"},
+		{in: "0.000000000000000001", want: "0.000000000000000001"},
+		{in: "99999999999999999999", want: "99999999999999999999"},
+		{in: "0.0000000000000000001", wantErr: true},
+		{in: "100000000000000000000", wantErr: true},
+		{in: "1e30", wantErr: true},
+		{in: "ten", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/portfolio/transactions", strings.NewReader(url.Values{"quantity": {tt.in}}.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			d, err := formDecimal(r, "quantity")
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidTransaction) {
+					t.Errorf("got %s, %v, want ErrInvalidTransaction", d, err)
+				}
+				return
+			}
+			if err != nil || d.String() != tt.want {
+				t.Errorf("got %s, %v, want %s", d, err, tt.want)
+			}
+		})
+	}
+}
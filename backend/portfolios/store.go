@@ -0,0 +1,184 @@
+package portfolios
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
+	"go.uber.org/zap"
+)
+
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// DATETIME columns come back as text, the dsn does not parse times
+const sqlTimeLayout = "2006-01-02 15:04:05"
+
+const tradeDayLayout = "2006-01-02"
+
+// quantity, price and fee are DECIMAL(38,18) columns
+const (
+	amountDigits = 20
+	amountPlaces = 18
+)
+
+const (
+	Buy  = "buy"
+	Sell = "sell"
+)
+
+// Transaction is a buy or sell of a stock or coin. Price is per unit
+// and, like Fee, in the portfolio currency. TradedAt is the UTC day of
+// the trade, at midnight: trades of one day count in the order they
+// were recorded, by Id.
+type Transaction struct {
+	Id       int             `json:"id"`
+	UserId   int             `json:"user_id"`
+	Kind     string          `json:"kind"`
+	Symbol   string          `json:"symbol"`
+	Side     string          `json:"side"`
+	Quantity finance.Decimal `json:"quantity"`
+	Price    finance.Decimal `json:"price"`
+	Fee      finance.Decimal `json:"fee"`
+	TradedAt time.Time       `json:"traded_at"`
+}
+
+// Check looks at the stored transactions of a user before a write
+// goes ahead, failing it with the error it returns.
+type Check func(txs []Transaction) error
+
+type Store interface {
+	// Transactions are those of userId by trade day, then by id
+	Transactions(ctx context.Context, userId int) ([]Transaction, error)
+	// AddTransaction stores tx if check passes on the transactions of
+	// its user, which no other write can change in between
+	AddTransaction(ctx context.Context, tx *Transaction, check Check) error
+	// DeleteTransaction removes a transaction of userId if check passes
+	// on all of them, ErrTransactionNotFound when there is no such one
+	DeleteTransaction(ctx context.Context, userId int, id int, check Check) error
+}
+
+var _ Store = &sqlStore{}
+
+type sqlStore struct {
+	logger *zap.Logger
+	db     *sql.DB
+}
+
+func NewStore(logger *zap.Logger, db *sql.DB) *sqlStore {
+	return &sqlStore{
+		logger: logger,
+		db:     db,
+	}
+}
+
+// querier is a *sql.DB or *sql.Tx.
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+const transactionsQuery = "select id, user_id, kind, symbol, side, quantity, price, fee, traded_at from portfolio_transactions where user_id = ? order by traded_at, id"
+
+func (s *sqlStore) Transactions(ctx context.Context, userId int) ([]Transaction, error) {
+	return s.queryTransactions(ctx, s.db, transactionsQuery, userId)
+}
+
+func (s *sqlStore) queryTransactions(ctx context.Context, q querier, query string, args ...any) ([]Transaction, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		s.logger.Debug("could not fetch transactions", zap.Any("error", err))
+		return nil, err
+	}
+	defer rows.Close()
+	txs := make([]Transaction, 0)
+	for rows.Next() {
+		var (
+			tx                   Transaction
+			quantity, price, fee string
+			traded               string
+		)
+		if err := rows.Scan(&tx.Id, &tx.UserId, &tx.Kind, &tx.Symbol, &tx.Side, &quantity, &price, &fee, &traded); err != nil {
+			s.logger.Debug("could not scan transaction", zap.Any("error", err))
+			return nil, err
+		}
+		for _, d := range []struct {
+			to *finance.Decimal
+			v  string
+		}{{&tx.Quantity, quantity}, {&tx.Price, price}, {&tx.Fee, fee}} {
+			if *d.to, err = finance.ParseDecimal(d.v); err != nil {
+				return nil, err
+			}
+		}
+		// a zero time would move the trade to the front of the replay
+		if tx.TradedAt, err = time.Parse(sqlTimeLayout, traded); err != nil {
+			s.logger.Debug("could not read trade date", zap.Int("transaction", tx.Id), zap.Any("error", err))
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, rows.Err()
+}
+
+// lockTransactions starts a transaction holding the rows of userId, so
+// the writes of one user run one at a time, whichever server they
+// reach.
+func (s *sqlStore) lockTransactions(ctx context.Context, userId int) (*sql.Tx, []Transaction, error) {
+	dbtx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	txs, err := s.queryTransactions(ctx, dbtx, transactionsQuery+" for update", userId)
+	if err != nil {
+		dbtx.Rollback()
+		return nil, nil, err
+	}
+	return dbtx, txs, nil
+}
+
+func (s *sqlStore) AddTransaction(ctx context.Context, tx *Transaction, check Check) error {
+	dbtx, txs, err := s.lockTransactions(ctx, tx.UserId)
+	if err != nil {
+		return err
+	}
+	if err := check(txs); err != nil {
+		dbtx.Rollback()
+		return err
+	}
+	res, err := dbtx.ExecContext(ctx, "insert into portfolio_transactions(user_id, kind, symbol, side, quantity, price, fee, traded_at, created_at) values(?,?,?,?,?,?,?,?,?)",
+		tx.UserId, tx.Kind, tx.Symbol, tx.Side, tx.Quantity.String(), tx.Price.String(), tx.Fee.String(), tx.TradedAt.Format(sqlTimeLayout), time.Now().UTC().Format(sqlTimeLayout))
+	if err != nil {
+		dbtx.Rollback()
+		s.logger.Debug("could not add transaction", zap.Any("error", err))
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		dbtx.Rollback()
+		return err
+	}
+	tx.Id = int(id)
+	return dbtx.Commit()
+}
+
+func (s *sqlStore) DeleteTransaction(ctx context.Context, userId int, id int, check Check) error {
+	dbtx, txs, err := s.lockTransactions(ctx, userId)
+	if err != nil {
+		return err
+	}
+	if err := check(txs); err != nil {
+		dbtx.Rollback()
+		return err
+	}
+	res, err := dbtx.ExecContext(ctx, "delete from portfolio_transactions where id = ? and user_id = ?", id, userId)
+	if err != nil {
+		dbtx.Rollback()
+		s.logger.Debug("could not delete transaction", zap.Any("error", err))
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		dbtx.Rollback()
+		return ErrTransactionNotFound
+	}
+	return dbtx.Commit()
+}
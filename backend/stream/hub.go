@@ -0,0 +1,426 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+const (
+	KindCoin  = "coin"
+	KindStock = "stock"
+)
+
+var (
+	ErrTooManySymbols = errors.New("too many symbols")
+	ErrUnknownKind    = errors.New("unknown kind")
+)
+
+// Update is a price that moved since the last poll. Previous and the
+// change are left at zero for the first price seen of a symbol.
+type Update struct {
+	Kind          string    `json:"kind"`
+	Symbol        string    `json:"symbol"`
+	Price         float64   `json:"price"`
+	Previous      float64   `json:"previous,omitempty"`
+	Change        float64   `json:"change"`
+	ChangePercent float64   `json:"change_percent"`
+	Target        string    `json:"target,omitempty"`
+	Time          time.Time `json:"time"`
+	Source        string    `json:"source,omitempty"`
+}
+
+func (u Update) key() string {
+	return key(u.Kind, u.Symbol)
+}
+
+func key(kind string, symbol string) string {
+	return kind + ":" + symbol
+}
+
+// Listener is told about the updates of every watched symbol, whether
+// or not a client subscribed to it. a listener declares the symbols it
+// needs with Watch like a subscription does, listening alone does not
+// get anything polled. it runs on the polling goroutine and must
+// return quickly.
+type Listener func(Update)
+
+type Config struct {
+	CoinInterval  time.Duration
+	StockInterval time.Duration
+	// most symbols one connection may subscribe to
+	MaxSymbols   int
+	WriteTimeout time.Duration
+	PingInterval time.Duration
+}
+
+// ConfigFromEnv reads STREAM_COIN_INTERVAL and STREAM_STOCK_INTERVAL
+// (a minute each by default), STREAM_MAX_SYMBOLS (100),
+// STREAM_WRITE_TIMEOUT (10s) and STREAM_PING (30s).
+func ConfigFromEnv() Config {
+	_ = godotenv.Load()
+	config := Config{
+		CoinInterval:  time.Minute,
+		StockInterval: time.Minute,
+		MaxSymbols:    100,
+		WriteTimeout:  10 * time.Second,
+		PingInterval:  30 * time.Second,
+	}
+	durations := map[string]*time.Duration{
+		"STREAM_COIN_INTERVAL":  &config.CoinInterval,
+		"STREAM_STOCK_INTERVAL": &config.StockInterval,
+		"STREAM_WRITE_TIMEOUT":  &config.WriteTimeout,
+		"STREAM_PING":           &config.PingInterval,
+	}
+	for env, d := range durations {
+		if v, err := time.ParseDuration(os.Getenv(env)); err == nil && v > 0 {
+			*d = v
+		}
+	}
+	if v, err := strconv.Atoi(os.Getenv("STREAM_MAX_SYMBOLS")); err == nil && v > 0 {
+		config.MaxSymbols = v
+	}
+	return config
+}
+
+// Hub polls the finance services on a schedule and fans the prices
+// that moved out to subscriptions and listeners. coins are polled
+// while a subscription or listener watches a coin, stocks only for the
+// symbols being watched.
+type Hub struct {
+	logger *zap.Logger
+	crypto finance.CryptoData
+	ticker finance.StockTicker
+	config Config
+
+	mu        sync.RWMutex
+	subs      map[*Subscription]struct{}
+	watched   map[string]map[string]int
+	last      map[string]Update
+	listeners []Listener
+}
+
+func NewHub(logger *zap.Logger, crypto finance.CryptoData, ticker finance.StockTicker, config Config) *Hub {
+	return &Hub{
+		logger:  logger,
+		crypto:  crypto,
+		ticker:  ticker,
+		config:  config,
+		subs:    map[*Subscription]struct{}{},
+		watched: map[string]map[string]int{KindCoin: {}, KindStock: {}},
+		last:    map[string]Update{},
+	}
+}
+
+// OnUpdate adds a listener, which is only told about the symbols
+// watched with Watch.
+func (h *Hub) OnUpdate(l Listener) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.listeners = append(h.listeners, l)
+}
+
+// Watch makes the hub poll symbols of kind until as many Unwatch calls
+// have been made. kind is KindCoin or KindStock, else ErrUnknownKind.
+func (h *Hub) Watch(kind string, symbols ...string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	watched, ok := h.watched[kind]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKind, kind)
+	}
+	for _, s := range symbols {
+		watched[s]++
+	}
+	return nil
+}
+
+func (h *Hub) Unwatch(kind string, symbols ...string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	watched, ok := h.watched[kind]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKind, kind)
+	}
+	for _, s := range symbols {
+		if watched[s]--; watched[s] <= 0 {
+			delete(watched, s)
+		}
+	}
+	return nil
+}
+
+// Last is the latest price seen of a symbol.
+func (h *Hub) Last(kind string, symbol string) (Update, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	u, ok := h.last[key(kind, symbol)]
+	return u, ok
+}
+
+// Run polls coins and stocks, each at its own interval, until ctx is
+// done.
+func (h *Hub) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		h.loop(ctx, h.config.CoinInterval, h.pollCoins)
+	}()
+	go func() {
+		defer wg.Done()
+		h.loop(ctx, h.config.StockInterval, h.pollStocks)
+	}()
+	wg.Wait()
+}
+
+func (h *Hub) loop(ctx context.Context, interval time.Duration, poll func(ctx context.Context)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		pctx, cancel := context.WithTimeout(ctx, interval)
+		poll(pctx)
+		cancel()
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (h *Hub) pollCoins(ctx context.Context) {
+	h.mu.RLock()
+	wanted := len(h.watched[KindCoin]) > 0
+	h.mu.RUnlock()
+	if !wanted {
+		return
+	}
+	live, err := h.crypto.GetLiveCryptoData(ctx, "")
+	if err != nil {
+		h.logger.Debug("could not poll coins", zap.Any("error", err))
+		return
+	}
+	at := time.Unix(int64(live.Timestamp), 0).UTC()
+	updates := make([]Update, 0, len(live.Rates))
+	for coin, rate := range live.Rates {
+		updates = append(updates, Update{Kind: KindCoin, Symbol: coin, Price: rate, Target: live.Target, Time: at, Source: live.Source})
+	}
+	h.publish(updates)
+}
+
+func (h *Hub) pollStocks(ctx context.Context) {
+	h.mu.RLock()
+	symbols := make([]string, 0, len(h.watched[KindStock]))
+	for s := range h.watched[KindStock] {
+		symbols = append(symbols, s)
+	}
+	h.mu.RUnlock()
+	if len(symbols) == 0 {
+		return
+	}
+	latest, err := h.ticker.GetIntradayLatest(ctx, symbols)
+	if err != nil {
+		h.logger.Debug("could not poll stocks", zap.Any("error", err))
+		return
+	}
+	updates := make([]Update, 0, len(latest.Data))
+	for _, bar := range latest.Data {
+		price := bar.Price()
+		if !price.Valid {
+			continue
+		}
+		at, _ := bar.Time()
+		updates = append(updates, Update{Kind: KindStock, Symbol: bar.Symbol, Price: price.Float64, Time: at.UTC(), Source: latest.Source})
+	}
+	h.publish(updates)
+}
+
+// publish keeps the updates whose price moved and hands them out,
+// listeners only getting those of watched symbols.
+func (h *Hub) publish(updates []Update) {
+	h.mu.Lock()
+	moved := make([]Update, 0, len(updates))
+	watched := make([]bool, 0, len(updates))
+	for _, u := range updates {
+		prev, ok := h.last[u.key()]
+		if ok && prev.Price == u.Price {
+			continue
+		}
+		if ok {
+			u.Previous = prev.Price
+			u.Change = u.Price - prev.Price
+			if prev.Price != 0 {
+				u.ChangePercent = u.Change / prev.Price * 100
+			}
+		}
+		h.last[u.key()] = u
+		moved = append(moved, u)
+		watched = append(watched, h.watched[u.Kind][u.Symbol] > 0)
+	}
+	subs := make([]*Subscription, 0, len(h.subs))
+	for s := range h.subs {
+		subs = append(subs, s)
+	}
+	listeners := h.listeners
+	h.mu.Unlock()
+
+	for i, u := range moved {
+		for _, s := range subs {
+			s.offer(u)
+		}
+		if !watched[i] {
+			continue
+		}
+		for _, l := range listeners {
+			l(u)
+		}
+	}
+}
+
+// Subscription is one client's view of the hub. updates are not
+// queued one by one: only the newest price of every symbol waits to
+// be taken, so a slow client skips prices instead of holding an ever
+// growing backlog.
+type Subscription struct {
+	hub   *Hub
+	ready chan struct{}
+
+	mu        sync.Mutex
+	symbols   map[string]map[string]bool
+	count     int
+	pending   map[string]Update
+	coalesced int
+}
+
+func (h *Hub) Subscribe() *Subscription {
+	s := &Subscription{
+		hub:     h,
+		ready:   make(chan struct{}, 1),
+		symbols: map[string]map[string]bool{KindCoin: {}, KindStock: {}},
+		pending: map[string]Update{},
+	}
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	return s
+}
+
+// Add subscribes to symbols of kind and returns the last known price
+// of each, when there is one.
+func (s *Subscription) Add(kind string, symbols []string) ([]Update, error) {
+	if kind != KindCoin && kind != KindStock {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKind, kind)
+	}
+	s.mu.Lock()
+	added := make([]string, 0, len(symbols))
+	for _, sym := range symbols {
+		if !s.symbols[kind][sym] {
+			added = append(added, sym)
+		}
+	}
+	if s.count+len(added) > s.hub.config.MaxSymbols {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w: at most %d per connection", ErrTooManySymbols, s.hub.config.MaxSymbols)
+	}
+	for _, sym := range added {
+		s.symbols[kind][sym] = true
+	}
+	s.count += len(added)
+	s.mu.Unlock()
+
+	// kind is checked above, so the hub takes it
+	s.hub.Watch(kind, added...)
+	snapshot := make([]Update, 0, len(symbols))
+	for _, sym := range symbols {
+		if u, ok := s.hub.Last(kind, sym); ok {
+			snapshot = append(snapshot, u)
+		}
+	}
+	return snapshot, nil
+}
+
+func (s *Subscription) Remove(kind string, symbols []string) {
+	if kind != KindCoin && kind != KindStock {
+		return
+	}
+	s.mu.Lock()
+	removed := make([]string, 0, len(symbols))
+	for _, sym := range symbols {
+		if s.symbols[kind][sym] {
+			delete(s.symbols[kind], sym)
+			delete(s.pending, key(kind, sym))
+			removed = append(removed, sym)
+		}
+	}
+	s.count -= len(removed)
+	s.mu.Unlock()
+	s.hub.Unwatch(kind, removed...)
+}
+
+// Ready is signalled when there are updates to take.
+func (s *Subscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Take hands over the waiting updates.
+func (s *Subscription) Take() []Update {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	updates := make([]Update, 0, len(s.pending))
+	for _, u := range s.pending {
+		updates = append(updates, u)
+	}
+	s.pending = make(map[string]Update, len(updates))
+	return updates
+}
+
+// Coalesced counts the updates replaced by a newer one before they
+// were taken.
+func (s *Subscription) Coalesced() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.coalesced
+}
+
+func (s *Subscription) offer(u Update) {
+	s.mu.Lock()
+	if !s.symbols[u.Kind][u.Symbol] {
+		s.mu.Unlock()
+		return
+	}
+	if _, ok := s.pending[u.key()]; ok {
+		s.coalesced++
+	}
+	s.pending[u.key()] = u
+	s.mu.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Close drops the subscription and everything it watched.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	delete(s.hub.subs, s)
+	s.hub.mu.Unlock()
+
+	for _, kind := range []string{KindCoin, KindStock} {
+		s.mu.Lock()
+		symbols := make([]string, 0, len(s.symbols[kind]))
+		for sym := range s.symbols[kind] {
+			symbols = append(symbols, sym)
+		}
+		s.mu.Unlock()
+		s.Remove(kind, symbols)
+	}
+}
@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
+	"go.uber.org/zap"
+)
+
+// liveCoins answers only GetLiveCryptoData, counting the calls.
+type liveCoins struct {
+	finance.CryptoData
+	calls int
+}
+
+func (c *liveCoins) GetLiveCryptoData(ctx context.Context, target string) (*finance.LiveData, error) {
+	c.calls++
+	return &finance.LiveData{Target: "USD", Rates: map[string]float64{"BTC": 50000 + float64(c.calls), "ETH": 2500 + float64(c.calls)}}, nil
+}
+
+func TestHubPollsCoinsOnlyWhenWatched(t *testing.T) {
+	coins := &liveCoins{}
+	h := NewHub(zap.NewNop(), coins, nil, Config{MaxSymbols: 10})
+	heard := make([]string, 0)
+	h.OnUpdate(func(u Update) { heard = append(heard, u.Symbol) })
+
+	h.pollCoins(context.Background())
+	if coins.calls != 0 {
+		t.Fatalf("a listener alone polled coinlayer %d times", coins.calls)
+	}
+
+	h.Watch(KindCoin, "BTC")
+	h.pollCoins(context.Background())
+	if coins.calls != 1 {
+		t.Fatalf("watched coin polled %d times, want 1", coins.calls)
+	}
+	if len(heard) != 1 || heard[0] != "BTC" {
+		t.Errorf("listener heard %v, want only the watched BTC", heard)
+	}
+	if _, ok := h.Last(KindCoin, "ETH"); !ok {
+		t.Error("unwatched coins should still be kept as the last price")
+	}
+
+	h.Unwatch(KindCoin, "BTC")
+	h.pollCoins(context.Background())
+	if coins.calls != 1 {
+		t.Errorf("coins polled %d times after the last unwatch, want 1", coins.calls)
+	}
+}
+
+func TestSubscriptionWatchesWhatItAdds(t *testing.T) {
+	coins := &liveCoins{}
+	h := NewHub(zap.NewNop(), coins, nil, Config{MaxSymbols: 1})
+	s := h.Subscribe()
+	if _, err := s.Add(KindCoin, []string{"BTC"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Add(KindCoin, []string{"ETH"}); err == nil {
+		t.Error("went over MaxSymbols")
+	}
+	h.pollCoins(context.Background())
+	select {
+	case <-s.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("subscription was not signalled")
+	}
+	if updates := s.Take(); len(updates) != 1 || updates[0].Symbol != "BTC" {
+		t.Errorf("took %v, want the BTC update", updates)
+	}
+
+	s.Close()
+	h.pollCoins(context.Background())
+	if coins.calls != 1 {
+		t.Errorf("coins polled %d times after the subscription closed, want 1", coins.calls)
+	}
+}
+
+func TestWatchRefusesUnknownKinds(t *testing.T) {
+	h := NewHub(zap.NewNop(), nil, nil, Config{MaxSymbols: 10})
+	for _, kind := range []string{"", "bond", "COIN"} {
+		if err := h.Watch(kind, "BTC"); !errors.Is(err, ErrUnknownKind) {
+			t.Errorf("watch %q: got %v, want ErrUnknownKind", kind, err)
+		}
+		if err := h.Unwatch(kind, "BTC"); !errors.Is(err, ErrUnknownKind) {
+			t.Errorf("unwatch %q: got %v, want ErrUnknownKind", kind, err)
+		}
+	}
+	if _, err := h.Subscribe().Add("bond", []string{"X"}); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("subscribe: got %v, want ErrUnknownKind", err)
+	}
+}
+
+// latestBars answers only GetIntradayLatest.
+type latestBars struct {
+	finance.StockTicker
+	bars []finance.IntradayBar
+}
+
+func (l *latestBars) GetIntradayLatest(ctx context.Context, symbols []string) (*finance.LatestIntraday, error) {
+	return &finance.LatestIntraday{Data: l.bars}, nil
+}
+
+func TestStockPricesMatchIntradayBarPrice(t *testing.T) {
+	bars := []finance.IntradayBar{
+		{Symbol: "AAPL", Last: finance.NewNumber(101), Close: finance.NewNumber(100)},
+		{Symbol: "MSFT", Last: finance.NewNumber(201)},
+		{Symbol: "TSLA"},
+	}
+	h := NewHub(zap.NewNop(), nil, &latestBars{bars: bars}, Config{MaxSymbols: 10})
+	h.Watch(KindStock, "AAPL", "MSFT", "TSLA")
+	h.pollStocks(context.Background())
+	for _, bar := range bars {
+		u, ok := h.Last(KindStock, bar.Symbol)
+		if want := bar.Price(); ok != want.Valid || u.Price != want.Float64 {
+			t.Errorf("%s streamed at %v (%v), want %v", bar.Symbol, u.Price, ok, want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
+	"go.uber.org/zap"
+)
+
+// Command is what a websocket client sends to change its
+// subscriptions: {"action":"subscribe","coins":["BTC"],"stocks":["AAPL"]}.
+type Command struct {
+	Action string   `json:"action"`
+	Coins  []string `json:"coins"`
+	Stocks []string `json:"stocks"`
+}
+
+// Message is everything sent to a client: an update, the answer to a
+// command or an error.
+type Message struct {
+	Type   string   `json:"type"`
+	Data   *Update  `json:"data,omitempty"`
+	Coins  []string `json:"coins,omitempty"`
+	Stocks []string `json:"stocks,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// subscribe applies the coins and stocks query parameters, or a
+// command, to sub and returns the snapshot of what was added.
+func subscribe(sub *Subscription, coins []string, stocks []string) ([]Update, error) {
+	snapshot, err := sub.Add(KindCoin, coins)
+	if err != nil {
+		return nil, err
+	}
+	more, err := sub.Add(KindStock, stocks)
+	if err != nil {
+		sub.Remove(KindCoin, coins)
+		return nil, err
+	}
+	return append(snapshot, more...), nil
+}
+
+// ServeWS streams updates over a websocket. the coins and stocks query
+// parameters subscribe right away; commands change that later on.
+func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrade(w, r, h.config.WriteTimeout)
+	if err != nil {
+		h.logger.Debug("websocket upgrade failed", zap.Any("error", err))
+		return
+	}
+	sub := h.Subscribe()
+	defer sub.Close()
+
+	send := func(m Message) error {
+		b, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		return conn.write(opText, b)
+	}
+	sendAll := func(updates []Update) error {
+		for i := range updates {
+			if err := send(Message{Type: "update", Data: &updates[i]}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	apply := func(cmd Command) error {
+		coins, stocks := finance.ParseSymbols(strings.Join(cmd.Coins, ",")), finance.ParseSymbols(strings.Join(cmd.Stocks, ","))
+		switch cmd.Action {
+		case "subscribe":
+			snapshot, err := subscribe(sub, coins, stocks)
+			if err != nil {
+				return send(Message{Type: "error", Error: err.Error()})
+			}
+			if err := send(Message{Type: "subscribed", Coins: coins, Stocks: stocks}); err != nil {
+				return err
+			}
+			return sendAll(snapshot)
+		case "unsubscribe":
+			sub.Remove(KindCoin, coins)
+			sub.Remove(KindStock, stocks)
+			return send(Message{Type: "unsubscribed", Coins: coins, Stocks: stocks})
+		default:
+			return send(Message{Type: "error", Error: fmt.Sprintf("unknown action %q", cmd.Action)})
+		}
+	}
+
+	initial := Command{Action: "subscribe", Coins: []string{r.FormValue("coins")}, Stocks: []string{r.FormValue("stocks")}}
+	if initial.Coins[0] != "" || initial.Stocks[0] != "" {
+		if err := apply(initial); err != nil {
+			conn.close(closeNormal, "")
+			return
+		}
+	}
+
+	// the reader owns the incoming side and the loop below the outgoing
+	// one; whichever fails first takes the other down
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			b, err := conn.readMessage(2 * h.config.PingInterval)
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					h.logger.Debug("websocket read failed", zap.Any("error", err))
+				}
+				return
+			}
+			var cmd Command
+			if err := json.Unmarshal(b, &cmd); err != nil {
+				if send(Message{Type: "error", Error: "commands are json objects"}) != nil {
+					return
+				}
+				continue
+			}
+			if err := apply(cmd); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(h.config.PingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-done:
+			conn.close(closeNormal, "")
+			return
+		case <-r.Context().Done():
+			conn.close(closeNormal, "")
+			<-done
+			return
+		case <-ping.C:
+			if err := conn.write(opPing, nil); err != nil {
+				conn.close(closeNormal, "")
+				<-done
+				return
+			}
+		case <-sub.Ready():
+			if err := sendAll(sub.Take()); err != nil {
+				// the client could not keep up within the write timeout
+				h.logger.Debug("dropping slow websocket client", zap.Any("error", err))
+				conn.close(closeNormal, "")
+				<-done
+				return
+			}
+		}
+	}
+}
+
+// ServeSSE streams updates as server-sent events for the coins and
+// stocks query parameters, which are fixed for the connection.
+func (h *Hub) ServeSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	coins, stocks := finance.ParseSymbols(r.FormValue("coins")), finance.ParseSymbols(r.FormValue("stocks"))
+	if len(coins) == 0 && len(stocks) == 0 {
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "coins or stocks must be given"})
+		return
+	}
+	sub := h.Subscribe()
+	defer sub.Close()
+	snapshot, err := subscribe(sub, coins, stocks)
+	if err != nil {
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// keeps proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sendAll := func(updates []Update) error {
+		for _, u := range updates {
+			b, err := json.Marshal(u)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "event: update\ndata: %s\n\n", b); err != nil {
+				return err
+			}
+		}
+		flusher.Flush()
+		return nil
+	}
+	if err := sendAll(snapshot); err != nil {
+		return
+	}
+	ping := time.NewTicker(h.config.PingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-sub.Ready():
+			if err := sendAll(sub.Take()); err != nil {
+				h.logger.Debug("sse write failed", zap.Any("error", err))
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package stream
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// a small server side websocket (RFC 6455), enough for json text
+// messages: no extensions, no subprotocols.
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+
+	closeNormal      = 1000
+	closeProtocol    = 1002
+	closeUnsupported = 1003
+	closeTooBig      = 1009
+
+	// largest message a client may send, subscriptions are small
+	maxMessageSize = 16 << 10
+
+	websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var (
+	ErrNotWebsocket = errors.New("not a websocket handshake")
+	errProtocol     = errors.New("websocket protocol error")
+	errTooBig       = errors.New("websocket message too big")
+)
+
+type wsConn struct {
+	conn         net.Conn
+	br           *bufio.Reader
+	writeTimeout time.Duration
+
+	wmu    sync.Mutex
+	closed bool
+}
+
+// upgrade answers the websocket handshake and takes the connection
+// over from the http server. on a bad handshake it writes a 400.
+func upgrade(w http.ResponseWriter, r *http.Request, writeTimeout time.Duration) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet ||
+		!headerHas(r.Header, "Connection", "upgrade") ||
+		!headerHas(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, ErrNotWebsocket.Error(), http.StatusBadRequest)
+		return nil, ErrNotWebsocket
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, ErrNotWebsocket
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err = fmt.Fprintf(conn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, br: rw.Reader, writeTimeout: writeTimeout}, nil
+}
+
+// headerHas tells whether one of the comma separated tokens of header
+// is token, ignoring case.
+func headerHas(h http.Header, name string, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readMessage returns the next text message. pings are answered and
+// pongs skipped on the way; a close from the client is echoed and ends
+// the connection with io.EOF. readTimeout applies to every frame.
+func (c *wsConn) readMessage(readTimeout time.Duration) ([]byte, error) {
+	var (
+		msg     []byte
+		started bool
+	)
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			switch {
+			case errors.Is(err, errTooBig):
+				c.close(closeTooBig, "message too big")
+			case errors.Is(err, errProtocol):
+				c.close(closeProtocol, "protocol error")
+			}
+			return nil, err
+		}
+		switch op {
+		case opPing:
+			if err := c.write(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.close(closeNormal, "")
+			return nil, io.EOF
+		case opBinary:
+			c.close(closeUnsupported, "text messages only")
+			return nil, errProtocol
+		case opText:
+			if started {
+				c.close(closeProtocol, "protocol error")
+				return nil, errProtocol
+			}
+			started = true
+		case opContinuation:
+			if !started {
+				c.close(closeProtocol, "protocol error")
+				return nil, errProtocol
+			}
+		default:
+			c.close(closeProtocol, "protocol error")
+			return nil, errProtocol
+		}
+		if len(msg)+len(payload) > maxMessageSize {
+			c.close(closeTooBig, "message too big")
+			return nil, errTooBig
+		}
+		msg = append(msg, payload...)
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := head[0]&0x80 != 0
+	op := head[0] & 0x0f
+	masked := head[1]&0x80 != 0
+	// no extension was agreed on, so the reserved bits stay clear, and
+	// clients must mask what they send
+	if head[0]&0x70 != 0 || !masked {
+		return false, 0, nil, errProtocol
+	}
+	size := uint64(head[1] & 0x7f)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= opClose && (size > 125 || !fin) {
+		return false, 0, nil, errProtocol
+	}
+	if size > maxMessageSize {
+		return false, 0, nil, errTooBig
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// write sends one unfragmented frame. a client that does not take it
+// within the write timeout is too slow and the write fails.
+func (c *wsConn) write(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|op)
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+	c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// close sends a close frame, best effort, and shuts the connection.
+func (c *wsConn) close(code uint16, reason string) {
+	payload := binary.BigEndian.AppendUint16(nil, code)
+	c.write(opClose, append(payload, reason...))
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if !c.closed {
+		c.closed = true
+		c.conn.Close()
+	}
+}
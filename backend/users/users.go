@@ -1,17 +1,21 @@
 package users
 
 import (
-	"encoding/hex"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
 	"github.com/jim-nnamdi/coldfinance/backend/connection"
+	"github.com/jim-nnamdi/coldfinance/backend/events"
+	"github.com/joho/godotenv"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -216,6 +220,9 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		log.Print(err.Error())
 		return
 	}
+	events.Emit(r.Context(), events.TypeUserRegistered, r.FormValue("username"), events.UserRegistered{
+		Username: r.FormValue("username"),
+	})
 	w.Header().Add("Content-Type", "application/json")
 	json.NewEncoder(w).Encode("account created successfully!")
 }
@@ -229,10 +236,6 @@ func Login(w http.ResponseWriter, r *http.Request) {
 
 	// we need to auth the user using jwt
 	expires := time.Now().Add(time.Hour)
-	type ToEncode struct {
-		Email string `json:"email"`
-		jwt.StandardClaims
-	}
 	dataEncode := ToEncode{
 		Email: r.FormValue("email"),
 		StandardClaims: jwt.StandardClaims{
@@ -242,9 +245,9 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	jwt_secret, err := hex.DecodeString("13d6b4dff8f84a10851021ec8608f814570d562c92fe6b5ec4c9f595bcb3234b")
+	jwt_secret, err := jwtSecret()
 	if err != nil {
-		connection.Coldfinancelog().Debug("could not decode string")
+		log.Printf("cannot sign token: %s", err)
 		return
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, dataEncode)
@@ -254,7 +257,7 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	http.SetCookie(w, &http.Cookie{
-		Name:    "coldfinance-user",
+		Name:    SessionCookie,
 		Value:   token_string,
 		Expires: time.Now().Add(60 * time.Minute),
 	})
@@ -262,3 +265,111 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(token_string)
 }
+
+// SessionCookie holds the token Login hands out.
+const SessionCookie = "coldfinance-user"
+
+var ErrNotLoggedIn = errors.New("not logged in")
+
+// ToEncode are the claims of the token Login hands out.
+type ToEncode struct {
+	Email string `json:"email"`
+	jwt.StandardClaims
+}
+
+// ErrNoJWTSecret is returned while no signing key has been loaded.
+var ErrNoJWTSecret = errors.New("JWT_SECRET must be set to at least 32 characters")
+
+// minSecretLen is the shortest signing key accepted, the size of the
+// HS256 hash.
+const minSecretLen = 32
+
+var signingKey []byte
+
+// LoadJWTSecret reads the key tokens are signed and checked with from
+// JWT_SECRET. the server must not start without it, since the token is
+// all that stands between a request and the user's data.
+func LoadJWTSecret() error {
+	_ = godotenv.Load()
+	secret := os.Getenv("JWT_SECRET")
+	if len(secret) < minSecretLen {
+		return ErrNoJWTSecret
+	}
+	signingKey = []byte(secret)
+	return nil
+}
+
+func jwtSecret() ([]byte, error) {
+	if signingKey == nil {
+		return nil, ErrNoJWTSecret
+	}
+	return signingKey, nil
+}
+
+// CurrentUser is the user whose token came with r, from the session
+// cookie or an "Authorization: Bearer" header. a missing, expired or
+// forged token is ErrNotLoggedIn.
+func CurrentUser(r *http.Request) (*User, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		cookie, err := r.Cookie(SessionCookie)
+		if err != nil {
+			return nil, ErrNotLoggedIn
+		}
+		token = cookie.Value
+	}
+	secret, err := jwtSecret()
+	if err != nil {
+		return nil, err
+	}
+	claims := ToEncode{}
+	parsed, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return secret, nil
+	})
+	if err != nil || !parsed.Valid || claims.Email == "" {
+		return nil, ErrNotLoggedIn
+	}
+	user, err := GetUserByEmail(claims.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotLoggedIn
+	}
+	return user, err
+}
+
+func GetUserByEmail(email string) (*User, error) {
+	user := User{}
+	req := dbc.QueryRow("select * from users where email = ?", email)
+	if err := req.Scan(
+		&user.Id,
+		&user.Username,
+		&user.Password,
+		&user.EmailAdd,
+		&user.Location,
+		&user.Verified,
+		&user.WalletBalance,
+	); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// RequireUser returns the current user, or answers 401 (500 when the
+// user could not be loaded) and returns nil.
+func RequireUser(w http.ResponseWriter, r *http.Request) *User {
+	user, err := CurrentUser(r)
+	if err == nil {
+		return user
+	}
+	status := http.StatusUnauthorized
+	if !errors.Is(err, ErrNotLoggedIn) {
+		log.Printf("cannot load current user: %s", err)
+		status = http.StatusInternalServerError
+	}
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	return nil
+}
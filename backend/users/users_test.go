@@ -0,0 +1,64 @@
+package users
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/golang-jwt/jwt"
+)
+
+func TestLoadJWTSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr bool
+	}{
+		{name: "unset", wantErr: true},
+		{name: "too short", secret: "0123456789", wantErr: true},
+		{name: "long enough", secret: strings.Repeat("k", minSecretLen)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signingKey = nil
+			t.Setenv("JWT_SECRET", tt.secret)
+			err := LoadJWTSecret()
+			if tt.wantErr {
+				if !errors.Is(err, ErrNoJWTSecret) {
+					t.Fatalf("got %v, want ErrNoJWTSecret", err)
+				}
+				if _, err := jwtSecret(); !errors.Is(err, ErrNoJWTSecret) {
+					t.Errorf("secret served after a failed load: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key, _ := jwtSecret(); string(key) != tt.secret {
+				t.Errorf("key %q, want %q", key, tt.secret)
+			}
+		})
+	}
+}
+
+func TestCurrentUserRejectsForeignKeys(t *testing.T) {
+	t.Setenv("JWT_SECRET", strings.Repeat("k", minSecretLen))
+	if err := LoadJWTSecret(); err != nil {
+		t.Fatal(err)
+	}
+	// signed with some other key
+	claims := ToEncode{Email: "ada@example.com", StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()}}
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(strings.Repeat("x", minSecretLen)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/alerts", nil)
+	r.Header.Set("Authorization", "Bearer "+forged)
+	if _, err := CurrentUser(r); !errors.Is(err, ErrNotLoggedIn) {
+		t.Errorf("got %v, want ErrNotLoggedIn", err)
+	}
+}
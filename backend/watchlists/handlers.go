@@ -0,0 +1,186 @@
+package watchlists
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/jim-nnamdi/coldfinance/backend/users"
+	"go.uber.org/zap"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidWatchlist), errors.Is(err, ErrInvalidItem):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrDuplicateName):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// formId reads the id form value.
+func formId(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		return 0, errors.New("id must be a positive whole number")
+	}
+	return id, nil
+}
+
+// formItems reads the stocks and coins form values, comma separated
+// symbols each.
+func formItems(r *http.Request) ([]Item, error) {
+	return ParseItems(r.FormValue("stocks"), r.FormValue("coins"))
+}
+
+// post checks the request is a POST and reads the id of the list it is
+// about, writing the error otherwise.
+func post(w http.ResponseWriter, r *http.Request) (int, bool) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use POST"))
+		return 0, false
+	}
+	id, err := formId(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return 0, false
+	}
+	return id, true
+}
+
+// Watchlists lists the watchlists of the current user on GET and
+// creates one on POST from the name form value, filled with the stocks
+// and coins given.
+func (s *Service) Watchlists(w http.ResponseWriter, r *http.Request) {
+	user := users.RequireUser(w, r)
+	if user == nil {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		lists, err := s.Lists(r.Context(), user.Id)
+		if err != nil {
+			s.logger.Debug("could not list watchlists", zap.Any("error", err))
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, lists)
+	case http.MethodPost:
+		items, err := formItems(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		list, err := s.Create(r.Context(), user.Id, r.FormValue("name"), items)
+		if err != nil {
+			writeError(w, statusFor(err), err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, list)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("use GET or POST"))
+	}
+}
+
+// RenameWatchlist gives the list id the name form value.
+func (s *Service) RenameWatchlist(w http.ResponseWriter, r *http.Request) {
+	user := users.RequireUser(w, r)
+	if user == nil {
+		return
+	}
+	id, ok := post(w, r)
+	if !ok {
+		return
+	}
+	list, err := s.Rename(r.Context(), user.Id, id, r.FormValue("name"))
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// DeleteWatchlist removes the list id with its items.
+func (s *Service) DeleteWatchlist(w http.ResponseWriter, r *http.Request) {
+	user := users.RequireUser(w, r)
+	if user == nil {
+		return
+	}
+	id, ok := post(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Delete(r.Context(), user.Id, id); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"deleted": id})
+}
+
+// AddWatchlistItems adds the stocks and coins given to the list id.
+func (s *Service) AddWatchlistItems(w http.ResponseWriter, r *http.Request) {
+	s.changeItems(w, r, s.AddItems)
+}
+
+// RemoveWatchlistItems takes the stocks and coins given off the list id.
+func (s *Service) RemoveWatchlistItems(w http.ResponseWriter, r *http.Request) {
+	s.changeItems(w, r, s.RemoveItems)
+}
+
+func (s *Service) changeItems(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, userId int, id int, items []Item) (*Watchlist, error)) {
+	user := users.RequireUser(w, r)
+	if user == nil {
+		return
+	}
+	id, ok := post(w, r)
+	if !ok {
+		return
+	}
+	items, err := formItems(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	list, err := change(r.Context(), user.Id, id, items)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// WatchlistQuotes returns the latest quote of every item on the list
+// id, coins priced in the target form value.
+func (s *Service) WatchlistQuotes(w http.ResponseWriter, r *http.Request) {
+	user := users.RequireUser(w, r)
+	if user == nil {
+		return
+	}
+	id, err := formId(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	quotes, err := s.Quotes(r.Context(), user.Id, id, r.FormValue("target"))
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, quotes)
+}
@@ -0,0 +1,275 @@
+package watchlists
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNotFound      = errors.New("watchlist not found")
+	ErrDuplicateName = errors.New("a watchlist with this name already exists")
+)
+
+// mysql error number of a duplicate unique key
+const mysqlDuplicateEntry = 1062
+
+// DATETIME columns come back as text, the dsn does not parse times
+const sqlTimeLayout = "2006-01-02 15:04:05"
+
+// Watchlist is a named list of symbols a user follows. items are kept
+// in the order they were added.
+type Watchlist struct {
+	Id        int       `json:"id"`
+	UserId    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Items     []Item    `json:"items"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Item is a stock ticker or a coin.
+type Item struct {
+	Kind   string `json:"kind"`
+	Symbol string `json:"symbol"`
+}
+
+type Store interface {
+	// Lists are the watchlists of userId, with their items
+	Lists(ctx context.Context, userId int) ([]Watchlist, error)
+	// List is one watchlist of userId, ErrNotFound when the user has no
+	// such list
+	List(ctx context.Context, userId int, id int) (*Watchlist, error)
+	// Create adds list unless its user already has maxLists lists, then
+	// failing with ErrInvalidWatchlist
+	Create(ctx context.Context, list *Watchlist, maxLists int) error
+	Rename(ctx context.Context, userId int, id int, name string) error
+	Delete(ctx context.Context, userId int, id int) error
+	// AddItems appends items to a list unless it would then hold more
+	// than maxItems, failing with ErrInvalidWatchlist
+	AddItems(ctx context.Context, id int, items []Item, maxItems int) error
+	RemoveItems(ctx context.Context, id int, items []Item) error
+}
+
+var _ Store = &sqlStore{}
+
+type sqlStore struct {
+	logger *zap.Logger
+	db     *sql.DB
+}
+
+func NewStore(logger *zap.Logger, db *sql.DB) *sqlStore {
+	return &sqlStore{
+		logger: logger,
+		db:     db,
+	}
+}
+
+func (s *sqlStore) Lists(ctx context.Context, userId int) ([]Watchlist, error) {
+	return s.query(ctx, "where w.user_id = ?", userId)
+}
+
+func (s *sqlStore) List(ctx context.Context, userId int, id int) (*Watchlist, error) {
+	lists, err := s.query(ctx, "where w.user_id = ? and w.id = ?", userId, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(lists) == 0 {
+		return nil, ErrNotFound
+	}
+	return &lists[0], nil
+}
+
+// query loads the watchlists matching where together with their items
+// in one go.
+func (s *sqlStore) query(ctx context.Context, where string, args ...any) ([]Watchlist, error) {
+	rows, err := s.db.QueryContext(ctx, "select w.id, w.user_id, w.name, w.created_at, i.kind, i.symbol from watchlists w left join watchlist_items i on i.watchlist_id = w.id "+where+" order by w.id, i.position", args...)
+	if err != nil {
+		s.logger.Debug("could not fetch watchlists", zap.Any("error", err))
+		return nil, err
+	}
+	defer rows.Close()
+	lists := make([]Watchlist, 0)
+	for rows.Next() {
+		var (
+			w            Watchlist
+			created      string
+			kind, symbol sql.NullString
+		)
+		if err := rows.Scan(&w.Id, &w.UserId, &w.Name, &created, &kind, &symbol); err != nil {
+			s.logger.Debug("could not scan watchlist", zap.Any("error", err))
+			return nil, err
+		}
+		if len(lists) == 0 || lists[len(lists)-1].Id != w.Id {
+			w.CreatedAt, _ = time.Parse(sqlTimeLayout, created)
+			w.Items = make([]Item, 0)
+			lists = append(lists, w)
+		}
+		if kind.Valid {
+			last := &lists[len(lists)-1]
+			last.Items = append(last.Items, Item{Kind: kind.String, Symbol: symbol.String})
+		}
+	}
+	return lists, rows.Err()
+}
+
+func (s *sqlStore) Create(ctx context.Context, list *Watchlist, maxLists int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// the locking read holds back other creates for the user until
+	// this one is done, so two of them cannot both pass the count
+	var count int
+	if err := tx.QueryRowContext(ctx, "select count(*) from watchlists where user_id = ? for update", list.UserId).Scan(&count); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count >= maxLists {
+		tx.Rollback()
+		return fmt.Errorf("%w: at most %d watchlists per user", ErrInvalidWatchlist, maxLists)
+	}
+	list.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	res, err := tx.ExecContext(ctx, "insert into watchlists(user_id, name, created_at) values(?,?,?)", list.UserId, list.Name, list.CreatedAt.Format(sqlTimeLayout))
+	if err != nil {
+		tx.Rollback()
+		return duplicate(err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	list.Id = int(id)
+	if list.Items == nil {
+		list.Items = make([]Item, 0)
+	}
+	if err := s.addItems(ctx, tx, list.Id, list.Items); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) Rename(ctx context.Context, userId int, id int, name string) error {
+	// an unchanged name affects no rows, so a missing list is left to
+	// the caller to rule out
+	_, err := s.db.ExecContext(ctx, "update watchlists set name = ? where id = ? and user_id = ?", name, id, userId)
+	return duplicate(err)
+}
+
+func (s *sqlStore) Delete(ctx context.Context, userId int, id int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, "delete from watchlists where id = ? and user_id = ?", id, userId)
+	if err != nil {
+		tx.Rollback()
+		s.logger.Debug("could not delete watchlist", zap.Any("error", err))
+		return err
+	}
+	if err := found(res); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "delete from watchlist_items where watchlist_id = ?", id); err != nil {
+		tx.Rollback()
+		s.logger.Debug("could not delete watchlist items", zap.Any("error", err))
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddItems appends items to the list, skipping those already on it.
+func (s *sqlStore) AddItems(ctx context.Context, id int, items []Item, maxItems int) error {
+	if len(items) == 0 {
+		return nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// the locking read of the list holds back other adds to it until
+	// this one is done, so two of them cannot both pass the count or
+	// hand out the same position
+	var locked int
+	if err := tx.QueryRowContext(ctx, "select id from watchlists where id = ? for update", id).Scan(&locked); err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+	if err := s.addItems(ctx, tx, id, items); err != nil {
+		tx.Rollback()
+		return err
+	}
+	var count int
+	if err := tx.QueryRowContext(ctx, "select count(*) from watchlist_items where watchlist_id = ?", id).Scan(&count); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count > maxItems {
+		tx.Rollback()
+		return fmt.Errorf("%w: at most %d items per watchlist", ErrInvalidWatchlist, maxItems)
+	}
+	return tx.Commit()
+}
+
+// addItems appends items to the list within tx, which the caller
+// commits or rolls back. the list must be locked by tx, or be new.
+func (s *sqlStore) addItems(ctx context.Context, tx *sql.Tx, id int, items []Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	var position int
+	if err := tx.QueryRowContext(ctx, "select coalesce(max(position), 0) from watchlist_items where watchlist_id = ?", id).Scan(&position); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, "insert ignore into watchlist_items(watchlist_id, kind, symbol, position) values(?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, it := range items {
+		position++
+		if _, err := stmt.ExecContext(ctx, id, it.Kind, it.Symbol, position); err != nil {
+			s.logger.Debug("could not add watchlist item", zap.Any("error", err))
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) RemoveItems(ctx context.Context, id int, items []Item) error {
+	for _, it := range items {
+		if _, err := s.db.ExecContext(ctx, "delete from watchlist_items where watchlist_id = ? and kind = ? and symbol = ?", id, it.Kind, it.Symbol); err != nil {
+			s.logger.Debug("could not remove watchlist item", zap.Any("error", err))
+			return err
+		}
+	}
+	return nil
+}
+
+func duplicate(err error) error {
+	if err == nil {
+		return nil
+	}
+	var merr *mysql.MySQLError
+	if errors.As(err, &merr) && merr.Number == mysqlDuplicateEntry {
+		return ErrDuplicateName
+	}
+	return err
+}
+
+func found(res sql.Result) error {
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
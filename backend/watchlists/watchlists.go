@@ -0,0 +1,295 @@
+package watchlists
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
+	"github.com/jim-nnamdi/coldfinance/backend/stream"
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidWatchlist = errors.New("invalid watchlist")
+	ErrInvalidItem      = errors.New("invalid stock or coin")
+)
+
+var symbolPattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9.\-]{0,31}$`)
+
+type Config struct {
+	MaxLists int
+	MaxItems int
+}
+
+// ConfigFromEnv reads WATCHLISTS_MAX_LISTS (20 per user by default) and
+// WATCHLISTS_MAX_ITEMS (100 per list).
+func ConfigFromEnv() Config {
+	_ = godotenv.Load()
+	config := Config{MaxLists: 20, MaxItems: 100}
+	if v, err := strconv.Atoi(os.Getenv("WATCHLISTS_MAX_LISTS")); err == nil && v > 0 {
+		config.MaxLists = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("WATCHLISTS_MAX_ITEMS")); err == nil && v > 0 {
+		config.MaxItems = v
+	}
+	return config
+}
+
+// Quote is the latest price of one item. an item that could not be
+// priced carries the reason in Error instead.
+type Quote struct {
+	Item
+	Price  float64 `json:"price,omitempty"`
+	Target string  `json:"target,omitempty"`
+	Date   string  `json:"date,omitempty"`
+	Source string  `json:"source,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+type Quotes struct {
+	Watchlist
+	Quotes []Quote `json:"quotes"`
+}
+
+// Service keeps watchlists and prices them with the stock and coin
+// services.
+type Service struct {
+	logger *zap.Logger
+	store  Store
+	ticker finance.StockTicker
+	crypto finance.CryptoData
+	config Config
+}
+
+func NewService(logger *zap.Logger, store Store, ticker finance.StockTicker, crypto finance.CryptoData, config Config) *Service {
+	return &Service{
+		logger: logger,
+		store:  store,
+		ticker: ticker,
+		crypto: crypto,
+		config: config,
+	}
+}
+
+// ParseItems reads the stock and coin symbols of a request into items,
+// stocks first.
+func ParseItems(stocks string, coins string) ([]Item, error) {
+	items := make([]Item, 0)
+	for _, kind := range []struct {
+		name    string
+		symbols string
+	}{{stream.KindStock, stocks}, {stream.KindCoin, coins}} {
+		for _, s := range finance.ParseSymbols(kind.symbols) {
+			it, err := NewItem(kind.name, s)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, it)
+		}
+	}
+	return items, nil
+}
+
+// NewItem checks kind is a stream kind and symbol looks like a ticker
+// or coin, upper casing it.
+func NewItem(kind string, symbol string) (Item, error) {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if kind != stream.KindStock && kind != stream.KindCoin {
+		return Item{}, fmt.Errorf("%w: kind must be %s or %s", ErrInvalidItem, stream.KindStock, stream.KindCoin)
+	}
+	if !symbolPattern.MatchString(symbol) {
+		return Item{}, fmt.Errorf("%w: %q is not a symbol", ErrInvalidItem, symbol)
+	}
+	return Item{Kind: kind, Symbol: symbol}, nil
+}
+
+func cleanName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return "", fmt.Errorf("%w: name must be 1 to 64 characters", ErrInvalidWatchlist)
+	}
+	return name, nil
+}
+
+func (s *Service) Lists(ctx context.Context, userId int) ([]Watchlist, error) {
+	return s.store.Lists(ctx, userId)
+}
+
+func (s *Service) Create(ctx context.Context, userId int, name string, items []Item) (*Watchlist, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > s.config.MaxItems {
+		return nil, fmt.Errorf("%w: at most %d items per watchlist", ErrInvalidWatchlist, s.config.MaxItems)
+	}
+	list := &Watchlist{UserId: userId, Name: name, Items: items}
+	if err := s.store.Create(ctx, list, s.config.MaxLists); err != nil {
+		return nil, err
+	}
+	return s.store.List(ctx, userId, list.Id)
+}
+
+func (s *Service) Rename(ctx context.Context, userId int, id int, name string) (*Watchlist, error) {
+	name, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.store.List(ctx, userId, id); err != nil {
+		return nil, err
+	}
+	if err := s.store.Rename(ctx, userId, id, name); err != nil {
+		return nil, err
+	}
+	return s.store.List(ctx, userId, id)
+}
+
+func (s *Service) Delete(ctx context.Context, userId int, id int) error {
+	return s.store.Delete(ctx, userId, id)
+}
+
+// AddItems adds items to a list of userId, keeping it within MaxItems.
+func (s *Service) AddItems(ctx context.Context, userId int, id int, items []Item) (*Watchlist, error) {
+	if _, err := s.store.List(ctx, userId, id); err != nil {
+		return nil, err
+	}
+	if err := s.store.AddItems(ctx, id, items, s.config.MaxItems); err != nil {
+		return nil, err
+	}
+	return s.store.List(ctx, userId, id)
+}
+
+func (s *Service) RemoveItems(ctx context.Context, userId int, id int, items []Item) (*Watchlist, error) {
+	if _, err := s.store.List(ctx, userId, id); err != nil {
+		return nil, err
+	}
+	if err := s.store.RemoveItems(ctx, id, items); err != nil {
+		return nil, err
+	}
+	return s.store.List(ctx, userId, id)
+}
+
+// Quotes prices every item of a list, coins in target or in the
+// provider's own currency when empty.
+func (s *Service) Quotes(ctx context.Context, userId int, id int, target string) (*Quotes, error) {
+	list, err := s.store.List(ctx, userId, id)
+	if err != nil {
+		return nil, err
+	}
+	return &Quotes{Watchlist: *list, Quotes: s.Price(ctx, list.Items, target)}, nil
+}
+
+// Price quotes items in their order: stocks at their latest intraday
+// bar, or their latest EOD close where there is none, and coins at the
+// live rate in target.
+func (s *Service) Price(ctx context.Context, items []Item, target string) []Quote {
+	stocks := make([]string, 0)
+	hasCoins := false
+	for _, it := range items {
+		if it.Kind == stream.KindStock {
+			stocks = append(stocks, it.Symbol)
+		} else {
+			hasCoins = true
+		}
+	}
+
+	quotes := map[Item]Quote{}
+	if len(stocks) > 0 {
+		s.stockQuotes(ctx, stocks, quotes)
+	}
+	if hasCoins {
+		live, err := s.crypto.GetLiveCryptoData(ctx, target)
+		if err != nil {
+			s.logger.Debug("could not price coins", zap.Any("error", err))
+		}
+		for _, it := range items {
+			if it.Kind != stream.KindCoin {
+				continue
+			}
+			q := Quote{Item: it}
+			switch rate, ok := liveRate(live, it.Symbol); {
+			case err != nil:
+				q.Error = err.Error()
+			case !ok:
+				q.Error = finance.ErrUnknownCoin.Error()
+			default:
+				q.Price, q.Target, q.Source = rate, live.Target, live.Source
+			}
+			quotes[it] = q
+		}
+	}
+
+	res := make([]Quote, 0, len(items))
+	for _, it := range items {
+		res = append(res, quotes[it])
+	}
+	return res
+}
+
+func liveRate(live *finance.LiveData, coin string) (float64, bool) {
+	if live == nil {
+		return 0, false
+	}
+	rate, ok := live.Rates[coin]
+	return rate, ok
+}
+
+// stockQuotes fills quotes in for symbols, falling back to EOD for the
+// symbols intraday data is missing for.
+func (s *Service) stockQuotes(ctx context.Context, symbols []string, quotes map[Item]Quote) {
+	missing := symbols
+	intraday, err := s.ticker.GetIntradayLatest(ctx, symbols)
+	if err != nil {
+		s.logger.Debug("no intraday quotes for watchlist", zap.Any("error", err))
+	} else {
+		for _, bar := range intraday.Data {
+			price := bar.Price()
+			if !price.Valid {
+				continue
+			}
+			source := bar.Source
+			if source == "" {
+				source = intraday.Source
+			}
+			it := Item{Kind: stream.KindStock, Symbol: bar.Symbol}
+			quotes[it] = Quote{Item: it, Price: price.Float64, Date: bar.Date, Source: source}
+		}
+		missing = make([]string, 0)
+		for _, sym := range symbols {
+			if _, ok := quotes[Item{Kind: stream.KindStock, Symbol: sym}]; !ok {
+				missing = append(missing, sym)
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	eod, err := s.ticker.GetEODLatest(ctx, missing)
+	if err != nil {
+		for _, sym := range missing {
+			it := Item{Kind: stream.KindStock, Symbol: sym}
+			quotes[it] = Quote{Item: it, Error: err.Error()}
+		}
+		return
+	}
+	for _, bar := range eod.Data {
+		source := bar.Source
+		if source == "" {
+			source = eod.Source
+		}
+		it := Item{Kind: stream.KindStock, Symbol: bar.Symbol}
+		quotes[it] = Quote{Item: it, Price: bar.Close, Date: bar.Date, Source: source}
+	}
+	for _, sym := range missing {
+		it := Item{Kind: stream.KindStock, Symbol: sym}
+		if _, ok := quotes[it]; !ok {
+			quotes[it] = Quote{Item: it, Error: finance.ErrSymbolNotFound.Error()}
+		}
+	}
+}
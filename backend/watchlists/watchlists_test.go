@@ -0,0 +1,214 @@
+package watchlists
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jim-nnamdi/coldfinance/backend/finance"
+	"go.uber.org/zap"
+)
+
+func TestNewItem(t *testing.T) {
+	tests := []struct {
+		kind    string
+		symbol  string
+		want    Item
+		wantErr bool
+	}{
+		{kind: "stock", symbol: " aapl ", want: Item{Kind: "stock", Symbol: "AAPL"}},
+		{kind: "stock", symbol: "BRK.B", want: Item{Kind: "stock", Symbol: "BRK.B"}},
+		{kind: "coin", symbol: "btc", want: Item{Kind: "coin", Symbol: "BTC"}},
+		{kind: "bond", symbol: "AAPL", wantErr: true},
+		{kind: "stock", symbol: "", wantErr: true},
+		{kind: "stock", symbol: ".AAPL", wantErr: true},
+		{kind: "stock", symbol: "AA PL", wantErr: true},
+		{kind: "coin", symbol: "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.kind+" "+tt.symbol, func(t *testing.T) {
+			it, err := NewItem(tt.kind, tt.symbol)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidItem) {
+					t.Errorf("got %v, %v, want ErrInvalidItem", it, err)
+				}
+				return
+			}
+			if err != nil || it != tt.want {
+				t.Errorf("got %v, %v, want %v", it, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseItems(t *testing.T) {
+	tests := []struct {
+		name    string
+		stocks  string
+		coins   string
+		want    []Item
+		wantErr bool
+	}{
+		{name: "none", want: []Item{}},
+		{
+			name:   "stocks first",
+			stocks: "aapl, msft",
+			coins:  "btc",
+			want:   []Item{{"stock", "AAPL"}, {"stock", "MSFT"}, {"coin", "BTC"}},
+		},
+		{name: "coins only", coins: "BTC,ETH", want: []Item{{"coin", "BTC"}, {"coin", "ETH"}}},
+		{name: "a bad symbol fails all", stocks: "AAPL,$$$", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := ParseItems(tt.stocks, tt.coins)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidItem) {
+					t.Errorf("got %v, %v, want ErrInvalidItem", items, err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(items, tt.want) {
+				t.Errorf("got %v, %v, want %v", items, err, tt.want)
+			}
+		})
+	}
+}
+
+// stubTicker answers the latest intraday and EOD calls from its fields
+// and keeps the symbols EOD was asked for.
+type stubTicker struct {
+	finance.StockTicker
+	intraday    []finance.IntradayBar
+	intradayErr error
+	eod         map[string]float64
+	eodErr      error
+	eodAsked    []string
+}
+
+func (s *stubTicker) GetIntradayLatest(ctx context.Context, symbols []string) (*finance.LatestIntraday, error) {
+	if s.intradayErr != nil {
+		return nil, s.intradayErr
+	}
+	return &finance.LatestIntraday{Data: s.intraday, Source: "intraday"}, nil
+}
+
+func (s *stubTicker) GetEODLatest(ctx context.Context, symbols []string) (*finance.LatestEOD, error) {
+	s.eodAsked = append(s.eodAsked, symbols...)
+	if s.eodErr != nil {
+		return nil, s.eodErr
+	}
+	latest := &finance.LatestEOD{Data: make([]finance.EOD, 0), Source: "eod"}
+	for _, sym := range symbols {
+		if price, ok := s.eod[sym]; ok {
+			latest.Data = append(latest.Data, finance.EOD{Symbol: sym, Close: price})
+		}
+	}
+	return latest, nil
+}
+
+// stubCoins answers live rates in USD.
+type stubCoins struct {
+	finance.CryptoData
+	err error
+}
+
+func (c *stubCoins) GetLiveCryptoData(ctx context.Context, target string) (*finance.LiveData, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &finance.LiveData{Target: "USD", Rates: map[string]float64{"BTC": 50000}, Source: "live"}, nil
+}
+
+func TestPrice(t *testing.T) {
+	errDown := errors.New("vendor down")
+	bar := func(symbol string, last float64, close float64) finance.IntradayBar {
+		b := finance.IntradayBar{Symbol: symbol}
+		if last > 0 {
+			b.Last = finance.NewNumber(last)
+		}
+		if close > 0 {
+			b.Close = finance.NewNumber(close)
+		}
+		return b
+	}
+	stocks := []Item{{"stock", "AAPL"}, {"stock", "MSFT"}, {"stock", "TSLA"}}
+	tests := []struct {
+		name   string
+		ticker *stubTicker
+		want   []Quote
+		// symbols the EOD fallback is asked for
+		eodAsked []string
+	}{
+		{
+			name: "intraday close, then last, then eod",
+			ticker: &stubTicker{
+				intraday: []finance.IntradayBar{bar("AAPL", 101, 100), bar("MSFT", 201, 0), bar("TSLA", 0, 0)},
+				eod:      map[string]float64{"TSLA": 300},
+			},
+			want: []Quote{
+				{Item: stocks[0], Price: 100, Source: "intraday"},
+				{Item: stocks[1], Price: 201, Source: "intraday"},
+				{Item: stocks[2], Price: 300, Source: "eod"},
+			},
+			eodAsked: []string{"TSLA"},
+		},
+		{
+			name:   "all from eod without intraday",
+			ticker: &stubTicker{intradayErr: errDown, eod: map[string]float64{"AAPL": 1, "MSFT": 2}},
+			want: []Quote{
+				{Item: stocks[0], Price: 1, Source: "eod"},
+				{Item: stocks[1], Price: 2, Source: "eod"},
+				{Item: stocks[2], Error: finance.ErrSymbolNotFound.Error()},
+			},
+			eodAsked: []string{"AAPL", "MSFT", "TSLA"},
+		},
+		{
+			name:   "eod failing too",
+			ticker: &stubTicker{intraday: []finance.IntradayBar{bar("AAPL", 0, 100)}, eodErr: errDown},
+			want: []Quote{
+				{Item: stocks[0], Price: 100, Source: "intraday"},
+				{Item: stocks[1], Error: errDown.Error()},
+				{Item: stocks[2], Error: errDown.Error()},
+			},
+			eodAsked: []string{"MSFT", "TSLA"},
+		},
+		{
+			name:   "no eod call when intraday has all",
+			ticker: &stubTicker{intraday: []finance.IntradayBar{bar("AAPL", 0, 1), bar("MSFT", 0, 2), bar("TSLA", 0, 3)}},
+			want: []Quote{
+				{Item: stocks[0], Price: 1, Source: "intraday"},
+				{Item: stocks[1], Price: 2, Source: "intraday"},
+				{Item: stocks[2], Price: 3, Source: "intraday"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewService(zap.NewNop(), nil, tt.ticker, nil, Config{})
+			got := s.Price(context.Background(), stocks, "")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.ticker.eodAsked, tt.eodAsked) {
+				t.Errorf("eod asked for %v, want %v", tt.ticker.eodAsked, tt.eodAsked)
+			}
+		})
+	}
+}
+
+func TestPriceKeepsOrderAcrossKinds(t *testing.T) {
+	items := []Item{{"coin", "BTC"}, {"stock", "AAPL"}, {"coin", "NOPE"}}
+	ticker := &stubTicker{eod: map[string]float64{"AAPL": 100}}
+	s := NewService(zap.NewNop(), nil, ticker, &stubCoins{}, Config{})
+	want := []Quote{
+		{Item: items[0], Price: 50000, Target: "USD", Source: "live"},
+		{Item: items[1], Price: 100, Source: "eod"},
+		{Item: items[2], Error: finance.ErrUnknownCoin.Error()},
+	}
+	if got := s.Price(context.Background(), items, "USD"); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
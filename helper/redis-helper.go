@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -45,6 +46,29 @@ func GetRedisData(ctx context.Context, key string) interface{} {
 	return val
 }
 
+// HasRedisClient reports whether SetRedisClient managed to connect.
+func HasRedisClient() bool {
+	return redisClient != nil
+}
+
+// SetRedisDataTTL stores value under key until ttl runs out. unlike
+// SetRedisData it leaves the value as is and hands errors back.
+func SetRedisDataTTL(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	if redisClient == nil {
+		return redis.ErrClosed
+	}
+	return redisClient.Set(ctx, key, value, ttl).Err()
+}
+
+// GetRedisBytes fetches the raw value under key. a missing key is
+// redis.Nil.
+func GetRedisBytes(ctx context.Context, key string) ([]byte, error) {
+	if redisClient == nil {
+		return nil, redis.ErrClosed
+	}
+	return redisClient.Get(ctx, key).Bytes()
+}
+
 func GetAllKeys(ctx context.Context, key string) []string {
 	keys := []string{}
 	iter := redisClient.Scan(ctx, 0, key, 0).Iterator()
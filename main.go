@@ -1,25 +1,37 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jim-nnamdi/coldfinance/backend/admin"
+	"github.com/jim-nnamdi/coldfinance/backend/alerts"
 	"github.com/jim-nnamdi/coldfinance/backend/connection"
 	"github.com/jim-nnamdi/coldfinance/backend/content"
+	"github.com/jim-nnamdi/coldfinance/backend/events"
 	"github.com/jim-nnamdi/coldfinance/backend/finance"
+	"github.com/jim-nnamdi/coldfinance/backend/finance/indicators"
+	"github.com/jim-nnamdi/coldfinance/backend/portfolios"
+	"github.com/jim-nnamdi/coldfinance/backend/stream"
 	"github.com/jim-nnamdi/coldfinance/backend/users"
+	"github.com/jim-nnamdi/coldfinance/backend/watchlists"
+	"github.com/jim-nnamdi/coldfinance/helper"
 	"go.uber.org/zap"
 )
 
 var (
-	reqc   = finance.NewDataClient(&zap.Logger{})
-	ticker = finance.NewStockTicker(&zap.Logger{}, reqc)
-	crypto = finance.NewCryptos(&zap.Logger{}, reqc)
-	logger = zap.NewNop()
+	logger  = zap.NewNop()
+	ticker  finance.StockTicker
+	catalog *finance.TickerCatalog
+	crypto  finance.CryptoData
 )
 
 func DataResponse(w http.ResponseWriter, v any) {
@@ -27,10 +39,38 @@ func DataResponse(w http.ResponseWriter, v any) {
 	json.NewEncoder(w).Encode(v)
 }
 
+func ErrorResponse(w http.ResponseWriter, status int, err error) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// statusFor maps finance errors to the status we answer with,
+// treating anything unknown as an upstream failure.
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, finance.ErrSymbolNotFound), errors.Is(err, finance.ErrUnknownCoin), errors.Is(err, finance.ErrUnknownCurrency):
+		return http.StatusNotFound
+	case errors.Is(err, finance.ErrInvalidQuery), errors.Is(err, finance.ErrInvalidSymbol):
+		return http.StatusBadRequest
+	case errors.Is(err, finance.ErrNoRate):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, finance.ErrQuotaExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, finance.ErrCatalogNotReady), errors.Is(err, finance.ErrCircuitOpen), errors.Is(err, finance.ErrNoFXRates):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadGateway
+	}
+}
+
 func allstocksdata(w http.ResponseWriter, r *http.Request) {
-	stocks, err := ticker.GetAllTickers()
+	stocks, err := ticker.GetAllTickers(r.Context())
 	if err != nil {
 		connection.Coldfinancelog().Debug("error", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
 		return
 	}
 	DataResponse(w, stocks)
@@ -38,9 +78,10 @@ func allstocksdata(w http.ResponseWriter, r *http.Request) {
 
 func singleStockData(w http.ResponseWriter, r *http.Request) {
 	sym := r.FormValue("symbol")
-	res, err := ticker.GetCompanyTicker(sym)
+	res, err := ticker.GetCompanyTicker(r.Context(), sym)
 	if err != nil {
 		logger.Debug("cannot process single stock data", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
 		return
 	}
 	DataResponse(w, res)
@@ -48,19 +89,265 @@ func singleStockData(w http.ResponseWriter, r *http.Request) {
 
 func singleStockDataEOD(w http.ResponseWriter, r *http.Request) {
 	sym := r.FormValue("symbol")
-	res, err := ticker.GetCompanyEOD(sym)
+	query, err := finance.ParseEODQuery(r.Form)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	res, err := ticker.GetCompanyEOD(r.Context(), sym, query)
 	if err != nil {
 		logger.Debug("cannot fetch EOD for symbol", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
+		return
+	}
+	DataResponse(w, res)
+}
+
+func singleStockDataEODLatest(w http.ResponseWriter, r *http.Request) {
+	if symbols := r.FormValue("symbols"); symbols != "" {
+		res, err := ticker.GetEODLatest(r.Context(), finance.ParseSymbols(symbols))
+		if err != nil {
+			logger.Debug("cannot fetch latest EOD for symbols", zap.Any("error", err))
+			ErrorResponse(w, statusFor(err), err)
+			return
+		}
+		emitEODQuotes(r.Context(), res.Data...)
+		DataResponse(w, res)
+		return
+	}
+	res, err := ticker.GetCompanyEODLatest(r.Context(), r.FormValue("symbol"))
+	if err != nil {
+		logger.Debug("cannot fetch latest EOD for symbol", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
+		return
+	}
+	emitEODQuotes(r.Context(), *res)
+	DataResponse(w, res)
+}
+
+// emitEODQuotes publishes the latest EOD bars a client was sent.
+func emitEODQuotes(ctx context.Context, bars ...finance.EOD) {
+	for _, b := range bars {
+		events.Emit(ctx, events.TypeQuoteFetched, b.Symbol, events.QuoteFetched{Kind: "eod", Symbol: b.Symbol, Exchange: b.Exchange, Price: b.Close, Date: b.Date, Source: b.Source})
+	}
+}
+
+// emitIntradayQuotes publishes the latest intraday bars a client was
+// sent, priced the way watchlists and the stream price them.
+func emitIntradayQuotes(ctx context.Context, source string, bars ...finance.IntradayBar) {
+	for _, b := range bars {
+		price := b.Price()
+		if b.Source != "" {
+			source = b.Source
+		}
+		events.Emit(ctx, events.TypeQuoteFetched, b.Symbol, events.QuoteFetched{Kind: "intraday", Symbol: b.Symbol, Exchange: b.Exchange, Price: price.Float64, Date: b.Date, Source: source})
+	}
+}
+
+func GetIntradayLatest(w http.ResponseWriter, r *http.Request) {
+	if symbols := r.FormValue("symbols"); symbols != "" {
+		res, err := ticker.GetIntradayLatest(r.Context(), finance.ParseSymbols(symbols))
+		if err != nil {
+			logger.Debug("cannot fetch latest intraday for symbols", zap.Any("error", err))
+			ErrorResponse(w, statusFor(err), err)
+			return
+		}
+		emitIntradayQuotes(r.Context(), res.Source, res.Data...)
+		DataResponse(w, res)
+		return
+	}
+	res, err := ticker.GetCompanyIntradayLatest(r.Context(), r.FormValue("symbol"))
+	if err != nil {
+		logger.Debug("cannot fetch latest intraday for symbol", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
+		return
+	}
+	emitIntradayQuotes(r.Context(), "", *res)
+	DataResponse(w, res)
+}
+
+func GetBatch(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	symbols := finance.ParseSymbols(strings.Join(append(r.Form["symbols"], r.Form["symbol"]...), ","))
+	parallelism := 0
+	if v := r.FormValue("parallelism"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			ErrorResponse(w, http.StatusBadRequest, errors.New("parallelism must be a positive number"))
+			return
+		}
+		parallelism = n
+	}
+	res, err := ticker.GetBatch(r.Context(), r.FormValue("type"), symbols, parallelism)
+	if err != nil {
+		ErrorResponse(w, statusFor(err), err)
+		return
+	}
+	DataResponse(w, res)
+}
+
+func SearchStocks(w http.ResponseWriter, r *http.Request) {
+	limit, err := formInt(r, "limit")
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	res, err := catalog.Search(r.FormValue("q"), limit)
+	if err != nil {
+		ErrorResponse(w, statusFor(err), err)
+		return
+	}
+	DataResponse(w, res)
+}
+
+func GetExchanges(w http.ResponseWriter, r *http.Request) {
+	res, err := catalog.Exchanges()
+	if err != nil {
+		ErrorResponse(w, statusFor(err), err)
+		return
+	}
+	DataResponse(w, res)
+}
+
+// GetExchangeTickers serves /exchanges/{mic}/tickers.
+func GetExchangeTickers(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/exchanges/"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] != "tickers" {
+		http.NotFound(w, r)
+		return
+	}
+	limit, err := formInt(r, "limit")
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	offset, err := formInt(r, "offset")
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	res, err := catalog.ExchangeTickers(parts[0], limit, offset)
+	if err != nil {
+		ErrorResponse(w, statusFor(err), err)
+		return
+	}
+	DataResponse(w, res)
+}
+
+// formInt reads an optional whole number form value, zero when unset.
+func formInt(r *http.Request, key string) (int, error) {
+	v := r.FormValue(key)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a whole number", key)
+	}
+	return n, nil
+}
+
+func GetAdjusted(w http.ResponseWriter, r *http.Request) {
+	sym := r.FormValue("symbol")
+	query, err := finance.ParseEODQuery(r.Form)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	res, err := ticker.GetAdjustedEOD(r.Context(), sym, query)
+	if err != nil {
+		logger.Debug("cannot adjust EOD for symbol", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
 		return
 	}
 	DataResponse(w, res)
 }
 
+func GetIndicators(w http.ResponseWriter, r *http.Request) {
+	sym := r.FormValue("symbol")
+	params, err := indicatorParams(r)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var bars []finance.Bar
+	switch r.FormValue("series") {
+	case "", "eod":
+		query, err := finance.ParseEODQuery(r.Form)
+		if err != nil {
+			ErrorResponse(w, http.StatusBadRequest, err)
+			return
+		}
+		res, err := ticker.GetCompanyEOD(r.Context(), sym, query)
+		if err != nil {
+			logger.Debug("cannot fetch EOD for symbol", zap.Any("error", err))
+			ErrorResponse(w, statusFor(err), err)
+			return
+		}
+		bars = finance.EODBars(res.Data.EOD)
+	case "intraday":
+		query, err := finance.ParseIntradayQuery(r.Form)
+		if err != nil {
+			ErrorResponse(w, http.StatusBadRequest, err)
+			return
+		}
+		res, err := ticker.GetCompanyIntraday(r.Context(), sym, query)
+		if err != nil {
+			logger.Debug("cannot fetch intraday for symbol", zap.Any("error", err))
+			ErrorResponse(w, statusFor(err), err)
+			return
+		}
+		if bars, err = finance.IntradayBars(res.Data.Intraday); err != nil {
+			ErrorResponse(w, statusFor(err), err)
+			return
+		}
+	default:
+		ErrorResponse(w, http.StatusBadRequest, errors.New("series must be eod or intraday"))
+		return
+	}
+
+	res, err := indicators.Compute(r.FormValue("indicator"), bars, params)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	DataResponse(w, res)
+}
+
+func indicatorParams(r *http.Request) (indicators.Params, error) {
+	params := indicators.Params{}
+	ints := map[string]*int{
+		"period": &params.Period,
+		"fast":   &params.Fast,
+		"slow":   &params.Slow,
+		"signal": &params.Signal,
+	}
+	for name, dst := range ints {
+		if v := r.FormValue(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return params, fmt.Errorf("%s must be a whole number", name)
+			}
+			*dst = n
+		}
+	}
+	if v := r.FormValue("stddev"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return params, errors.New("stddev must be a number")
+		}
+		params.StdDev = f
+	}
+	return params, nil
+}
+
 func GetSplits(w http.ResponseWriter, r *http.Request) {
 	sym := r.FormValue("symbol")
-	res, err := ticker.GetCompanySplits(sym)
+	res, err := ticker.GetCompanySplits(r.Context(), sym)
 	if err != nil {
 		logger.Debug("cannot fetch EOD for symbol", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
 		return
 	}
 	DataResponse(w, res)
@@ -68,9 +355,10 @@ func GetSplits(w http.ResponseWriter, r *http.Request) {
 
 func GetDividends(w http.ResponseWriter, r *http.Request) {
 	sym := r.FormValue("symbol")
-	res, err := ticker.GetCompanyDividends(sym)
+	res, err := ticker.GetCompanyDividends(r.Context(), sym)
 	if err != nil {
 		logger.Debug("cannot fetch EOD for symbol", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
 		return
 	}
 	DataResponse(w, res)
@@ -78,52 +366,179 @@ func GetDividends(w http.ResponseWriter, r *http.Request) {
 
 func GetIntraday(w http.ResponseWriter, r *http.Request) {
 	sym := r.FormValue("symbol")
-	res, err := ticker.GetCompanyIntraday(sym)
+	var (
+		interval finance.Interval
+		err      error
+	)
+	if v := r.FormValue("interval"); v != "" {
+		if interval, err = finance.ParseInterval(v); err != nil {
+			ErrorResponse(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	query, err := finance.ParseIntradayQuery(r.Form)
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	res, err := ticker.GetCompanyIntraday(r.Context(), sym, query)
 	if err != nil {
 		logger.Debug("cannot fetch EOD for symbol", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
 		return
 	}
-	DataResponse(w, res)
+	if interval.Count == 0 {
+		DataResponse(w, res)
+		return
+	}
+	bars, err := finance.IntradayBars(res.Data.Intraday)
+	if err != nil {
+		ErrorResponse(w, statusFor(err), err)
+		return
+	}
+	DataResponse(w, finance.Candles{
+		Symbol:   res.Data.Symbol,
+		Interval: interval.String(),
+		Bars:     finance.Resample(bars, interval),
+		Source:   res.Source,
+	})
 }
 
 func GetAllCryptoData(w http.ResponseWriter, r *http.Request) {
-	allcoins, err := crypto.GetAllCryptoData()
+	allcoins, err := crypto.GetAllCryptoData(r.Context())
 	if err != nil {
 		logger.Debug("error fetching coins data", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
 		return
 	}
 	DataResponse(w, allcoins)
 }
 
 func GetLiveCryptoData(w http.ResponseWriter, r *http.Request) {
-	res, err := crypto.GetLiveCryptoData()
+	res, err := crypto.GetLiveCryptoData(r.Context(), r.FormValue("target"))
 	if err != nil {
 		logger.Debug("error fetching live stats ...", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
 		return
 	}
 	DataResponse(w, res)
 }
 
 func ConvertCrypto(w http.ResponseWriter, r *http.Request) {
-	coinfrom := r.FormValue("coinfrom")
-	cointo := r.FormValue("cointo")
-	amount := r.FormValue("amount")
-	amtFloat, _ := strconv.Atoi(amount)
-	res, err := crypto.ConvertCrypto(coinfrom, cointo, amtFloat)
+	amount, err := finance.ParseDecimal(r.FormValue("amount"))
+	if err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	res, err := crypto.ConvertCrypto(r.Context(), r.FormValue("coinfrom"), r.FormValue("cointo"), amount, r.FormValue("target"))
 	if err != nil {
 		logger.Debug("error converting crypto", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
 		return
 	}
-	w.Header().Add("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"converted_from":    coinfrom,
-		"converted_to":      cointo,
-		"amount_to_convert": amtFloat,
-		"amount_to_receive": res,
+	events.Emit(r.Context(), events.TypeConversion, res.From, events.ConversionCompleted{
+		From:   res.From,
+		To:     res.To,
+		Amount: res.Amount.String(),
+		Result: res.Result.String(),
+		Rate:   res.Rate.String(),
+		Target: res.Target,
+		Source: res.Source,
 	})
+	DataResponse(w, res)
+}
+
+func GetCryptoHistory(w http.ResponseWriter, r *http.Request) {
+	res, err := crypto.GetHistoricalRates(r.Context(), r.FormValue("date"))
+	if err != nil {
+		logger.Debug("error fetching historical rates", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
+		return
+	}
+	DataResponse(w, res)
+}
+
+func GetCryptoTimeframe(w http.ResponseWriter, r *http.Request) {
+	res, err := crypto.GetTimeframe(r.Context(), r.FormValue("start_date"), r.FormValue("end_date"), finance.ParseSymbols(r.FormValue("symbols")))
+	if err != nil {
+		logger.Debug("error fetching timeframe", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
+		return
+	}
+	DataResponse(w, res)
+}
+
+func GetCryptoStats(w http.ResponseWriter, r *http.Request) {
+	query := finance.StatsQuery{Symbols: finance.ParseSymbols(r.FormValue("symbols"))}
+	var err error
+	if query.Window, err = formInt(r, "days"); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	if query.Period, err = formInt(r, "period"); err != nil {
+		ErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	res, err := crypto.GetStats(r.Context(), query)
+	if err != nil {
+		logger.Debug("error computing crypto stats", zap.Any("error", err))
+		ErrorResponse(w, statusFor(err), err)
+		return
+	}
+	DataResponse(w, res)
 }
 
 func main() {
+	if err := users.LoadJWTSecret(); err != nil {
+		log.Fatal(err)
+	}
+	helper.SetRedisClient(context.Background())
+	broker, err := events.NewBroker(logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if broker != nil {
+		defer broker.Close()
+	}
+	events.SetPublisher(logger, broker)
+	quotas := finance.NewQuotaTracker(finance.QuotaConfigFromEnv())
+	admin.SetQuotaReporter(quotas)
+	reqc := finance.NewDataClient(logger, finance.ClientConfigFromEnv(), quotas)
+	client := finance.NewCachedClient(logger, reqc, finance.NewCacheStore(logger), finance.DefaultCacheRules())
+
+	stocks, err := finance.NewStockProvider(logger, client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	stocks = finance.NewStoredStocks(logger, stocks, finance.NewBarStore(logger, connection.Dbconn()))
+	ticker = finance.NewStockTicker(logger, stocks)
+	catalog = finance.NewTickerCatalog(logger, stocks, finance.NewCatalogStore(logger, connection.Dbconn()), quotas, finance.CatalogConfigFromEnv())
+	go catalog.Run(context.Background())
+	coins, err := finance.NewCryptoRateProvider(logger, client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	coins = finance.NewStoredCryptos(logger, coins, finance.NewRateStore(logger, connection.Dbconn()))
+	fxProvider, err := finance.NewFXProvider(logger, client)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fx := finance.NewFX(logger, fxProvider, finance.FXRefreshFromEnv())
+	if err := fx.Seed(context.Background(), os.Getenv("FX_RATES_FILE")); err != nil {
+		log.Print("could not seed fx rates: ", err)
+	}
+	go fx.Run(context.Background())
+	crypto = finance.NewCryptos(logger, coins, fx)
+	hub := stream.NewHub(logger, crypto, ticker, stream.ConfigFromEnv())
+	go hub.Run(context.Background())
+	alerter := alerts.NewService(logger, alerts.NewStore(logger, connection.Dbconn()), hub, crypto, alerts.NewLogMailer(logger), alerts.ConfigFromEnv())
+	if err := alerter.Load(context.Background()); err != nil {
+		log.Print("could not load alert rules: ", err)
+	}
+	go alerter.Run(context.Background())
+	lists := watchlists.NewService(logger, watchlists.NewStore(logger, connection.Dbconn()), ticker, crypto, watchlists.ConfigFromEnv())
+	portfolio := portfolios.NewService(logger, portfolios.NewStore(logger, connection.Dbconn()), lists, fx, portfolios.ConfigFromEnv())
+
 	log.Print("server running on 9900 ...")
 	route := http.NewServeMux()
 
@@ -141,20 +556,56 @@ func main() {
 	// stocks
 	route.HandleFunc("/stocks", allstocksdata)
 	route.HandleFunc("/stocks/single", singleStockData)
+	route.HandleFunc("/stocks/batch", GetBatch)
+	route.HandleFunc("/stocks/search", SearchStocks)
 	route.HandleFunc("/stocks/single/eod", singleStockDataEOD)
+	route.HandleFunc("/stocks/single/eod/latest", singleStockDataEODLatest)
+	route.HandleFunc("/stocks/adjusted", GetAdjusted)
+	route.HandleFunc("/stocks/indicators", GetIndicators)
 	route.HandleFunc("/stocks/splits", GetSplits)
 	route.HandleFunc("/stocks/dividends", GetDividends)
 	route.HandleFunc("/stocks/intraday", GetIntraday)
+	route.HandleFunc("/stocks/intraday/latest", GetIntradayLatest)
+
+	// exchanges
+	route.HandleFunc("/exchanges", GetExchanges)
+	route.HandleFunc("/exchanges/", GetExchangeTickers)
 
 	// crypto
 	route.HandleFunc("/coins", GetAllCryptoData)
 	route.HandleFunc("/coins/live", GetLiveCryptoData)
 	route.HandleFunc("/coins/convert", ConvertCrypto)
+	route.HandleFunc("/coins/history", GetCryptoHistory)
+	route.HandleFunc("/coins/timeframe", GetCryptoTimeframe)
+	route.HandleFunc("/coins/stats", GetCryptoStats)
+
+	// streaming
+	route.HandleFunc("/stream/ws", hub.ServeWS)
+	route.HandleFunc("/stream/sse", hub.ServeSSE)
+
+	// alerts
+	route.HandleFunc("/alerts", alerter.Rules)
+	route.HandleFunc("/alerts/delete", alerter.DeleteRule)
+	route.HandleFunc("/notifications", alerter.Notifications)
+	route.HandleFunc("/notifications/read", alerter.MarkRead)
+
+	// watchlists
+	route.HandleFunc("/watchlists", lists.Watchlists)
+	route.HandleFunc("/watchlists/rename", lists.RenameWatchlist)
+	route.HandleFunc("/watchlists/delete", lists.DeleteWatchlist)
+	route.HandleFunc("/watchlists/items", lists.AddWatchlistItems)
+	route.HandleFunc("/watchlists/items/remove", lists.RemoveWatchlistItems)
+	route.HandleFunc("/watchlists/quotes", lists.WatchlistQuotes)
+
+	// portfolio
+	route.HandleFunc("/portfolio", portfolio.GetPortfolio)
+	route.HandleFunc("/portfolio/transactions", portfolio.ManageTransactions)
+	route.HandleFunc("/portfolio/transactions/delete", portfolio.RemoveTransaction)
 
 	// admin
 	route.HandleFunc("/admin", admin.GetAllData)
 
-	err := http.ListenAndServe(":9900", route)
+	err = http.ListenAndServe(":9900", route)
 	if err != nil {
 		log.Fatal(err)
 	}